@@ -31,6 +31,7 @@
 package sonos
 
 import (
+	"context"
 	"github.com/ianr0bkny/go-sonos/model"
 	"github.com/ianr0bkny/go-sonos/upnp"
 	"log"
@@ -51,6 +52,8 @@ const (
 	ObjectID_Attribute_Album     = "A:ALBUM"
 	ObjectID_Attribute_Artist    = "A:ARTIST"
 	ObjectID_Attribute_Composers = "A:COMPOSER"
+	ObjectID_Attribute_Tracks    = "A:TRACKS"
+	ObjectID_Attribute_Playlists = "A:PLAYLISTS"
 )
 
 func (this *Sonos) GetRootLevelChildren() (objects []model.Object, err error) {
@@ -63,7 +66,7 @@ func (this *Sonos) GetRootLevelChildren() (objects []model.Object, err error) {
 		RequestCount:  0,
 		SortCriteria:  upnp.BrowseSortCriteria_None,
 	}
-	if result, err = this.Browse(req); nil != err {
+	if result, err = this.BrowseAll(context.Background(), req); nil != err {
 		return
 	} else {
 		objects = model.ObjectStream(result.Doc)
@@ -81,7 +84,7 @@ func (this *Sonos) ListQueues() (objects []model.Object, err error) {
 		RequestCount:  0,
 		SortCriteria:  upnp.BrowseSortCriteria_None,
 	}
-	if result, err = this.Browse(req); nil != err {
+	if result, err = this.BrowseAll(context.Background(), req); nil != err {
 		return
 	} else {
 		objects = model.ObjectStream(result.Doc)
@@ -99,7 +102,7 @@ func (this *Sonos) ListSavedQueues() (objects []model.Object, err error) {
 		RequestCount:  0,
 		SortCriteria:  upnp.BrowseSortCriteria_None,
 	}
-	if result, err = this.Browse(req); nil != err {
+	if result, err = this.BrowseAll(context.Background(), req); nil != err {
 		return
 	} else {
 		objects = model.ObjectStream(result.Doc)
@@ -117,7 +120,7 @@ func (this *Sonos) ListInternetRadio() (objects []model.Object, err error) {
 		RequestCount:  0,
 		SortCriteria:  upnp.BrowseSortCriteria_None,
 	}
-	if result, err = this.Browse(req); nil != err {
+	if result, err = this.BrowseAll(context.Background(), req); nil != err {
 		return
 	} else {
 		objects = model.ObjectStream(result.Doc)
@@ -135,7 +138,7 @@ func (this *Sonos) ListAttributes() (objects []model.Object, err error) {
 		RequestCount:  0,
 		SortCriteria:  upnp.BrowseSortCriteria_None,
 	}
-	if result, err = this.Browse(req); nil != err {
+	if result, err = this.BrowseAll(context.Background(), req); nil != err {
 		return
 	} else {
 		objects = model.ObjectStream(result.Doc)
@@ -153,7 +156,7 @@ func (this *Sonos) ListMusicShares() (objects []model.Object, err error) {
 		RequestCount:  0,
 		SortCriteria:  upnp.BrowseSortCriteria_None,
 	}
-	if result, err = this.Browse(req); nil != err {
+	if result, err = this.BrowseAll(context.Background(), req); nil != err {
 		return
 	} else {
 		objects = model.ObjectStream(result.Doc)
@@ -171,7 +174,7 @@ func (this *Sonos) GetAllGenres() (objects []model.Object, err error) {
 		RequestCount:  0,
 		SortCriteria:  upnp.BrowseSortCriteria_None,
 	}
-	if result, err = this.Browse(req); nil != err {
+	if result, err = this.BrowseAll(context.Background(), req); nil != err {
 		return
 	} else {
 		objects = model.ObjectStream(result.Doc)
@@ -189,7 +192,7 @@ func (this *Sonos) GetAllComposers() (objects []model.Object, err error) {
 		RequestCount:  0,
 		SortCriteria:  upnp.BrowseSortCriteria_None,
 	}
-	if result, err = this.Browse(req); nil != err {
+	if result, err = this.BrowseAll(context.Background(), req); nil != err {
 		return
 	} else {
 		objects = model.ObjectStream(result.Doc)
@@ -218,7 +221,7 @@ func (this *Sonos) GetGenreArtists(genre string) ([]model.Object, error) {
 		RequestCount:  0,
 		SortCriteria:  upnp.BrowseSortCriteria_None,
 	}
-	if result, err := this.Browse(req); nil != err {
+	if result, err := this.BrowseAll(context.Background(), req); nil != err {
 		log.Printf("Could not browse artists for genre `%s': %v", genre, err)
 		return nil, err
 	} else {
@@ -236,7 +239,7 @@ func (this *Sonos) ListChildren(objectId string) (objects []model.Object, err er
 		RequestCount:  0,
 		SortCriteria:  upnp.BrowseSortCriteria_None,
 	}
-	if result, err = this.Browse(req); nil != err {
+	if result, err = this.BrowseAll(context.Background(), req); nil != err {
 		return
 	} else {
 		objects = model.ObjectStream(result.Doc)
@@ -254,7 +257,7 @@ func (this *Sonos) GetMetadata(objectId string) (objects []model.Object, err err
 		RequestCount:  0,
 		SortCriteria:  upnp.BrowseSortCriteria_None,
 	}
-	if result, err = this.Browse(req); nil != err {
+	if result, err = this.BrowseAll(context.Background(), req); nil != err {
 		return
 	} else {
 		objects = model.ObjectStream(result.Doc)
@@ -272,7 +275,7 @@ func (this *Sonos) GetDirectChildren(objectId string) (objects []model.Object, e
 		RequestCount:  0,
 		SortCriteria:  upnp.BrowseSortCriteria_None,
 	}
-	if result, err = this.Browse(req); nil != err {
+	if result, err = this.BrowseAll(context.Background(), req); nil != err {
 		return
 	} else {
 		objects = model.ObjectStream(result.Doc)
@@ -290,7 +293,7 @@ func (this *Sonos) GetQueueContents() (objects []model.Object, err error) {
 		RequestCount:  0,
 		SortCriteria:  upnp.BrowseSortCriteria_None,
 	}
-	if result, err = this.Browse(req); nil != err {
+	if result, err = this.BrowseAll(context.Background(), req); nil != err {
 		return
 	} else {
 		objects = model.ObjectStream(result.Doc)
@@ -308,7 +311,7 @@ func (this *Sonos) GetAlbumTracks(album string) ([]model.Object, error) {
 		SortCriteria:  upnp.BrowseSortCriteria_None,
 	}
 	log.Printf("Browsing tracks for album `%s'", album)
-	if result, err := this.Browse(req); nil != err {
+	if result, err := this.BrowseAll(context.Background(), req); nil != err {
 		log.Printf("Could not browse tracks for album `%s': %v", album, err)
 		return nil, err
 	} else {
@@ -316,13 +319,18 @@ func (this *Sonos) GetAlbumTracks(album string) ([]model.Object, error) {
 	}
 }
 
+//
+// Returns the tracks titled @track on @album, found by searching tracks
+// for the title (see Search()) rather than by reading the whole album.
+//
 func (this *Sonos) GetTrackFromAlbum(album, track string) ([]model.Object, error) {
-	if tracks, err := this.GetAlbumTracks(album); nil != err {
+	opts := &SearchOptions{Mode: MatchMode_Exact, CaseSensitive: true}
+	if result, err := this.Search(SearchKind_Tracks, track, opts); nil != err {
 		return nil, err
 	} else {
 		var track_objs []model.Object
-		for _, track_obj := range tracks {
-			if track_obj.Title() == track {
+		for _, track_obj := range result.Objects {
+			if track_obj.Album() == album {
 				track_objs = append(track_objs, track_obj)
 			}
 		}
@@ -340,10 +348,43 @@ func (this *Sonos) GetArtistAlbums(artist string) (objects []model.Object, err e
 		RequestCount:  0,
 		SortCriteria:  upnp.BrowseSortCriteria_None,
 	}
-	if result, err = this.Browse(req); nil != err {
+	if result, err = this.BrowseAll(context.Background(), req); nil != err {
 		return
 	} else {
 		objects = model.ObjectStream(result.Doc)
 	}
 	return
 }
+
+//
+// Returns up to @count children of @objectId starting with the first whose
+// title sorts at or after @prefix, found with FindPrefix(), e.g. a page of
+// artists beginning "M" from A:ARTIST.  A @count of zero asks for one page
+// of upnp.BrowsePageSize_Default.
+//
+func (this *Sonos) ListChildrenFrom(objectId, prefix string, count uint32) (objects []model.Object, err error) {
+	var start uint32
+	if start, _, err = this.FindPrefix(objectId, prefix); nil != err {
+		return
+	}
+	if 0 == count {
+		count = upnp.BrowsePageSize_Default
+	}
+	req := &upnp.BrowseRequest{
+		ObjectID:      objectId,
+		BrowseFlag:    upnp.BrowseFlag_BrowseDirectChildren,
+		Filter:        upnp.BrowseFilter_All,
+		StartingIndex: start,
+		RequestCount:  count,
+		SortCriteria:  upnp.BrowseSortCriteria_None,
+	}
+	iter := this.BrowseIter(context.Background(), req)
+	for uint32(len(objects)) < count && iter.Next() {
+		objects = append(objects, model.ObjectStream(iter.Page().Doc)...)
+	}
+	if uint32(len(objects)) > count {
+		objects = objects[:count]
+	}
+	err = iter.Err()
+	return
+}
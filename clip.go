@@ -0,0 +1,219 @@
+//
+// go-sonos
+// ========
+//
+// Copyright (c) 2012, Ian T. Richards <ianr@panix.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//   * Redistributions of source code must retain the above copyright notice,
+//     this list of conditions and the following disclaimer.
+//   * Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+// TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package sonos
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ianr0bkny/go-sonos/ssdp"
+	"github.com/ianr0bkny/go-sonos/upnp"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// Leave the volume of each room as it is while a clip plays
+	ClipVolume_Unchanged = -1
+	// The longest a clip may play before the prior state is restored
+	ClipTimeout = 5 * time.Minute
+	// How often the transport is polled for the start of a clip, and
+	// then for its end
+	clipStartPollInterval = 100 * time.Millisecond
+	clipPollInterval      = 500 * time.Millisecond
+	// How long a clip may take to start before it is taken as finished
+	clipStartTimeout = 10 * time.Second
+)
+
+//
+// Wait for any clip playing in @rooms, then hold them until the returned
+// function is called.  Rooms are locked in UUID order so that clips for
+// overlapping sets of rooms cannot deadlock.
+//
+func (this *Household) lockClips(rooms []*Room) (unlock func()) {
+	var uuids []string
+	for _, room := range rooms {
+		uuids = append(uuids, string(room.Main.UUID))
+	}
+	sort.Strings(uuids)
+	var locks []*sync.Mutex
+	this.lock.Lock()
+	if nil == this.clips {
+		this.clips = make(map[ssdp.UUID]*sync.Mutex)
+	}
+	for i, uuid := range uuids {
+		if 0 < i && uuid == uuids[i-1] {
+			continue
+		}
+		lock, has := this.clips[ssdp.UUID(uuid)]
+		if !has {
+			lock = new(sync.Mutex)
+			this.clips[ssdp.UUID(uuid)] = lock
+		}
+		locks = append(locks, lock)
+	}
+	this.lock.Unlock()
+	for _, lock := range locks {
+		lock.Lock()
+	}
+	return func() {
+		for i := len(locks) - 1; 0 <= i; i-- {
+			locks[i].Unlock()
+		}
+	}
+}
+
+//
+// Poll @player's transport until the clip has started and stopped again.
+// The clip counts as started once the transport is seen playing or
+// transitioning, which is polled for often so that a short clip is not
+// missed; a transport that does not start within clipStartTimeout is
+// taken as finished.
+//
+func (this *Household) waitForClip(player *Player) (err error) {
+	started := false
+	begin := time.Now()
+	for {
+		if started {
+			time.Sleep(clipPollInterval)
+		} else {
+			time.Sleep(clipStartPollInterval)
+		}
+		var state string
+		err = this.call(player, func(s *Sonos) (err error) {
+			var info *upnp.TransportInfo
+			if info, err = s.AVTransport.GetTransportInfo(0); nil == err {
+				state = info.CurrentTransportState
+			}
+			return
+		})
+		if nil != err {
+			return
+		}
+		elapsed := time.Since(begin)
+		switch state {
+		case upnp.State_PLAYING, upnp.State_TRANSITIONING:
+			started = true
+		default:
+			if started || clipStartTimeout < elapsed {
+				return
+			}
+		}
+		if ClipTimeout < elapsed {
+			return errors.New("Timed out waiting for the clip to finish")
+		}
+	}
+}
+
+//
+// Play the clip at @uri in the room, then put back what was playing; see
+// Household.PlayClip().
+//
+func (this *Zone) PlayClip(uri string, volume int) error {
+	return this.household.PlayClip([]string{string(this.uuid)}, uri, volume)
+}
+
+//
+// Play the clip at @uri in @rooms (named as for Lookup()) at once, then
+// put back what was playing.  The groups the rooms belong to are
+// snapshotted, the rooms are grouped together under the first, and each
+// is set to @volume, from 0 to 100, unless that is ClipVolume_Unchanged;
+// any other negative volume is an error.  The end of the clip is found
+// by polling the transport, after which every snapshot is restored,
+// grouping included.  A clip for a room that is already playing one
+// waits for it to finish.
+//
+// Ducking what was playing under the clip is out of scope: over UPnP a
+// transport plays one URI at a time, so it is stopped for the clip and
+// restored after it, and only a fixed clip volume can be set.
+//
+func (this *Household) PlayClip(rooms []string, uri string, volume int) (err error) {
+	if ClipVolume_Unchanged > volume {
+		return errors.New(fmt.Sprintf("Invalid clip volume %d", volume))
+	}
+	targets, err := this.lookupRooms(rooms...)
+	if nil != err {
+		return
+	} else if 0 == len(targets) {
+		return errors.New("No rooms to play the clip in")
+	}
+	unlock := this.lockClips(targets)
+	defer unlock()
+	var snapshots []*Snapshot
+	taken := make(map[*Group]bool)
+	for _, target := range targets {
+		group := this.current(target).Group
+		if taken[group] {
+			continue
+		}
+		taken[group] = true
+		snapshot := MakeSnapshot(&Zone{household: this, uuid: target.Main.UUID})
+		if err = snapshot.Take(); nil != err {
+			return
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	defer func() {
+		for _, snapshot := range snapshots {
+			snapshotKeep(&err, snapshot.Restore())
+		}
+	}()
+	var names []string
+	for _, target := range targets {
+		names = append(names, string(target.Main.UUID))
+	}
+	if err = this.SetGroups([][]string{names}); nil != err {
+		return
+	}
+	if 100 < volume {
+		volume = 100
+	}
+	if ClipVolume_Unchanged != volume {
+		for _, target := range targets {
+			snapshotKeep(&err, this.call(target.Main, func(s *Sonos) (err error) {
+				snapshotKeep(&err, s.RenderingControl.SetMute(0, upnp.Channel_Master, false))
+				snapshotKeep(&err, s.RenderingControl.SetVolume(0, upnp.Channel_Master, uint16(volume)))
+				return
+			}))
+		}
+	}
+	leader := targets[0].Main
+	if err = this.call(leader, func(s *Sonos) (err error) {
+		if err = s.AVTransport.SetAVTransportURI(0, uri, ""); nil == err {
+			err = s.AVTransport.Play(0, upnp.PlaySpeed_1)
+		}
+		return
+	}); nil != err {
+		return
+	}
+	snapshotKeep(&err, this.waitForClip(leader))
+	return
+}
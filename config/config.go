@@ -58,8 +58,10 @@ import (
 	"github.com/ianr0bkny/go-sonos/ssdp"
 	"io"
 	"log"
+	"net"
 	"os"
 	"path"
+	"time"
 )
 
 //
@@ -124,6 +126,18 @@ func (this *configDevice) UUID() ssdp.UUID {
 	return this.uuid
 }
 
+func (this *configDevice) LastSeen() (lastSeen time.Time) {
+	return
+}
+
+func (this *configDevice) Interface() (ifiname string) {
+	return
+}
+
+func (this *configDevice) LocalAddr() (localAddr net.IP) {
+	return
+}
+
 func (this *configDevice) Service(key ssdp.ServiceKey) (service ssdp.Service, has bool) {
 	return
 }
@@ -36,11 +36,13 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"github.com/ianr0bkny/go-sonos"
 	"github.com/ianr0bkny/go-sonos/config"
+	"github.com/ianr0bkny/go-sonos/model"
 	"github.com/ianr0bkny/go-sonos/ssdp"
 	"log"
 	"os"
@@ -61,6 +63,13 @@ func cleanup() {
 	CONFIG.Save()
 }
 
+// Write @value to stdout in the wire format of model/schema.json
+func writeJSON(value interface{}) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(model.MakeEnvelope(value))
+}
+
 func alias(flags *Args, args []string) (err error) {
 	switch len(args) {
 	case 0:
@@ -123,9 +132,17 @@ func devices(flags *Args, args []string) (err error) {
 		panic(err)
 	} else {
 		dm := mgr.Devices()
-		for uuid, dev := range dm {
-			fmt.Printf("%s {\n\tProduct = %s\n\tName = %s\n\tLocation = %s\n}\n",
-				uuid, dev.Product(), dev.Name(), dev.Location())
+		if *flags.json {
+			list := []model.DeviceMessage{}
+			for _, dev := range dm {
+				list = append(list, *model.GetDeviceMessage(dev))
+			}
+			writeJSON(list)
+		} else {
+			for uuid, dev := range dm {
+				fmt.Printf("%s {\n\tProduct = %s\n\tName = %s\n\tLocation = %s\n\tInterface = %s (%s)\n}\n",
+					uuid, dev.Product(), dev.Name(), dev.Location(), dev.Interface(), dev.LocalAddr())
+			}
 		}
 	}
 	return
@@ -139,6 +156,8 @@ func queue(flags *Args, args []string) (err error) {
 		s := sonos.Connect(dev, nil, sonos.SVC_CONTENT_DIRECTORY)
 		if q, err := s.GetQueueContents(); nil != err {
 			log.Fatalf("GetQueueContents: %#v", err)
+		} else if *flags.json {
+			writeJSON(model.GetQueueContentsMessage(q))
 		} else {
 			for _, track := range q {
 				log.Printf("%s\n", track.Title())
@@ -168,11 +187,12 @@ type Args struct {
 	configDir       *string
 	discoveryDevice *string
 	discoveryPort   *int
+	json            *bool
 }
 
 func Usage() {
-	fmt.Fprintf(os.Stderr, "usage: cscl [-S <uuid/alias>] [-C <configdir=~/.go-sonos/>] [-D <discovery device=eth0>]\n")
-	fmt.Fprintf(os.Stderr, "            [-P <discovery port=13104>]\n")
+	fmt.Fprintf(os.Stderr, "usage: cscl [-S <uuid/alias>] [-C <configdir=~/.go-sonos/>] [-D <discovery device(s)=all>]\n")
+	fmt.Fprintf(os.Stderr, "            [-P <discovery port=13104>] [--json]\n")
 	fmt.Fprintf(os.Stderr, "            [--help|--usage]\n")
 	fmt.Fprintf(os.Stderr, "            <command> [args ...]\n\n")
 	fmt.Fprintf(os.Stderr, "The available commands are:\n")
@@ -189,9 +209,10 @@ func main() {
 	args := Args{}
 	args.alias = flag.String("S", "", "device alias name")
 	args.configDir = flag.String("C", "", "go-sonos configuration directory")
-	args.discoveryDevice = flag.String("D", "eth0", "discovery device")
+	args.discoveryDevice = flag.String("D", ssdp.AllInterfaces, "discovery device(s), comma-separated; all by default")
 	args.discoveryPort = flag.Int("P", 13104, "discovery response port")
 	args.help = flag.Bool("help", false, "show the usage message")
+	args.json = flag.Bool("json", false, "write results as JSON (see model/schema.json)")
 	args.usage = flag.Bool("usage", false, "show the usage message")
 	flag.Usage = Usage
 	flag.Parse()
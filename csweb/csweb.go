@@ -42,10 +42,10 @@ import (
 	"github.com/ianr0bkny/go-sonos"
 	"github.com/ianr0bkny/go-sonos/config"
 	"github.com/ianr0bkny/go-sonos/model"
+	"github.com/ianr0bkny/go-sonos/ssdp"
 	"github.com/ianr0bkny/go-sonos/upnp"
 	"log"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
 )
@@ -55,14 +55,15 @@ const (
 	CSWEB_DEVICE        = "kitchen"
 	CSWEB_DISCOVER_PORT = "13104"
 	CSWEB_EVENTING_PORT = "13105"
-	CSWEB_NETWORK       = "eth0"
+	CSWEB_NETWORK       = ssdp.AllInterfaces
 	CSWEB_HTTP_PORT     = 8080
 )
 
 func initSonos(config *config.Config) *sonos.Sonos {
 	var s *sonos.Sonos
 	if dev := config.Lookup(CSWEB_DEVICE); nil != dev {
-		s = sonos.Connect(dev, nil, sonos.SVC_CONTENT_DIRECTORY|sonos.SVC_AV_TRANSPORT|sonos.SVC_RENDERING_CONTROL)
+		s = sonos.Connect(dev, nil, sonos.SVC_CONTENT_DIRECTORY|sonos.SVC_AV_TRANSPORT|sonos.SVC_RENDERING_CONTROL|
+			sonos.SVC_ZONE_GROUP_TOPOLOGY|sonos.SVC_ALARM_CLOCK)
 	} else {
 		log.Fatal("Could not create Sonos instance")
 	}
@@ -70,32 +71,20 @@ func initSonos(config *config.Config) *sonos.Sonos {
 }
 
 func replyOk(w http.ResponseWriter, value interface{}) {
-	reply(w, nil, value)
+	reply(w, model.MakeEnvelope(value))
 }
 
 func replyError(w http.ResponseWriter, msg string) {
-	reply(w, errors.New(msg), nil)
+	reply(w, model.MakeErrorEnvelope(errors.New(msg)))
 }
 
-type Reply struct {
-	Error string      `json:",omitempty"`
-	Value interface{} `json:",omitempty"`
-}
-
-func reply(w http.ResponseWriter, err error, value interface{}) {
-	r := Reply{}
-	if nil != err {
-		r.Error = fmt.Sprintf("%v", err)
-	}
-	if nil != value {
-		r.Value = value
-	}
-	encoder := json.NewEncoder(os.Stdout)
-	if false {
-		encoder.Encode(r)
-	}
-	encoder = json.NewEncoder(w)
-	encoder.Encode(r)
+//
+// Every reply is a model.Envelope, the wire format described by
+// model/schema.json.
+//
+func reply(w http.ResponseWriter, r *model.Envelope) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(r)
 }
 
 type handlerFunc func(s *sonos.Sonos, w http.ResponseWriter, r *http.Request) error
@@ -119,7 +108,33 @@ func handle_GetTransportInfo(s *sonos.Sonos, w http.ResponseWriter, r *http.Requ
 	if info, err := s.GetTransportInfo(0); nil != err {
 		return err
 	} else {
-		replyOk(w, info)
+		replyOk(w, model.GetTransportInfoMessage(info))
+	}
+	return nil
+}
+
+//
+// get-zone-group-state
+//
+func handle_GetZoneGroupState(s *sonos.Sonos, w http.ResponseWriter, r *http.Request) error {
+	if groups, err := s.GetZoneGroupState(); nil != err {
+		return err
+	} else {
+		replyOk(w, model.GetGroupsMessage(groups))
+	}
+	return nil
+}
+
+//
+// list-alarms
+//
+func handle_ListAlarms(s *sonos.Sonos, w http.ResponseWriter, r *http.Request) error {
+	if list, version, err := s.ListAlarms(); nil != err {
+		return err
+	} else if alarms, err := model.GetAlarmListMessage(list, version); nil != err {
+		return err
+	} else {
+		replyOk(w, alarms)
 	}
 	return nil
 }
@@ -258,6 +273,8 @@ var controlHandlerMap = map[string]handlerFunc{
 	"get-position-info":       handle_GetPositionInfo,
 	"get-transport-info":      handle_GetTransportInfo,
 	"get-volume":              handle_GetVolume,
+	"get-zone-group-state":    handle_GetZoneGroupState,
+	"list-alarms":             handle_ListAlarms,
 	"next":                    handle_Next,
 	"next-section":            handle_NextSection,
 	"pause":                   handle_Pause,
@@ -354,13 +371,46 @@ func handle_GetQueueContents(s *sonos.Sonos, w http.ResponseWriter, r *http.Requ
 	return nil
 }
 
+//
+// get-prefix-index
+//
+func handle_GetPrefixIndex(s *sonos.Sonos, w http.ResponseWriter, r *http.Request) error {
+	if index, err := s.GetPrefixIndex(r.FormValue("root")); nil != err {
+		return err
+	} else {
+		replyOk(w, model.GetPrefixIndexMessage(index))
+	}
+	return nil
+}
+
+//
+// list-children-from
+//
+func handle_ListChildrenFrom(s *sonos.Sonos, w http.ResponseWriter, r *http.Request) error {
+	var count uint64
+	if count_s := r.FormValue("count"); "" != count_s {
+		var err error
+		if count, err = strconv.ParseUint(count_s, 10, 32); nil != err {
+			return errors.New(fmt.Sprintf("Invalid count `%s' specified", count_s))
+		}
+	}
+	if list, err := s.ListChildrenFrom(r.FormValue("root"), r.FormValue("prefix"), uint32(count)); nil != err {
+		return err
+	} else {
+		replyOk(w, model.GetQueueContentsMessage(list))
+	}
+	return nil
+}
+
 var browseHandlerMap = map[string]handlerFunc{
 	"get-album-tracks":    handle_GetAlbumTracks,
 	"get-all-genres":      handle_GetAllGenres,
 	"get-artist-albums":   handle_GetArtistAlbums,
 	"get-direct-children": handle_GetDirectChildren,
 	"get-genre-artists":   handle_GetGenreArtists,
+	"get-prefix-index":    handle_GetPrefixIndex,
 	"get-queue-contents":  handle_GetQueueContents,
+	"list-children-from":  handle_ListChildrenFrom,
 }
 
 func handleBrowse(s *sonos.Sonos, w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,90 @@
+//
+// go-sonos
+// ========
+//
+// Copyright (c) 2012, Ian T. Richards <ianr@panix.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//   * Redistributions of source code must retain the above copyright notice,
+//     this list of conditions and the following disclaimer.
+//   * Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+// TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package sonos
+
+import (
+	"fmt"
+	"github.com/ianr0bkny/go-sonos/ssdp"
+	"github.com/ianr0bkny/go-sonos/upnp"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+//
+// Serves the description of a device @udn offering the actions listed
+// for each service in @services, keyed by service type (e.g.
+// "AVTransport"), and returns the services as Describe() finds them.
+// Each action called is answered by the body of the SOAP response that
+// @answer returns for it, given the body of the request.
+//
+func testDevice(t *testing.T, udn string, services map[string][]string, answer func(service, action string, body []byte) string) upnp.ServiceMap {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case "/description.xml" == r.URL.Path:
+			fmt.Fprintf(w, `<root xmlns="urn:schemas-upnp-org:device-1-0"><device>`+
+				`<deviceType>urn:schemas-upnp-org:device:ZonePlayer:1</deviceType><UDN>%s</UDN><serviceList>`, udn)
+			for service := range services {
+				fmt.Fprintf(w, `<service><serviceType>urn:schemas-upnp-org:service:%s:1</serviceType>`+
+					`<serviceId>urn:upnp-org:serviceId:%s</serviceId><controlURL>/control/%s</controlURL>`+
+					`<eventSubURL>/event/%s</eventSubURL><SCPDURL>/scpd/%s</SCPDURL></service>`,
+					service, service, service, service, service)
+			}
+			fmt.Fprint(w, `</serviceList></device></root>`)
+		case strings.HasPrefix(r.URL.Path, "/scpd/"):
+			fmt.Fprint(w, `<scpd xmlns="urn:schemas-upnp-org:service-1-0"><actionList>`)
+			for _, action := range services[strings.TrimPrefix(r.URL.Path, "/scpd/")] {
+				fmt.Fprintf(w, `<action><name>%s</name></action>`, action)
+			}
+			fmt.Fprint(w, `</actionList></scpd>`)
+		case strings.HasPrefix(r.URL.Path, "/control/"):
+			soapAction := strings.Trim(r.Header.Get("SOAPACTION"), `"`)
+			action := soapAction[strings.LastIndex(soapAction, "#")+1:]
+			body, _ := ioutil.ReadAll(r.Body)
+			fmt.Fprintf(w, `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>%s</s:Body></s:Envelope>`,
+				answer(strings.TrimPrefix(r.URL.Path, "/control/"), action, body))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	svc_map, err := upnp.Describe(ssdp.Location(server.URL + "/description.xml"))
+	if nil != err {
+		t.Fatal(err)
+	}
+	for service := range services {
+		if 1 != len(svc_map[service]) {
+			t.Fatalf("Described %d %s services", len(svc_map[service]), service)
+		}
+	}
+	return svc_map
+}
@@ -39,14 +39,22 @@ import (
 	"strings"
 )
 
+// Namespaces used in DIDL-Lite documents
+const (
+	Namespace_DIDL  = "urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/"
+	Namespace_DC    = "http://purl.org/dc/elements/1.1/"
+	Namespace_UPnP  = "urn:schemas-upnp-org:metadata-1-0/upnp/"
+	Namespace_Sonos = "urn:schemas-rinconnetworks-com:metadata-1-0/"
+)
+
 type didlValidated struct {
 	Extra []xml.Name `xml:",any"`
 }
 
-func (this *didlValidated) Validate() {
+func (this *didlValidated) validate(kind string) {
 	if 0 < len(this.Extra) {
 		for _, extra := range this.Extra {
-			log.Printf("Missing <Container><%s/>", extra.Local)
+			log.Printf("Missing <%s><%s/>", kind, extra.Local)
 		}
 	}
 }
@@ -61,6 +69,19 @@ type AlbumArtURI struct {
 	Value   string `xml:",chardata"`
 }
 
+// A <upnp:artist>, whose role may be e.g. "AlbumArtist" or "Composer"
+type Artist struct {
+	XMLName xml.Name
+	Role    string `xml:"role,attr,omitempty"`
+	Value   string `xml:",chardata"`
+}
+
+// A <upnp:albumArtist> or Sonos <r:albumArtist>
+type AlbumArtist struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
 type Class struct {
 	XMLName xml.Name
 	Value   string `xml:",chardata"`
@@ -71,16 +92,57 @@ type Creator struct {
 	Value   string `xml:",chardata"`
 }
 
+// A <dc:date>, normally in the ISO 8601 form YYYY-MM-DD
+type Date struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+//
+// A <desc> block of vendor metadata.  Sonos uses it to carry the account
+// token (e.g. SA_RINCON65031_) of the music service an item comes from.
+//
+type Desc struct {
+	XMLName   xml.Name
+	ID        string `xml:"id,attr"`
+	NameSpace string `xml:"nameSpace,attr"`
+	Value     string `xml:",chardata"`
+}
+
+type Genre struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
 type OriginalTrackNumber struct {
 	XMLName xml.Name
 	Value   string `xml:",chardata"`
 }
 
+// The show description Sonos gives with radio streams (<r:radioShowMd>)
+type RadioShowMd struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
 type Res struct {
 	XMLName      xml.Name
 	ProtocolInfo string `xml:"protocolInfo,attr"`
-	Value        string `xml:",chardata"`
+	// The playing time as H+:MM:SS[.F+]
+	Duration        string `xml:"duration,attr,omitempty"`
+	Size            uint64 `xml:"size,attr,omitempty"`
+	Bitrate         uint   `xml:"bitrate,attr,omitempty"`
+	SampleFrequency uint   `xml:"sampleFrequency,attr,omitempty"`
+	NrAudioChannels uint   `xml:"nrAudioChannels,attr,omitempty"`
+	Value           string `xml:",chardata"`
+}
+
+// The title of what a radio stream is playing now (<r:streamContent>)
+type StreamContent struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
 }
+
 type Title struct {
 	XMLName xml.Name
 	Value   string `xml:",chardata"`
@@ -91,14 +153,27 @@ type Container struct {
 	ID          string        `xml:"id,attr"`
 	ParentID    string        `xml:"parentID,attr"`
 	Restricted  bool          `xml:"restricted,attr"`
+	ChildCount  int           `xml:"childCount,attr,omitempty"`
+	Searchable  bool          `xml:"searchable,attr,omitempty"`
 	Res         []Res         `xml:"res"`
 	Title       []Title       `xml:"title"`
 	Class       []Class       `xml:"class"`
 	AlbumArtURI []AlbumArtURI `xml:"albumArtURI"`
 	Creator     []Creator     `xml:"creator"`
+	Artist      []Artist      `xml:"artist"`
+	AlbumArtist []AlbumArtist `xml:"urn:schemas-upnp-org:metadata-1-0/upnp/ albumArtist"`
+	Genre       []Genre       `xml:"genre"`
+	Date        []Date        `xml:"date"`
+	// Sonos extensions
+	SonosAlbumArtist []AlbumArtist `xml:"urn:schemas-rinconnetworks-com:metadata-1-0/ albumArtist"`
+	Desc             []Desc        `xml:"desc"`
 	didlValidated
 }
 
+func (this *Container) Validate() {
+	this.validate("Container")
+}
+
 type Item struct {
 	XMLName             xml.Name
 	ID                  string                `xml:"id,attr"`
@@ -111,9 +186,22 @@ type Item struct {
 	Creator             []Creator             `xml:"creator"`
 	Album               []Album               `xml:"album"`
 	OriginalTrackNumber []OriginalTrackNumber `xml:"originalTrackNumber"`
+	Artist              []Artist              `xml:"artist"`
+	AlbumArtist         []AlbumArtist         `xml:"urn:schemas-upnp-org:metadata-1-0/upnp/ albumArtist"`
+	Genre               []Genre               `xml:"genre"`
+	Date                []Date                `xml:"date"`
+	// Sonos extensions
+	StreamContent    []StreamContent `xml:"streamContent"`
+	RadioShowMd      []RadioShowMd   `xml:"radioShowMd"`
+	SonosAlbumArtist []AlbumArtist   `xml:"urn:schemas-rinconnetworks-com:metadata-1-0/ albumArtist"`
+	Desc             []Desc          `xml:"desc"`
 	didlValidated
 }
 
+func (this *Item) Validate() {
+	this.validate("Item")
+}
+
 type Lite struct {
 	XMLName   xml.Name
 	Container []Container `xml:"container"`
@@ -121,6 +209,17 @@ type Lite struct {
 	didlValidated
 }
 
+// Logs any elements of the document, or of its objects, not modelled here
+func (this *Lite) Validate() {
+	this.validate("DIDL-Lite")
+	for i := range this.Container {
+		this.Container[i].Validate()
+	}
+	for i := range this.Item {
+		this.Item[i].Validate()
+	}
+}
+
 const emptyDocument = "<DIDL-Lite xmlns=\"urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/\"></DIDL-Lite>"
 
 func EmptyDocument() string {
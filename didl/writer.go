@@ -0,0 +1,305 @@
+//
+// go-sonos
+// ========
+//
+// Copyright (c) 2012, Ian T. Richards <ianr@panix.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//   * Redistributions of source code must retain the above copyright notice,
+//     this list of conditions and the following disclaimer.
+//   * Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+// TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package didl
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+)
+
+// UPnP classes used by the presets
+const (
+	Class_MusicTrack        = "object.item.audioItem.musicTrack"
+	Class_AudioItem         = "object.item.audioItem"
+	Class_AudioBroadcast    = "object.item.audioItem.audioBroadcast"
+	Class_PlaylistContainer = "object.container.playlistContainer"
+)
+
+//
+// The <desc> tokens that identify the account of the music service an
+// item is played from.
+//
+const (
+	ServiceToken_Local  = "RINCON_AssociatedZPUDN"
+	ServiceToken_TuneIn = "SA_RINCON65031_"
+)
+
+// Returns the <desc> Sonos uses to carry a music service token
+func SonosDesc(token string) Desc {
+	return Desc{ID: "cdudn", NameSpace: Namespace_Sonos, Value: token}
+}
+
+func didlName(name string) xml.Name {
+	return xml.Name{Local: name}
+}
+
+//
+// The helpers below return a copy of each element list, with every
+// element named for its field and with the dc:, upnp: or r: prefix
+// declared on the root, whatever name it was parsed or built with.
+//
+func didlNameRes(in []Res) (out []Res) {
+	out = append(out, in...)
+	for i := range out {
+		out[i].XMLName = didlName("res")
+	}
+	return
+}
+
+func didlNameDesc(in []Desc) (out []Desc) {
+	out = append(out, in...)
+	for i := range out {
+		out[i].XMLName = didlName("desc")
+	}
+	return
+}
+
+func didlNameArtist(in []Artist) (out []Artist) {
+	out = append(out, in...)
+	for i := range out {
+		out[i].XMLName = didlName("upnp:artist")
+	}
+	return
+}
+
+func didlNameAlbumArtist(in []AlbumArtist, name string) (out []AlbumArtist) {
+	out = append(out, in...)
+	for i := range out {
+		out[i].XMLName = didlName(name)
+	}
+	return
+}
+
+func didlNameTitle(in []Title) (out []Title) {
+	out = append(out, in...)
+	for i := range out {
+		out[i].XMLName = didlName("dc:title")
+	}
+	return
+}
+
+func didlNameClass(in []Class) (out []Class) {
+	out = append(out, in...)
+	for i := range out {
+		out[i].XMLName = didlName("upnp:class")
+	}
+	return
+}
+
+func didlNameAlbumArtURI(in []AlbumArtURI) (out []AlbumArtURI) {
+	out = append(out, in...)
+	for i := range out {
+		out[i].XMLName = didlName("upnp:albumArtURI")
+	}
+	return
+}
+
+func didlNameCreator(in []Creator) (out []Creator) {
+	out = append(out, in...)
+	for i := range out {
+		out[i].XMLName = didlName("dc:creator")
+	}
+	return
+}
+
+func didlNameGenre(in []Genre) (out []Genre) {
+	out = append(out, in...)
+	for i := range out {
+		out[i].XMLName = didlName("upnp:genre")
+	}
+	return
+}
+
+func didlNameDate(in []Date) (out []Date) {
+	out = append(out, in...)
+	for i := range out {
+		out[i].XMLName = didlName("dc:date")
+	}
+	return
+}
+
+func (this *Container) didlPrepare() {
+	this.XMLName = didlName("container")
+	this.Extra = nil
+	this.Res = didlNameRes(this.Res)
+	this.Title = didlNameTitle(this.Title)
+	this.Class = didlNameClass(this.Class)
+	this.AlbumArtURI = didlNameAlbumArtURI(this.AlbumArtURI)
+	this.Creator = didlNameCreator(this.Creator)
+	this.Artist = didlNameArtist(this.Artist)
+	this.AlbumArtist = didlNameAlbumArtist(this.AlbumArtist, "upnp:albumArtist")
+	this.Genre = didlNameGenre(this.Genre)
+	this.Date = didlNameDate(this.Date)
+	this.SonosAlbumArtist = didlNameAlbumArtist(this.SonosAlbumArtist, "r:albumArtist")
+	this.Desc = didlNameDesc(this.Desc)
+}
+
+func (this *Item) didlPrepare() {
+	this.XMLName = didlName("item")
+	this.Extra = nil
+	this.Res = didlNameRes(this.Res)
+	this.Title = didlNameTitle(this.Title)
+	this.Class = didlNameClass(this.Class)
+	this.AlbumArtURI = didlNameAlbumArtURI(this.AlbumArtURI)
+	this.Creator = didlNameCreator(this.Creator)
+	album := append([]Album(nil), this.Album...)
+	for i := range album {
+		album[i].XMLName = didlName("upnp:album")
+	}
+	this.Album = album
+	number := append([]OriginalTrackNumber(nil), this.OriginalTrackNumber...)
+	for i := range number {
+		number[i].XMLName = didlName("upnp:originalTrackNumber")
+	}
+	this.OriginalTrackNumber = number
+	this.Artist = didlNameArtist(this.Artist)
+	this.AlbumArtist = didlNameAlbumArtist(this.AlbumArtist, "upnp:albumArtist")
+	this.Genre = didlNameGenre(this.Genre)
+	this.Date = didlNameDate(this.Date)
+	stream := append([]StreamContent(nil), this.StreamContent...)
+	for i := range stream {
+		stream[i].XMLName = didlName("r:streamContent")
+	}
+	this.StreamContent = stream
+	show := append([]RadioShowMd(nil), this.RadioShowMd...)
+	for i := range show {
+		show[i].XMLName = didlName("r:radioShowMd")
+	}
+	this.RadioShowMd = show
+	this.SonosAlbumArtist = didlNameAlbumArtist(this.SonosAlbumArtist, "r:albumArtist")
+	this.Desc = didlNameDesc(this.Desc)
+}
+
+//
+// Encodes @containers and @items as a DIDL-Lite document, for use as the
+// metadata argument of calls such as SetAVTransportURI and AddURIToQueue.
+// The arguments are not modified.  Unmarshalling the result into a Lite
+// gives back the same objects.
+//
+func Marshal(containers []Container, items []Item) (doc string, err error) {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, `<DIDL-Lite xmlns:dc="%s" xmlns:upnp="%s" xmlns:r="%s" xmlns="%s">`,
+		Namespace_DC, Namespace_UPnP, Namespace_Sonos, Namespace_DIDL)
+	enc := xml.NewEncoder(buf)
+	for _, container := range containers {
+		container.didlPrepare()
+		if err = enc.Encode(&container); nil != err {
+			return
+		}
+	}
+	for _, item := range items {
+		item.didlPrepare()
+		if err = enc.Encode(&item); nil != err {
+			return
+		}
+	}
+	buf.WriteString("</DIDL-Lite>")
+	doc = buf.String()
+	return
+}
+
+// Encodes the objects of a parsed or built document (see Marshal())
+func (this *Lite) Marshal() (string, error) {
+	return Marshal(this.Container, this.Item)
+}
+
+// Encodes a document holding only @item
+func MarshalItem(item *Item) (string, error) {
+	return Marshal(nil, []Item{*item})
+}
+
+// Encodes a document holding only @container
+func MarshalContainer(container *Container) (string, error) {
+	return Marshal([]Container{*container}, nil)
+}
+
+// Returns the <res> for @uri
+func MakeRes(uri, protocolInfo string) Res {
+	return Res{ProtocolInfo: protocolInfo, Value: uri}
+}
+
+// An item of @class with a title and nothing else
+func MakeItem(id, parentID, class, title string) Item {
+	return Item{
+		ID:         id,
+		ParentID:   parentID,
+		Restricted: true,
+		Title:      []Title{{Value: title}},
+		Class:      []Class{{Value: class}},
+	}
+}
+
+//
+// A music track at @uri.  Callers add the artist, album and so on by
+// appending to the item's fields.
+//
+func MusicTrack(id, parentID, title, uri, protocolInfo string) Item {
+	item := MakeItem(id, parentID, Class_MusicTrack, title)
+	item.Res = []Res{MakeRes(uri, protocolInfo)}
+	return item
+}
+
+//
+// A radio station, as given to SetAVTransportURI with a stream URI such as
+// x-sonosapi-stream:s12345?sid=254.  @token is the desc token of the
+// service providing the station (e.g. ServiceToken_TuneIn).
+//
+func RadioStation(id, title, token string) Item {
+	item := MakeItem(id, "-1", Class_AudioBroadcast, title)
+	item.Desc = []Desc{SonosDesc(token)}
+	return item
+}
+
+//
+// A playlist container, as given to AddURIToQueue to enqueue a whole
+// playlist from the service identified by @token.
+//
+func PlaylistContainer(id, parentID, title, token string) Container {
+	return Container{
+		ID:         id,
+		ParentID:   parentID,
+		Restricted: true,
+		Title:      []Title{{Value: title}},
+		Class:      []Class{{Value: Class_PlaylistContainer}},
+		Desc:       []Desc{SonosDesc(token)},
+	}
+}
+
+//
+// The line-in input of the player @uuid (e.g. RINCON_000E58...01400),
+// played with the URI x-rincon-stream:@uuid.
+//
+func LineIn(uuid, title string) Item {
+	item := MakeItem(uuid, "-1", Class_AudioItem, title)
+	item.Res = []Res{MakeRes("x-rincon-stream:"+uuid, "x-rincon-stream:*:*:*")}
+	return item
+}
@@ -0,0 +1,175 @@
+//
+// go-sonos
+// ========
+//
+// Copyright (c) 2012, Ian T. Richards <ianr@panix.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//   * Redistributions of source code must retain the above copyright notice,
+//     this list of conditions and the following disclaimer.
+//   * Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+// TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package didl
+
+import (
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Parse @doc, failing @t unless it is a DIDL-Lite document with nothing unmodelled
+func testUnmarshal(t *testing.T, doc string) *Lite {
+	lite := &Lite{}
+	if err := xml.Unmarshal([]byte(doc), lite); nil != err {
+		t.Fatalf("%v in %s", err, doc)
+	}
+	if (xml.Name{Space: Namespace_DIDL, Local: "DIDL-Lite"}) != lite.XMLName {
+		t.Errorf("Root element is %v", lite.XMLName)
+	}
+	if 0 < len(lite.Extra) {
+		t.Errorf("Unmodelled elements %v", lite.Extra)
+	}
+	for _, item := range lite.Item {
+		if 0 < len(item.Extra) {
+			t.Errorf("Unmodelled item elements %v", item.Extra)
+		}
+	}
+	for _, container := range lite.Container {
+		if 0 < len(container.Extra) {
+			t.Errorf("Unmodelled container elements %v", container.Extra)
+		}
+	}
+	return lite
+}
+
+func testCheckName(t *testing.T, what string, name xml.Name, space, local string) {
+	if space != name.Space || local != name.Local {
+		t.Errorf("%s parsed as {%s}%s, expected {%s}%s", what, name.Space, name.Local, space, local)
+	}
+}
+
+func TestMarshalItemPresets(t *testing.T) {
+	track := MusicTrack("S://nas/music/a.flac", "A:TRACKS", "So What", "x-file-cifs://nas/music/a.flac", "x-file-cifs:*:audio/flac:*")
+	track.Res[0].Duration = "0:09:22"
+	track.Creator = []Creator{{Value: "Miles Davis"}}
+	track.Album = []Album{{Value: "Kind of Blue"}}
+	track.OriginalTrackNumber = []OriginalTrackNumber{{Value: "1"}}
+	track.Artist = []Artist{{Role: "Performer", Value: "Miles Davis"}}
+	track.AlbumArtist = []AlbumArtist{{Value: "Miles Davis"}}
+	track.SonosAlbumArtist = []AlbumArtist{{Value: "Miles Davis Sextet"}}
+	track.Genre = []Genre{{Value: "Jazz"}}
+	track.Date = []Date{{Value: "1959-08-17"}}
+	track.AlbumArtURI = []AlbumArtURI{{Value: "/getaa?u=x-file-cifs%3a%2f%2fnas&v=1"}}
+	track.Desc = []Desc{SonosDesc(ServiceToken_Local)}
+	radio := RadioStation("F00092020s12345", "Radio <&> \"One\"", ServiceToken_TuneIn)
+	radio.StreamContent = []StreamContent{{Value: "Artist - Title"}}
+	radio.RadioShowMd = []RadioShowMd{{Value: "Show,p123"}}
+	tests := []struct {
+		name string
+		item Item
+	}{
+		{"track", track},
+		{"radio station", radio},
+		{"line-in", LineIn("RINCON_000E58741A8401400", "Line-In")},
+	}
+	for _, test := range tests {
+		original := test.item
+		doc, err := MarshalItem(&test.item)
+		if nil != err {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if !reflect.DeepEqual(original, test.item) {
+			t.Errorf("%s: MarshalItem() modified its argument", test.name)
+		}
+		lite := testUnmarshal(t, doc)
+		if 1 != len(lite.Item) || 0 != len(lite.Container) {
+			t.Errorf("%s: parsed %d items and %d containers from %s", test.name, len(lite.Item), len(lite.Container), doc)
+			continue
+		}
+		parsed := lite.Item[0]
+		testCheckName(t, test.name+" item", parsed.XMLName, Namespace_DIDL, "item")
+		testCheckName(t, test.name+" title", parsed.Title[0].XMLName, Namespace_DC, "title")
+		testCheckName(t, test.name+" class", parsed.Class[0].XMLName, Namespace_UPnP, "class")
+		for _, desc := range parsed.Desc {
+			testCheckName(t, test.name+" desc", desc.XMLName, Namespace_DIDL, "desc")
+		}
+		for _, content := range parsed.StreamContent {
+			testCheckName(t, test.name+" stream content", content.XMLName, Namespace_Sonos, "streamContent")
+		}
+		expected := test.item
+		expected.didlPrepare()
+		parsed.didlPrepare()
+		if !reflect.DeepEqual(expected, parsed) {
+			t.Errorf("%s: round trip gave\n%+v\nexpected\n%+v", test.name, parsed, expected)
+		}
+	}
+}
+
+func TestMarshalPlaylistContainer(t *testing.T) {
+	playlist := PlaylistContainer("0006206cspotify%3aplaylist%3a37i9", "10fe2064", "Jazz Classics", "SA_RINCON3079_X_#Svc3079-0-Token")
+	playlist.AlbumArtist = []AlbumArtist{{Value: "Various"}}
+	playlist.SonosAlbumArtist = []AlbumArtist{{Value: "Various Artists"}}
+	doc, err := MarshalContainer(&playlist)
+	if nil != err {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`xmlns:dc="` + Namespace_DC + `"`,
+		`xmlns:upnp="` + Namespace_UPnP + `"`,
+		`xmlns:r="` + Namespace_Sonos + `"`,
+		`xmlns="` + Namespace_DIDL + `"`,
+		`<desc id="cdudn" nameSpace="` + Namespace_Sonos + `">SA_RINCON3079_X_#Svc3079-0-Token</desc>`,
+		`<upnp:class>` + Class_PlaylistContainer + `</upnp:class>`,
+	} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("%s not in %s", want, doc)
+		}
+	}
+	lite := testUnmarshal(t, doc)
+	if 1 != len(lite.Container) || 0 != len(lite.Item) {
+		t.Fatalf("Parsed %d containers and %d items from %s", len(lite.Container), len(lite.Item), doc)
+	}
+	parsed := lite.Container[0]
+	testCheckName(t, "container", parsed.XMLName, Namespace_DIDL, "container")
+	testCheckName(t, "album artist", parsed.AlbumArtist[0].XMLName, Namespace_UPnP, "albumArtist")
+	testCheckName(t, "Sonos album artist", parsed.SonosAlbumArtist[0].XMLName, Namespace_Sonos, "albumArtist")
+	playlist.didlPrepare()
+	parsed.didlPrepare()
+	if !reflect.DeepEqual(playlist, parsed) {
+		t.Errorf("Round trip gave\n%+v\nexpected\n%+v", parsed, playlist)
+	}
+}
+
+func TestMarshalParsed(t *testing.T) {
+	// A parsed document marshals back to the same objects
+	track := MusicTrack("T:1", "A:TRACKS", "Title", "http://example.com/a.mp3", "http-get:*:audio/mpeg:*")
+	doc, err := Marshal([]Container{PlaylistContainer("SQ:1", "SQ:", "Saved", ServiceToken_Local)}, []Item{track})
+	if nil != err {
+		t.Fatal(err)
+	}
+	again, err := testUnmarshal(t, doc).Marshal()
+	if nil != err {
+		t.Fatal(err)
+	} else if doc != again {
+		t.Errorf("Marshalled\n%s\nthen\n%s", doc, again)
+	}
+}
@@ -44,7 +44,7 @@ func main() {
 	log.Print("go-sonos example discovery\n")
 
 	mgr := ssdp.MakeManager()
-	mgr.Discover("eth0", "11209", false)
+	mgr.Discover(ssdp.AllInterfaces, "11209", false)
 	qry := ssdp.ServiceQueryTerms{
 		ssdp.ServiceKey("schemas-upnp-org-ContentDirectory"): -1,
 	}
@@ -39,11 +39,11 @@ func main() {
 	log.Print("go-sonos example discovery\n")
 
 	mgr := ssdp.MakeManager()
-	mgr.Discover("eth0", "11209", false)
+	mgr.Discover(ssdp.AllInterfaces, "11209", false)
 	i := 0
 	dev_map := mgr.Devices()
 	for _, dev := range dev_map {
-		log.Printf("[%02d] %s %s %s %s %s\n", i, dev.Product(), dev.ProductVersion(), dev.Name(), dev.Location(), dev.UUID())
+		log.Printf("[%02d] %s %s %s %s %s %s\n", i, dev.Product(), dev.ProductVersion(), dev.Name(), dev.Location(), dev.UUID(), dev.Interface())
 		i++
 	}
 
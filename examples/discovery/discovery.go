@@ -41,11 +41,18 @@ func main() {
 
 	mgr := ssdp.MakeManager()
 
-	// Discover()
-	//  eth0 := Network device to query for UPnP devices
+	// DiscoveryOptions
+	// Search only for the MusicServices service rather than ssdp:all
+	opts := ssdp.DefaultDiscoveryOptions()
+	opts.SearchTargets = []string{"urn:schemas-upnp-org:service:MusicServices:1"}
+
+	// DiscoverWithOptions()
+	// AllInterfaces := Query every multicast-capable network device
 	// 11209 := Free local port for discovery replies
 	// false := Do not subscribe for asynchronous updates
-	mgr.Discover("eth0", "11209", false)
+	if err := mgr.DiscoverWithOptions(ssdp.AllInterfaces, "11209", false, opts); nil != err {
+		log.Fatal(err)
+	}
 
 	// SericeQueryTerms
 	// A map of service keys to minimum required version
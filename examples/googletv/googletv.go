@@ -45,7 +45,7 @@ func main() {
 	log.Print("go-sonos example discovery\n")
 
 	mgr := ssdp.MakeManager()
-	mgr.Discover("eth0", "11209", false)
+	mgr.Discover(ssdp.AllInterfaces, "11209", false)
 	dev_map := mgr.Devices()
 	for _, dev := range dev_map {
 		if "NSZ-GS7" == dev.Product() {
@@ -0,0 +1,318 @@
+//
+// go-sonos
+// ========
+//
+// Copyright (c) 2012, Ian T. Richards <ianr@panix.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//   * Redistributions of source code must retain the above copyright notice,
+//     this list of conditions and the following disclaimer.
+//   * Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+// TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package sonos
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ianr0bkny/go-sonos/uri"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// How long a grouping operation waits for the topology to change
+	GroupTimeout = 10 * time.Second
+	// How often the topology is re-read while waiting
+	groupPollInterval = 500 * time.Millisecond
+)
+
+// Reports the rooms that a grouping operation could not move
+type GroupError struct {
+	// The error for each room, by room name
+	Failed map[string]error
+}
+
+func (this *GroupError) Error() string {
+	var names []string
+	for name, _ := range this.Failed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var msgs []string
+	for _, name := range names {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", name, this.Failed[name]))
+	}
+	return "Grouping failed for " + strings.Join(msgs, "; ")
+}
+
+func (this *GroupError) add(room *Room, err error) {
+	if nil == this.Failed {
+		this.Failed = make(map[string]error)
+	}
+	if _, has := this.Failed[room.Name]; !has {
+		this.Failed[room.Name] = err
+	}
+}
+
+// Returns nil if nothing failed, so that the result can be returned as error
+func (this *GroupError) result() error {
+	if 0 == len(this.Failed) {
+		return nil
+	}
+	return this
+}
+
+func (this *Household) lookupRooms(idents ...string) (rooms []*Room, err error) {
+	for _, ident := range idents {
+		room := this.Lookup(ident)
+		if nil == room {
+			return nil, errors.New(fmt.Sprintf("No room `%s' in the household", ident))
+		}
+		rooms = append(rooms, room)
+	}
+	return
+}
+
+// Returns the current version of @room, which may come from an older snapshot
+func (this *Household) current(room *Room) *Room {
+	if player := this.Player(room.Main.UUID); nil != player {
+		return player.Room
+	}
+	return room
+}
+
+// True if @a and @b are currently in the same group
+func (this *Household) together(a, b *Room) bool {
+	return this.current(a).Group == this.current(b).Group
+}
+
+// True if @room's group holds only rooms among @rooms
+func (this *Household) within(room *Room, rooms []*Room) bool {
+	for _, member := range this.current(room).Group.Rooms {
+		found := false
+		for _, r := range rooms {
+			found = found || member.Main.UUID == r.Main.UUID
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// The x-rincon: URI that makes a player follow @room's group
+func groupURI(room *Room) string {
+	return uri.Group(string(room.Main.UUID))
+}
+
+// Send @member to the group coordinated by @coordinator
+func (this *Household) sendJoin(member, coordinator *Room) error {
+	target := groupURI(coordinator)
+	return this.call(member.Main, func(s *Sonos) error {
+		return s.AVTransport.SetAVTransportURI(0, target, "")
+	})
+}
+
+// Take @member out of its group
+func (this *Household) sendLeave(member *Room) error {
+	return this.call(member.Main, func(s *Sonos) error {
+		return s.AVTransport.BecomeCoordinatorOfStandaloneGroup(0)
+	})
+}
+
+//
+// Re-read the topology until @placed holds for each of @rooms that has
+// not already failed, or until GroupTimeout passes.  Rooms still not
+// placed are then added to @failures.
+//
+func (this *Household) waitFor(rooms []*Room, placed func(*Room) bool, failures *GroupError) {
+	deadline := time.Now().Add(GroupTimeout)
+	for {
+		this.Refresh()
+		pending := false
+		for _, room := range rooms {
+			if _, failed := failures.Failed[room.Name]; !failed && !placed(room) {
+				pending = true
+			}
+		}
+		if !pending {
+			return
+		} else if time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(groupPollInterval)
+	}
+	for _, room := range rooms {
+		if !placed(room) {
+			failures.add(room, errors.New("Timed out waiting for the topology to change"))
+		}
+	}
+}
+
+//
+// Add the room @member to the group @coordinator belongs to, and wait
+// for the topology to show it.  The rooms are named as for Lookup().
+//
+func (this *Household) Join(member, coordinator string) error {
+	rooms, err := this.lookupRooms(member, coordinator)
+	if nil != err {
+		return err
+	}
+	m, c := rooms[0], this.current(rooms[1]).Group.Coordinator
+	failures := &GroupError{}
+	if !this.together(m, c) {
+		if err := this.sendJoin(m, c); nil != err {
+			failures.add(m, err)
+		}
+	}
+	this.waitFor([]*Room{m}, func(room *Room) bool {
+		return this.together(room, c)
+	}, failures)
+	return failures.result()
+}
+
+// Take the room @member out of its group, and wait for the topology to show it
+func (this *Household) Leave(member string) error {
+	rooms, err := this.lookupRooms(member)
+	if nil != err {
+		return err
+	}
+	m := rooms[0]
+	failures := &GroupError{}
+	if 1 < len(this.current(m).Group.Rooms) {
+		if err := this.sendLeave(m); nil != err {
+			failures.add(m, err)
+		}
+	}
+	this.waitFor(rooms, func(room *Room) bool {
+		return 1 == len(this.current(room).Group.Rooms)
+	}, failures)
+	return failures.result()
+}
+
+//
+// Put every room in one group, under the coordinator of the largest
+// existing group, and wait for the topology to show it.
+//
+func (this *Household) PartyMode() error {
+	var party *Group
+	for _, group := range this.Groups() {
+		if nil == party || len(party.Rooms) < len(group.Rooms) {
+			party = group
+		}
+	}
+	if nil == party {
+		return errors.New("No rooms in the household")
+	}
+	c := party.Coordinator
+	rooms := this.Rooms()
+	failures := &GroupError{}
+	for _, room := range rooms {
+		if !this.together(room, c) {
+			if err := this.sendJoin(room, c); nil != err {
+				failures.add(room, err)
+			}
+		}
+	}
+	this.waitFor(rooms, func(room *Room) bool {
+		return this.together(room, c)
+	}, failures)
+	return failures.result()
+}
+
+//
+// Arrange the rooms named in @layout into the groups it gives, each led
+// by its first room, and wait for the topology to show it.  A group of
+// one room makes that room standalone.  Rooms not named are only moved
+// as far as needed to take the named rooms out of their groups.
+//
+func (this *Household) SetGroups(layout [][]string) error {
+	var groups [][]*Room
+	seen := make(map[string]bool)
+	for _, names := range layout {
+		rooms, err := this.lookupRooms(names...)
+		if nil != err {
+			return err
+		} else if 0 == len(rooms) {
+			continue
+		}
+		for _, room := range rooms {
+			if seen[room.Name] {
+				return errors.New(fmt.Sprintf("Room `%s' appears in more than one group", room.Name))
+			}
+			seen[room.Name] = true
+		}
+		groups = append(groups, rooms)
+	}
+	failures := &GroupError{}
+	// Make each leader the coordinator of a group holding only its own rooms
+	var leaders []*Room
+	for _, rooms := range groups {
+		c := rooms[0]
+		leaders = append(leaders, c)
+		if cur := this.current(c); cur != cur.Group.Coordinator || !this.within(c, rooms) {
+			if err := this.sendLeave(c); nil != err {
+				failures.add(c, err)
+			}
+		}
+	}
+	this.waitFor(leaders, func(room *Room) bool {
+		cur := this.current(room)
+		for _, rooms := range groups {
+			if rooms[0] == room {
+				return cur == cur.Group.Coordinator && this.within(room, rooms)
+			}
+		}
+		return true
+	}, failures)
+	// Then bring in the rest
+	var members []*Room
+	for _, rooms := range groups {
+		c := rooms[0]
+		if _, failed := failures.Failed[c.Name]; failed {
+			for _, room := range rooms[1:] {
+				failures.add(room, errors.New(fmt.Sprintf("Could not prepare `%s' to lead", c.Name)))
+			}
+			continue
+		}
+		for _, room := range rooms[1:] {
+			members = append(members, room)
+			if !this.together(room, c) {
+				if err := this.sendJoin(room, c); nil != err {
+					failures.add(room, err)
+				}
+			}
+		}
+	}
+	this.waitFor(members, func(room *Room) bool {
+		for _, rooms := range groups {
+			for _, r := range rooms[1:] {
+				if r == room {
+					return this.together(room, rooms[0])
+				}
+			}
+		}
+		return true
+	}, failures)
+	return failures.result()
+}
@@ -0,0 +1,492 @@
+//
+// go-sonos
+// ========
+//
+// Copyright (c) 2012, Ian T. Richards <ianr@panix.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//   * Redistributions of source code must retain the above copyright notice,
+//     this list of conditions and the following disclaimer.
+//   * Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+// TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package sonos
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ianr0bkny/go-sonos/config"
+	"github.com/ianr0bkny/go-sonos/ssdp"
+	"github.com/ianr0bkny/go-sonos/upnp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The part a player takes in its room
+const (
+	// The player the room is addressed through: a standalone player, the
+	// left half of a stereo pair, or a home theater soundbar
+	Role_Main = "main"
+	// The other half of a stereo pair
+	Role_Pair = "pair"
+	// A subwoofer bonded to the room
+	Role_Sub = "sub"
+	// A surround speaker bonded to a home theater
+	Role_Surround = "surround"
+)
+
+// A single Sonos player as described by the household topology
+type Player struct {
+	UUID     ssdp.UUID
+	Location ssdp.Location
+	// The name of the room the player belongs to
+	RoomName        string
+	SoftwareVersion string
+	// One of the Role_* constants
+	Role string
+	// The channels the player renders in its bond (e.g. "LF,LF"), if any
+	Channels  string
+	Invisible bool
+	Room      *Room
+}
+
+// Connect to the player's services; see Connect()
+func (this *Player) Connect(reactor upnp.Reactor, flags int) (sonos *Sonos, err error) {
+	var svc_map upnp.ServiceMap
+	if svc_map, err = upnp.Describe(this.Location); nil == err {
+		sonos = MakeSonos(svc_map, reactor, flags)
+	}
+	return
+}
+
+// A room: one player, or several bonded players addressed as one
+type Room struct {
+	Name string
+	// The player commands for the room are sent to
+	Main *Player
+	// Every player in the room, Main first
+	Players []*Player
+	Group   *Group
+}
+
+// Returns the players in the room taking @role
+func (this *Room) PlayersWithRole(role string) (players []*Player) {
+	for _, player := range this.Players {
+		if role == player.Role {
+			players = append(players, player)
+		}
+	}
+	return
+}
+
+// True if the room is a stereo pair
+func (this *Room) IsStereoPair() bool {
+	return 0 < len(this.PlayersWithRole(Role_Pair))
+}
+
+// True if the room has a subwoofer
+func (this *Room) HasSub() bool {
+	return 0 < len(this.PlayersWithRole(Role_Sub))
+}
+
+// True if the room is a home theater with surround speakers
+func (this *Room) HasSurrounds() bool {
+	return 0 < len(this.PlayersWithRole(Role_Surround))
+}
+
+// Rooms playing in sync under the coordinator's transport
+type Group struct {
+	ID          string
+	Coordinator *Room
+	// Every room in the group, the coordinator first
+	Rooms []*Room
+}
+
+//
+// A snapshot of the household topology.  A snapshot is never modified;
+// each update replaces it, so rooms and players taken from one remain
+// consistent with one another.
+//
+type householdState struct {
+	groups  []*Group
+	rooms   map[string]*Room
+	players map[ssdp.UUID]*Player
+}
+
+//
+// Every room and player in a Sonos household, and how they are grouped
+// and bonded, built from discovery and ZoneGroupTopology state.
+//
+// The household stays current when each ZoneGroupTopology event read
+// from the reactor channel is passed to HandleEvent(), or when Refresh()
+// is called.  AVTransport events passed to HandleEvent() likewise keep
+// what each group is playing current; see WatchPlayback().
+//
+type Household struct {
+	source *Sonos
+	config *config.Config
+	state  *householdState
+	conns  map[ssdp.UUID]*householdConnection
+	// Held by each room while it plays a clip
+	clips map[ssdp.UUID]*sync.Mutex
+	// What each player is playing, by player
+	playing map[ssdp.UUID]*NowPlaying
+	// The players whose AVTransport events are subscribed
+	watched map[ssdp.UUID]*Sonos
+	lock    sync.RWMutex
+}
+
+// A cached connection to one player
+type householdConnection struct {
+	location ssdp.Location
+	sonos    *Sonos
+}
+
+//
+// Builds a household from the players found by @mgr, reading the
+// topology from any one of them.  If @reactor is given it is subscribed
+// to that player's ZoneGroupTopology events, which should be passed to
+// HandleEvent().
+//
+func MakeHousehold(mgr ssdp.Manager, reactor upnp.Reactor) (household *Household, err error) {
+	qry := ssdp.ServiceQueryTerms{
+		ssdp.ServiceKey(MUSIC_SERVICES): -1,
+	}
+	res := mgr.QueryServices(qry)
+	for _, dev := range res[MUSIC_SERVICES] {
+		if SONOS != dev.Product() {
+			continue
+		}
+		var svc_map upnp.ServiceMap
+		if svc_map, err = upnp.Describe(dev.Location()); nil != err {
+			continue
+		}
+		household = &Household{source: MakeSonos(svc_map, reactor, SVC_ZONE_GROUP_TOPOLOGY)}
+		if err = household.Refresh(); nil == err {
+			return
+		}
+	}
+	if nil == err {
+		err = errors.New("No Sonos players found")
+	}
+	household = nil
+	return
+}
+
+// Resolve aliases in Lookup() through the bookmarks in @c
+func (this *Household) UseConfig(c *config.Config) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.config = c
+}
+
+//
+// Re-read the topology from the player the household was built from,
+// or, if that player no longer answers, from any other room.
+//
+func (this *Household) Refresh() (err error) {
+	this.lock.RLock()
+	source := this.source
+	this.lock.RUnlock()
+	if err = this.refreshFrom(source); nil == err {
+		return
+	}
+	for _, room := range this.Rooms() {
+		if other, cerr := this.connect(room.Main); nil == cerr && nil == this.refreshFrom(other) {
+			this.lock.Lock()
+			this.source = other
+			this.lock.Unlock()
+			return nil
+		}
+	}
+	return
+}
+
+func (this *Household) refreshFrom(source *Sonos) (err error) {
+	defer func() {
+		if r := recover(); nil != r {
+			err = errors.New(fmt.Sprintf("%v", r))
+		}
+	}()
+	var groups *upnp.ZoneGroups
+	if groups, err = source.GetZoneGroupState(); nil == err {
+		this.update(groups)
+	}
+	return
+}
+
+//
+// Returns a connection to @player, reusing an earlier one unless the
+// player has moved.  Connections are made without event subscriptions.
+//
+func (this *Household) connect(player *Player) (sonos *Sonos, err error) {
+	this.lock.RLock()
+	conn, has := this.conns[player.UUID]
+	this.lock.RUnlock()
+	if has && player.Location == conn.location {
+		return conn.sonos, nil
+	}
+	if sonos, err = player.Connect(nil, SVC_ALL); nil != err {
+		return
+	}
+	this.lock.Lock()
+	if nil == this.conns {
+		this.conns = make(map[ssdp.UUID]*householdConnection)
+	}
+	this.conns[player.UUID] = &householdConnection{player.Location, sonos}
+	this.lock.Unlock()
+	return
+}
+
+// Forget the connection to @player after it has failed
+func (this *Household) disconnect(player *Player) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	delete(this.conns, player.UUID)
+}
+
+//
+// Run @op against a connection to @player.  Service calls panic when the
+// player cannot be reached; that is returned as an error, and the
+// connection dropped.
+//
+func (this *Household) call(player *Player, op func(*Sonos) error) (err error) {
+	var sonos *Sonos
+	if sonos, err = this.connect(player); nil != err {
+		return
+	}
+	defer func() {
+		if r := recover(); nil != r {
+			this.disconnect(player)
+			err = errors.New(fmt.Sprintf("%s: %v", player.RoomName, r))
+		}
+	}()
+	return op(sonos)
+}
+
+//
+// Apply @evt if it is a ZoneGroupTopology event carrying new topology or
+// an AVTransport event from a player in the household, returning true if
+// the household was updated.
+//
+func (this *Household) HandleEvent(evt upnp.Event) bool {
+	switch evt.Type() {
+	case upnp.AVTransport_EventType:
+		return this.handlePlayback(evt.(upnp.AVTransportEvent))
+	case upnp.ZoneGroupTopology_EventType:
+	default:
+		return false
+	}
+	state := evt.(upnp.ZoneGroupTopologyEvent).ZoneGroupState
+	if "" == state {
+		return false
+	}
+	if groups, err := upnp.ParseZoneGroupState(state); nil == err {
+		this.update(groups)
+		return true
+	}
+	return false
+}
+
+func (this *Household) update(groups *upnp.ZoneGroups) {
+	state := householdBuild(groups)
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.state = state
+}
+
+func (this *Household) snapshot() *householdState {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	if nil == this.state {
+		return &householdState{}
+	}
+	return this.state
+}
+
+// Parse a ChannelMapSet or HTSatChanMapSet into channels by UUID
+func householdChannelMap(value string, channels map[ssdp.UUID]string) {
+	for _, entry := range strings.Split(value, ";") {
+		if i := strings.Index(entry, ":"); -1 != i {
+			channels[ssdp.UUID(entry[:i])] = entry[i+1:]
+		}
+	}
+}
+
+// Decide the role of a player from its bond channels and visibility
+func householdRole(channels string, invisible bool) string {
+	for _, channel := range strings.Split(channels, ",") {
+		switch channel {
+		case "SW":
+			return Role_Sub
+		case "LR", "RR":
+			return Role_Surround
+		}
+	}
+	if invisible {
+		return Role_Pair
+	}
+	return Role_Main
+}
+
+func householdBuild(groups *upnp.ZoneGroups) (state *householdState) {
+	state = &householdState{
+		rooms:   make(map[string]*Room),
+		players: make(map[ssdp.UUID]*Player),
+	}
+	for _, zg := range groups.ZoneGroup {
+		group := &Group{ID: zg.ID}
+		rooms := make(map[string]*Room)
+		channels := make(map[ssdp.UUID]string)
+		var members []upnp.ZoneGroupMember
+		for _, member := range zg.ZoneGroupMember {
+			householdChannelMap(member.ChannelMapSet, channels)
+			householdChannelMap(member.HTSatChanMapSet, channels)
+			members = append(members, member)
+			members = append(members, member.Satellite...)
+		}
+		for _, member := range members {
+			uuid := ssdp.UUID(member.UUID)
+			if _, has := state.players[uuid]; has {
+				continue
+			}
+			player := &Player{
+				UUID:            uuid,
+				Location:        ssdp.Location(member.Location),
+				RoomName:        member.ZoneName,
+				SoftwareVersion: member.SoftwareVersion,
+				Channels:        channels[uuid],
+				Invisible:       "1" == member.Invisible,
+			}
+			player.Role = householdRole(player.Channels, player.Invisible)
+			state.players[uuid] = player
+			room, has := rooms[member.ZoneName]
+			if !has {
+				room = &Room{Name: member.ZoneName, Group: group}
+				rooms[member.ZoneName] = room
+				group.Rooms = append(group.Rooms, room)
+			}
+			player.Room = room
+			room.Players = append(room.Players, player)
+			if Role_Main == player.Role && nil == room.Main {
+				room.Main = player
+			}
+		}
+		for _, room := range group.Rooms {
+			if nil == room.Main {
+				room.Main = room.Players[0]
+			}
+			householdMainFirst(room)
+			state.rooms[strings.ToLower(room.Name)] = room
+		}
+		if coordinator, has := state.players[ssdp.UUID(zg.Coordinator)]; has {
+			group.Coordinator = coordinator.Room
+		} else if 0 < len(group.Rooms) {
+			group.Coordinator = group.Rooms[0]
+		}
+		householdCoordinatorFirst(group)
+		if 0 < len(group.Rooms) {
+			state.groups = append(state.groups, group)
+		}
+	}
+	return
+}
+
+func householdMainFirst(room *Room) {
+	for i, player := range room.Players {
+		if player == room.Main {
+			copy(room.Players[1:i+1], room.Players[:i])
+			room.Players[0] = player
+			return
+		}
+	}
+}
+
+func householdCoordinatorFirst(group *Group) {
+	for i, room := range group.Rooms {
+		if room == group.Coordinator {
+			copy(group.Rooms[1:i+1], group.Rooms[:i])
+			group.Rooms[0] = room
+			return
+		}
+	}
+}
+
+// Returns every group, in the order reported by the players
+func (this *Household) Groups() []*Group {
+	return this.snapshot().groups
+}
+
+// Returns every room, sorted by name
+func (this *Household) Rooms() (rooms []*Room) {
+	for _, room := range this.snapshot().rooms {
+		rooms = append(rooms, room)
+	}
+	sort.Slice(rooms, func(i, j int) bool {
+		return rooms[i].Name < rooms[j].Name
+	})
+	return
+}
+
+// Returns every player, including bonded and invisible ones
+func (this *Household) Players() (players []*Player) {
+	for _, player := range this.snapshot().players {
+		players = append(players, player)
+	}
+	sort.Slice(players, func(i, j int) bool {
+		return players[i].UUID < players[j].UUID
+	})
+	return
+}
+
+// Returns the room named @name, ignoring case
+func (this *Household) Room(name string) *Room {
+	return this.snapshot().rooms[strings.ToLower(name)]
+}
+
+// Returns the player with UUID @uuid
+func (this *Household) Player(uuid ssdp.UUID) *Player {
+	return this.snapshot().players[uuid]
+}
+
+//
+// Find the room known by @ident, which may be a bookmark alias (see
+// UseConfig()), a room name or the UUID of any player in the room.
+//
+func (this *Household) Lookup(ident string) *Room {
+	this.lock.RLock()
+	c := this.config
+	this.lock.RUnlock()
+	if nil != c {
+		if dev := c.Lookup(ident); nil != dev {
+			if player := this.Player(dev.UUID()); nil != player {
+				return player.Room
+			}
+		}
+	}
+	if room := this.Room(ident); nil != room {
+		return room
+	} else if player := this.Player(ssdp.UUID(ident)); nil != player {
+		return player.Room
+	}
+	return nil
+}
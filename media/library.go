@@ -0,0 +1,451 @@
+//
+// go-sonos
+// ========
+//
+// Copyright (c) 2012, Ian T. Richards <ianr@panix.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//   * Redistributions of source code must retain the above copyright notice,
+//     this list of conditions and the following disclaimer.
+//   * Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+// TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package media
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The IDs of the containers beneath the root ("0") of a Library
+const (
+	ObjectID_Root    = "0"
+	ObjectID_Artists = "artists"
+	ObjectID_Albums  = "albums"
+	ObjectID_Tracks  = "tracks"
+	ObjectID_Genres  = "genres"
+)
+
+// UPnP classes of the objects in a Library
+const (
+	Class_Container  = "object.container"
+	Class_Artist     = "object.container.person.musicArtist"
+	Class_Album      = "object.container.album.musicAlbum"
+	Class_Genre      = "object.container.genre.musicGenre"
+	Class_MusicTrack = "object.item.audioItem.musicTrack"
+)
+
+// A container or track in a Library
+type Object struct {
+	ID       string
+	ParentID string
+	Title    string
+	Class    string
+	// Set for the artist of albums and tracks
+	Artist string
+	// Set for tracks
+	Album    string
+	Genre    string
+	Year     string
+	Track    int
+	Disc     int
+	Duration time.Duration
+	Item     *Item
+	children []*Object
+}
+
+// Whether the object is a container
+func (this *Object) IsContainer() bool {
+	return nil == this.Item
+}
+
+// The number of children of a container
+func (this *Object) ChildCount() int {
+	return len(this.children)
+}
+
+//
+// An index of the audio files beneath a directory, arranged as a
+// ContentDirectory into artists, albums, genres and tracks.  A Library
+// is immutable once built.
+//
+type Library struct {
+	Root    string
+	objects map[string]*Object
+}
+
+func (this *Library) add(obj *Object, parent *Object) *Object {
+	obj.ParentID = parent.ID
+	parent.children = append(parent.children, obj)
+	this.objects[obj.ID] = obj
+	return obj
+}
+
+//
+// Indexes the files beneath @root, making each audio file available
+// through @server.
+//
+func ScanLibrary(root string, server *Server) (this *Library, err error) {
+	this = &Library{Root: root, objects: make(map[string]*Object)}
+	top := &Object{ID: ObjectID_Root, ParentID: "-1", Title: filepath.Base(root), Class: Class_Container}
+	this.objects[top.ID] = top
+	artists := this.add(&Object{ID: ObjectID_Artists, Title: "Artists", Class: Class_Container}, top)
+	albums := this.add(&Object{ID: ObjectID_Albums, Title: "Albums", Class: Class_Container}, top)
+	genres := this.add(&Object{ID: ObjectID_Genres, Title: "Genres", Class: Class_Container}, top)
+	tracks := this.add(&Object{ID: ObjectID_Tracks, Title: "Tracks", Class: Class_Container}, top)
+
+	byArtist := make(map[string]*Object)
+	byAlbum := make(map[string]*Object)
+	byGenre := make(map[string]*Object)
+	err = filepath.Walk(root, func(filename string, info os.FileInfo, werr error) error {
+		if nil != werr || info.IsDir() || !strings.HasPrefix(ContentType(filename), "audio/") {
+			return nil
+		}
+		tags, terr := ReadTags(filename)
+		if nil != terr {
+			return nil
+		}
+		item, aerr := server.AddFile(filename)
+		if nil != aerr {
+			return nil
+		}
+		item.Title = tags.Title
+		artist, has := byArtist[tags.Artist]
+		if !has {
+			artist = this.add(&Object{
+				ID:    fmt.Sprintf("artist:%d", len(byArtist)),
+				Title: tags.Artist,
+				Class: Class_Artist,
+			}, artists)
+			byArtist[tags.Artist] = artist
+		}
+		albumKey := tags.Artist + "\x00" + tags.Album
+		album, has := byAlbum[albumKey]
+		if !has {
+			album = &Object{
+				ID:     fmt.Sprintf("album:%d", len(byAlbum)),
+				Title:  tags.Album,
+				Class:  Class_Album,
+				Artist: tags.Artist,
+				Genre:  tags.Genre,
+				Year:   tags.Year,
+			}
+			this.add(album, albums)
+			artist.children = append(artist.children, album)
+			byAlbum[albumKey] = album
+		}
+		track := this.add(&Object{
+			ID:       "track:" + item.ID,
+			Title:    tags.Title,
+			Class:    Class_MusicTrack,
+			Artist:   tags.Artist,
+			Album:    tags.Album,
+			Genre:    tags.Genre,
+			Year:     tags.Year,
+			Track:    tags.Track,
+			Disc:     tags.Disc,
+			Duration: tags.Duration,
+			Item:     item,
+		}, album)
+		tracks.children = append(tracks.children, track)
+		if "" != tags.Genre {
+			genre, has := byGenre[tags.Genre]
+			if !has {
+				genre = this.add(&Object{
+					ID:    fmt.Sprintf("genre:%d", len(byGenre)),
+					Title: tags.Genre,
+					Class: Class_Genre,
+				}, genres)
+				byGenre[tags.Genre] = genre
+			}
+			genre.children = append(genre.children, track)
+		}
+		return nil
+	})
+	if nil != err {
+		return nil, err
+	}
+	for _, obj := range this.objects {
+		librarySort(obj.children)
+	}
+	return
+}
+
+// Orders containers by title and tracks by album position
+func librarySort(objs []*Object) {
+	sort.SliceStable(objs, func(i, j int) bool {
+		a, b := objs[i], objs[j]
+		if a.IsContainer() || b.IsContainer() {
+			return strings.ToLower(a.Title) < strings.ToLower(b.Title)
+		}
+		if a.Artist != b.Artist {
+			return strings.ToLower(a.Artist) < strings.ToLower(b.Artist)
+		} else if a.Album != b.Album {
+			return strings.ToLower(a.Album) < strings.ToLower(b.Album)
+		} else if a.Disc != b.Disc {
+			return a.Disc < b.Disc
+		} else if a.Track != b.Track {
+			return a.Track < b.Track
+		}
+		return a.Title < b.Title
+	})
+}
+
+// Returns the object with @id, if any
+func (this *Library) Object(id string) (obj *Object, has bool) {
+	obj, has = this.objects[id]
+	return
+}
+
+// Returns the children of the container @id
+func (this *Library) Children(id string) (children []*Object, err error) {
+	obj, has := this.objects[id]
+	if !has {
+		return nil, errors.New(fmt.Sprintf("No such object %s", id))
+	}
+	return obj.children, nil
+}
+
+// The number of tracks in the library
+func (this *Library) NumTracks() int {
+	return this.objects[ObjectID_Tracks].ChildCount()
+}
+
+//
+// Returns the objects beneath the container @id that satisfy the UPnP
+// ContentDirectory search criteria @criteria, in browse order.
+//
+func (this *Library) Search(id, criteria string) (matches []*Object, err error) {
+	obj, has := this.objects[id]
+	if !has {
+		return nil, errors.New(fmt.Sprintf("No such object %s", id))
+	}
+	var match libraryPredicate
+	if match, err = libraryParseCriteria(criteria); nil != err {
+		return
+	}
+	seen := make(map[*Object]bool)
+	var walk func(*Object)
+	walk = func(obj *Object) {
+		for _, child := range obj.children {
+			if seen[child] {
+				continue
+			}
+			seen[child] = true
+			if match(child) {
+				matches = append(matches, child)
+			}
+			walk(child)
+		}
+	}
+	walk(obj)
+	return
+}
+
+type libraryPredicate func(*Object) bool
+
+// Returns the value of a search property for @obj
+func libraryProperty(obj *Object, property string) (value string, has bool) {
+	switch property {
+	case "@id":
+		return obj.ID, true
+	case "@parentID":
+		return obj.ParentID, true
+	case "dc:title":
+		return obj.Title, true
+	case "upnp:class":
+		return obj.Class, true
+	case "dc:creator", "upnp:artist":
+		return obj.Artist, "" != obj.Artist
+	case "upnp:album":
+		return obj.Album, "" != obj.Album
+	case "upnp:genre":
+		return obj.Genre, "" != obj.Genre
+	case "dc:date":
+		return obj.Year, "" != obj.Year
+	case "upnp:originalTrackNumber":
+		return strconv.Itoa(obj.Track), 0 != obj.Track
+	}
+	return "", false
+}
+
+// Splits search criteria into words, quoted strings and parentheses
+func libraryTokenize(criteria string) (tokens []string, err error) {
+	for i := 0; i < len(criteria); {
+		switch c := criteria[i]; {
+		case ' ' == c || '\t' == c || '\r' == c || '\n' == c:
+			i++
+		case '(' == c || ')' == c:
+			tokens = append(tokens, string(c))
+			i++
+		case '"' == c:
+			var value []byte
+			for i++; ; i++ {
+				if i >= len(criteria) {
+					return nil, errors.New("Unterminated string in search criteria")
+				} else if '\\' == criteria[i] && i+1 < len(criteria) {
+					i++
+				} else if '"' == criteria[i] {
+					break
+				}
+				value = append(value, criteria[i])
+			}
+			i++
+			tokens = append(tokens, "\""+string(value))
+		default:
+			start := i
+			for i < len(criteria) && !strings.ContainsRune(" \t\r\n()\"", rune(criteria[i])) {
+				i++
+			}
+			tokens = append(tokens, criteria[start:i])
+		}
+	}
+	return
+}
+
+type libraryParser struct {
+	tokens []string
+}
+
+func (this *libraryParser) next() (token string) {
+	if 0 < len(this.tokens) {
+		token, this.tokens = this.tokens[0], this.tokens[1:]
+	}
+	return
+}
+
+func (this *libraryParser) peek() (token string) {
+	if 0 < len(this.tokens) {
+		token = this.tokens[0]
+	}
+	return
+}
+
+func (this *libraryParser) parseOr() (pred libraryPredicate, err error) {
+	if pred, err = this.parseAnd(); nil != err {
+		return
+	}
+	for strings.EqualFold("or", this.peek()) {
+		this.next()
+		var rhs libraryPredicate
+		if rhs, err = this.parseAnd(); nil != err {
+			return
+		}
+		lhs := pred
+		pred = func(obj *Object) bool { return lhs(obj) || rhs(obj) }
+	}
+	return
+}
+
+func (this *libraryParser) parseAnd() (pred libraryPredicate, err error) {
+	if pred, err = this.parseRel(); nil != err {
+		return
+	}
+	for strings.EqualFold("and", this.peek()) {
+		this.next()
+		var rhs libraryPredicate
+		if rhs, err = this.parseRel(); nil != err {
+			return
+		}
+		lhs := pred
+		pred = func(obj *Object) bool { return lhs(obj) && rhs(obj) }
+	}
+	return
+}
+
+func (this *libraryParser) parseRel() (pred libraryPredicate, err error) {
+	if "(" == this.peek() {
+		this.next()
+		if pred, err = this.parseOr(); nil != err {
+			return
+		} else if ")" != this.next() {
+			return nil, errors.New("Missing ) in search criteria")
+		}
+		return
+	}
+	property, op, operand := this.next(), this.next(), this.next()
+	if "" == property || "" == op || "" == operand {
+		return nil, errors.New("Incomplete search criteria")
+	}
+	if "exists" == op {
+		want := "true" == strings.ToLower(operand)
+		return func(obj *Object) bool {
+			_, has := libraryProperty(obj, property)
+			return has == want
+		}, nil
+	}
+	if !strings.HasPrefix(operand, "\"") {
+		return nil, errors.New(fmt.Sprintf("Expected a quoted string after %s %s", property, op))
+	}
+	operand = strings.ToLower(operand[1:])
+	var test func(value string) bool
+	switch op {
+	case "=":
+		test = func(value string) bool { return value == operand }
+	case "!=":
+		test = func(value string) bool { return value != operand }
+	case "<":
+		test = func(value string) bool { return value < operand }
+	case "<=":
+		test = func(value string) bool { return value <= operand }
+	case ">":
+		test = func(value string) bool { return value > operand }
+	case ">=":
+		test = func(value string) bool { return value >= operand }
+	case "contains":
+		test = func(value string) bool { return strings.Contains(value, operand) }
+	case "doesNotContain":
+		test = func(value string) bool { return !strings.Contains(value, operand) }
+	case "startsWith":
+		test = func(value string) bool { return strings.HasPrefix(value, operand) }
+	case "derivedfrom":
+		test = func(value string) bool { return value == operand || strings.HasPrefix(value, operand+".") }
+	default:
+		return nil, errors.New(fmt.Sprintf("Unsupported search operator %s", op))
+	}
+	return func(obj *Object) bool {
+		value, has := libraryProperty(obj, property)
+		return has && test(strings.ToLower(value))
+	}, nil
+}
+
+// Compiles UPnP ContentDirectory search criteria (section 2.5.5)
+func libraryParseCriteria(criteria string) (pred libraryPredicate, err error) {
+	if "*" == strings.TrimSpace(criteria) || "" == strings.TrimSpace(criteria) {
+		return func(*Object) bool { return true }, nil
+	}
+	parser := &libraryParser{}
+	if parser.tokens, err = libraryTokenize(criteria); nil != err {
+		return
+	}
+	if pred, err = parser.parseOr(); nil != err {
+		return
+	} else if 0 < len(parser.tokens) {
+		return nil, errors.New(fmt.Sprintf("Unexpected %s in search criteria", parser.peek()))
+	}
+	return
+}
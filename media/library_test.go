@@ -0,0 +1,101 @@
+//
+// go-sonos
+// ========
+//
+// Copyright (c) 2012, Ian T. Richards <ianr@panix.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//   * Redistributions of source code must retain the above copyright notice,
+//     this list of conditions and the following disclaimer.
+//   * Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+// TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package media
+
+import (
+	"testing"
+)
+
+func TestParseCriteria(t *testing.T) {
+	track := &Object{ID: "T:1", ParentID: "AL:1", Title: "So What", Class: "object.item.audioItem.musicTrack",
+		Artist: "Miles Davis", Album: "Kind of Blue", Genre: "Jazz", Year: "1959", Track: 1, Item: &Item{}}
+	album := &Object{ID: "AL:1", ParentID: "AL", Title: "Kind of Blue", Class: "object.container.album.musicAlbum",
+		Artist: "Miles Davis"}
+	tests := []struct {
+		criteria string
+		track    bool
+		album    bool
+		ok       bool
+	}{
+		{"", true, true, true},
+		{" * ", true, true, true},
+		{`dc:title = "so what"`, true, false, true},
+		{`dc:title = "So What"`, true, false, true},
+		{`dc:title != "So What"`, false, true, true},
+		{`dc:title contains "WHAT"`, true, false, true},
+		{`dc:title doesNotContain "what"`, false, true, true},
+		{`dc:title startsWith "kind"`, false, true, true},
+		{`dc:date >= "1959" and dc:date < "1960"`, true, false, true},
+		{`dc:date <= "1958" or dc:date > "1959"`, false, false, true},
+		{`upnp:class derivedfrom "object.item"`, true, false, true},
+		{`upnp:class derivedfrom "object.container.album"`, false, true, true},
+		{`upnp:class derivedfrom "object.it"`, false, false, true},
+		{`upnp:album exists true`, true, false, true},
+		{`upnp:album exists false`, false, true, true},
+		{`upnp:originalTrackNumber = "1"`, true, false, true},
+		{`upnp:artist = "Miles Davis" AND upnp:class = "object.container.album.musicAlbum"`, false, true, true},
+		{`dc:title = "x" or dc:title = "y" and @id = "T:1"`, false, false, true},
+		{`(dc:title = "x" or dc:title = "so what") and @id = "T:1"`, true, false, true},
+		{`@parentID = "AL:1"`, true, false, true},
+		{`dc:title = "say \"what\""`, false, false, true},
+		{`upnp:unknown exists false`, true, true, true},
+		{`dc:title =`, false, false, false},
+		{`dc:title = so`, false, false, false},
+		{`dc:title = "so`, false, false, false},
+		{`dc:title like "so"`, false, false, false},
+		{`(dc:title = "so what"`, false, false, false},
+		{`dc:title = "so what")`, false, false, false},
+		{`dc:title = "so what" and`, false, false, false},
+	}
+	for _, test := range tests {
+		match, err := libraryParseCriteria(test.criteria)
+		if test.ok != (nil == err) {
+			t.Errorf("%s: error %v", test.criteria, err)
+		} else if test.ok && (test.track != match(track) || test.album != match(album)) {
+			t.Errorf("%s: matches track %v, album %v", test.criteria, match(track), match(album))
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tokens, err := libraryTokenize(`(dc:title contains "a \"b\" (c)")and@id="x"`)
+	if nil != err {
+		t.Fatal(err)
+	}
+	expected := []string{"(", "dc:title", "contains", `"a "b" (c)`, ")", "and@id=", `"x`}
+	if len(expected) != len(tokens) {
+		t.Fatalf("Tokens %q", tokens)
+	}
+	for i := range tokens {
+		if expected[i] != tokens[i] {
+			t.Errorf("Token %d is %q, expected %q", i, tokens[i], expected[i])
+		}
+	}
+}
@@ -0,0 +1,324 @@
+//
+// go-sonos
+// ========
+//
+// Copyright (c) 2012, Ian T. Richards <ianr@panix.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//   * Redistributions of source code must retain the above copyright notice,
+//     this list of conditions and the following disclaimer.
+//   * Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+// TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+//
+// An HTTP server for playing local files and generated audio on UPnP
+// renderers.
+//
+//	srv, err := media.MakeServer(ssdp.AllInterfaces, "0")
+//	chime := srv.AddBytes("chime.mp3", "", data)
+//	uri := srv.URIFor(chime, speakerIP)
+//	s.SetAVTransportURI(0, uri, srv.MetadataFor(chime, speakerIP))
+//
+// Each item is served with its Content-Type and with support for HEAD
+// and Range requests, which renderers use to probe and seek.
+//
+// A MediaServer builds on the Server to publish a whole directory of
+// music as a UPnP MediaServer that players can browse and search.
+//
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/ianr0bkny/go-sonos/didl"
+	"github.com/ianr0bkny/go-sonos/ssdp"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The path under which items are served
+const mediaPrefix = "/media/"
+
+// Content types for audio formats not known to every system MIME table
+var mediaTypes = map[string]string{
+	".aac":  "audio/aac",
+	".aif":  "audio/aiff",
+	".aiff": "audio/aiff",
+	".flac": "audio/flac",
+	".m4a":  "audio/mp4",
+	".mp3":  "audio/mpeg",
+	".ogg":  "audio/ogg",
+	".wav":  "audio/wav",
+	".wma":  "audio/x-ms-wma",
+}
+
+// Returns the content type for a file named @name
+func ContentType(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ctype, has := mediaTypes[ext]; has {
+		return ctype
+	} else if ctype := mime.TypeByExtension(ext); "" != ctype {
+		return ctype
+	}
+	return "application/octet-stream"
+}
+
+// An item made available by a Server
+type Item struct {
+	// Unique within the server
+	ID string
+	// The file name the item is served as
+	Name string
+	// The title given in the item's metadata
+	Title       string
+	ContentType string
+	Size        int64
+	// Set for items backed by a file
+	Path    string
+	data    []byte
+	modTime time.Time
+}
+
+// The UPnP protocolInfo for the item's <res> element
+func (this *Item) ProtocolInfo() string {
+	return fmt.Sprintf("http-get:*:%s:*", this.ContentType)
+}
+
+// Serves files and byte slices over HTTP
+type Server struct {
+	ifis      []net.Interface
+	port      string
+	listeners []net.Listener
+	server    *http.Server
+	mux       *http.ServeMux
+	items     map[string]*Item
+	nextID    int
+	lock      sync.RWMutex
+}
+
+//
+// Start serving on @port (or any free port, if "0") on the addresses of
+// the devices named by @ifiname, which is interpreted as for
+// ssdp.Interfaces().
+//
+func MakeServer(ifiname, port string) (this *Server, err error) {
+	this = &Server{items: make(map[string]*Item), mux: http.NewServeMux()}
+	if this.ifis, err = ssdp.Interfaces(ifiname); nil != err {
+		return nil, err
+	}
+	this.mux.HandleFunc(mediaPrefix, this.serveItem)
+	this.server = &http.Server{Handler: this.mux}
+	for _, ifi := range this.ifis {
+		for _, family := range []string{ssdp.Family_IPv4, ssdp.Family_IPv6} {
+			addr, aerr := ssdp.InterfaceAddrFamily(&ifi, family)
+			if nil != aerr {
+				continue
+			}
+			host := addr.IP.String()
+			if "" != addr.Zone {
+				host += "%" + addr.Zone
+			}
+			var listener net.Listener
+			if listener, err = net.Listen("tcp", net.JoinHostPort(host, port)); nil != err {
+				this.Close()
+				return nil, err
+			}
+			if "0" == port || "" == port {
+				_, port, _ = net.SplitHostPort(listener.Addr().String())
+			}
+			this.listeners = append(this.listeners, listener)
+			go this.server.Serve(listener)
+		}
+	}
+	if 0 == len(this.listeners) {
+		return nil, errors.New("No address to serve media on")
+	}
+	this.port = port
+	return
+}
+
+// The port the server listens on
+func (this *Server) Port() string {
+	return this.port
+}
+
+func (this *Server) add(item *Item) *Item {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.nextID += 1
+	item.ID = strconv.Itoa(this.nextID)
+	if "" == item.ContentType {
+		item.ContentType = ContentType(item.Name)
+	}
+	if "" == item.Title {
+		item.Title = strings.TrimSuffix(item.Name, filepath.Ext(item.Name))
+	}
+	this.items[item.ID] = item
+	return item
+}
+
+// Serve the file at @filename, reading it afresh for each request
+func (this *Server) AddFile(filename string) (item *Item, err error) {
+	var info os.FileInfo
+	if info, err = os.Stat(filename); nil != err {
+		return
+	} else if info.IsDir() {
+		return nil, errors.New(fmt.Sprintf("%s is a directory", filename))
+	}
+	item = this.add(&Item{
+		Name: filepath.Base(filename),
+		Size: info.Size(),
+		Path: filename,
+	})
+	return
+}
+
+//
+// Serve @data as a file named @name, with the content type guessed from
+// the name when @contentType is empty.
+//
+func (this *Server) AddBytes(name, contentType string, data []byte) *Item {
+	return this.add(&Item{
+		Name:        name,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		data:        data,
+		modTime:     time.Now(),
+	})
+}
+
+// Stop serving @item
+func (this *Server) Remove(item *Item) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	delete(this.items, item.ID)
+}
+
+//
+// Returns the http URI from which a renderer at @remote can fetch @item,
+// using the local address from which @remote is reachable.  A nil
+// @remote selects any served address, preferring IPv4.
+//
+func (this *Server) URIFor(item *Item, remote net.IP) string {
+	local, err := ssdp.LocalAddrFor(this.ifis, remote)
+	host := "localhost"
+	if nil == err {
+		host = local.String()
+	}
+	u := url.URL{
+		Scheme: "http",
+		Host:   net.JoinHostPort(host, this.port),
+		Path:   mediaPrefix + item.ID + "/" + item.Name,
+	}
+	return u.String()
+}
+
+//
+// Returns the x-file-cifs URI for @relpath on the SMB share @share of
+// @host, for files that are already in a share the players index and so
+// need not be served over HTTP.
+//
+func ShareURI(host, share, relpath string) string {
+	u := url.URL{
+		Scheme: "x-file-cifs",
+		Host:   host,
+		Path:   "/" + path.Join(share, filepath.ToSlash(relpath)),
+	}
+	return u.String()
+}
+
+//
+// Returns a DIDL-Lite document describing @item as a music track, for
+// use as the metadata argument of SetAVTransportURI or AddURIToQueue.
+//
+func (this *Server) MetadataFor(item *Item, remote net.IP) string {
+	track := didl.MusicTrack(item.ID, "-1", item.Title, this.URIFor(item, remote), item.ProtocolInfo())
+	track.Res[0].Size = uint64(item.Size)
+	doc, err := didl.MarshalItem(&track)
+	if nil != err {
+		return didl.EmptyDocument()
+	}
+	return doc
+}
+
+// Serve @handler at @pattern alongside the media, as for http.ServeMux
+func (this *Server) Handle(pattern string, handler http.Handler) {
+	this.mux.Handle(pattern, handler)
+}
+
+func (this *Server) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	this.mux.ServeHTTP(writer, request)
+}
+
+func (this *Server) serveItem(writer http.ResponseWriter, request *http.Request) {
+	if "GET" != request.Method && "HEAD" != request.Method {
+		writer.Header().Set("Allow", "GET, HEAD")
+		http.Error(writer, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	rest := strings.TrimPrefix(path.Clean(request.URL.Path), mediaPrefix)
+	id := strings.SplitN(rest, "/", 2)[0]
+	this.lock.RLock()
+	item, has := this.items[id]
+	this.lock.RUnlock()
+	if !has {
+		http.NotFound(writer, request)
+		return
+	}
+	writer.Header().Set("Content-Type", item.ContentType)
+	writer.Header().Set("transferMode.dlna.org", "Streaming")
+	if nil != item.data {
+		http.ServeContent(writer, request, item.Name, item.modTime, bytes.NewReader(item.data))
+		return
+	}
+	f, err := os.Open(item.Path)
+	if nil != err {
+		http.NotFound(writer, request)
+		return
+	}
+	defer f.Close()
+	var modTime time.Time
+	if info, err := f.Stat(); nil == err {
+		modTime = info.ModTime()
+	}
+	http.ServeContent(writer, request, item.Name, modTime, f)
+}
+
+// Stop serving
+func (this *Server) Close() (err error) {
+	for _, listener := range this.listeners {
+		if cerr := listener.Close(); nil == err {
+			err = cerr
+		}
+	}
+	this.listeners = nil
+	return
+}
@@ -0,0 +1,863 @@
+//
+// go-sonos
+// ========
+//
+// Copyright (c) 2012, Ian T. Richards <ianr@panix.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//   * Redistributions of source code must retain the above copyright notice,
+//     this list of conditions and the following disclaimer.
+//   * Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+// TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package media
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/xml"
+	"fmt"
+	"github.com/ianr0bkny/go-sonos/didl"
+	"github.com/ianr0bkny/go-sonos/ssdp"
+	"github.com/ianr0bkny/go-sonos/upnp"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	MediaServer_DeviceType        = "urn:schemas-upnp-org:device:MediaServer:1"
+	MediaServer_ContentDirectory  = "urn:schemas-upnp-org:service:ContentDirectory:1"
+	MediaServer_ConnectionManager = "urn:schemas-upnp-org:service:ConnectionManager:1"
+)
+
+const (
+	// Where the device description and service endpoints are served
+	mediaDevicePrefix = "/dlna/"
+	// The lifetime granted to event subscriptions
+	mediaSubscriptionTimeout = 1800 * time.Second
+)
+
+// UPnP error codes (UDA 1.1 section 3.2.2, ContentDirectory:1 2.4)
+const (
+	mediaError_InvalidAction        = 401
+	mediaError_InvalidArgs          = 402
+	mediaError_NoSuchObject         = 701
+	mediaError_InvalidConnection    = 706
+	mediaError_BadSearchCriteria    = 708
+	mediaError_CannotProcessRequest = 720
+)
+
+// A failure reported to a control point as a SOAP fault
+type mediaFault struct {
+	code        int
+	description string
+}
+
+func (this *mediaFault) Error() string {
+	return fmt.Sprintf("%d %s", this.code, this.description)
+}
+
+//
+// A UPnP MediaServer that publishes the audio files beneath a directory
+// through ContentDirectory and ConnectionManager services, serving the
+// files themselves from the same HTTP server.
+//
+type MediaServer struct {
+	// The friendly name shown by control points
+	Name string
+	// The device UUID, stable for a given name and directory
+	UUID       ssdp.UUID
+	server     *Server
+	library    *Library
+	updateID   uint32
+	advertiser ssdp.Advertiser
+	subs       map[string]*mediaSubscription
+	lock       sync.RWMutex
+}
+
+// Derives a name-based (version 3) UUID from @name
+func mediaUUID(name string) ssdp.UUID {
+	sum := md5.Sum([]byte(name))
+	sum[6] = sum[6]&0x0f | 0x30
+	sum[8] = sum[8]&0x3f | 0x80
+	return ssdp.UUID(fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16]))
+}
+
+//
+// Indexes the directory @root and serves it as the device @name on @port
+// of the interfaces named by @ifiname (see MakeServer()).  The device is
+// not announced until Advertise() is called.
+//
+func MakeMediaServer(name, root, ifiname, port string) (this *MediaServer, err error) {
+	this = &MediaServer{
+		Name:     name,
+		UUID:     mediaUUID(name + "\x00" + root),
+		updateID: 1,
+		subs:     make(map[string]*mediaSubscription),
+	}
+	if this.server, err = MakeServer(ifiname, port); nil != err {
+		return nil, err
+	}
+	if this.library, err = ScanLibrary(root, this.server); nil != err {
+		this.server.Close()
+		return nil, err
+	}
+	this.server.Handle(mediaDevicePrefix, this)
+	return
+}
+
+// The HTTP server the media is served from
+func (this *MediaServer) Server() *Server {
+	return this.server
+}
+
+// The current index of the directory
+func (this *MediaServer) Library() *Library {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	return this.library
+}
+
+// Re-indexes the directory, notifying subscribed control points
+func (this *MediaServer) Rescan() (err error) {
+	old := this.Library()
+	var library *Library
+	if library, err = ScanLibrary(old.Root, this.server); nil != err {
+		return
+	}
+	this.lock.Lock()
+	this.library = library
+	this.updateID += 1
+	this.lock.Unlock()
+	tracks, _ := old.Children(ObjectID_Tracks)
+	for _, track := range tracks {
+		this.server.Remove(track.Item)
+	}
+	this.notify(MediaServer_ContentDirectory)
+	return
+}
+
+// Announces the device over SSDP on @ifiname
+func (this *MediaServer) Advertise(ifiname string) (err error) {
+	adv := &ssdp.Advertisement{
+		EmbeddedDevice: ssdp.EmbeddedDevice{
+			UUID:       this.UUID,
+			DeviceType: MediaServer_DeviceType,
+			Services:   []string{MediaServer_ContentDirectory, MediaServer_ConnectionManager},
+		},
+		Location: ssdp.Location(fmt.Sprintf("http://:%s%sdescription.xml", this.server.Port(), mediaDevicePrefix)),
+	}
+	advertiser := ssdp.MakeAdvertiser(adv)
+	if err = advertiser.Advertise(ifiname); nil != err {
+		return
+	}
+	this.lock.Lock()
+	this.advertiser = advertiser
+	this.lock.Unlock()
+	return
+}
+
+// Withdraws the SSDP announcement and stops serving
+func (this *MediaServer) Close() (err error) {
+	this.lock.Lock()
+	advertiser := this.advertiser
+	this.advertiser = nil
+	for sid, sub := range this.subs {
+		this.cancel(sid, sub)
+	}
+	this.lock.Unlock()
+	if nil != advertiser {
+		err = advertiser.Close()
+	}
+	if cerr := this.server.Close(); nil == err {
+		err = cerr
+	}
+	return
+}
+
+func (this *MediaServer) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	rest := strings.TrimPrefix(request.URL.Path, mediaDevicePrefix)
+	switch rest {
+	case "description.xml":
+		this.serveXML(writer, this.description())
+	case "ContentDirectory.xml":
+		this.serveXML(writer, mediaContentDirectory.scpd())
+	case "ConnectionManager.xml":
+		this.serveXML(writer, mediaConnectionManager.scpd())
+	case "ContentDirectory/control":
+		this.control(writer, request, &mediaContentDirectory)
+	case "ConnectionManager/control":
+		this.control(writer, request, &mediaConnectionManager)
+	case "ContentDirectory/event":
+		this.subscribe(writer, request, MediaServer_ContentDirectory)
+	case "ConnectionManager/event":
+		this.subscribe(writer, request, MediaServer_ConnectionManager)
+	default:
+		http.NotFound(writer, request)
+	}
+}
+
+func (this *MediaServer) serveXML(writer http.ResponseWriter, doc string) {
+	writer.Header().Set("Content-Type", "text/xml; charset=\"utf-8\"")
+	writer.Write([]byte(xml.Header + doc))
+}
+
+func mediaEscape(s string) string {
+	buf := new(bytes.Buffer)
+	xml.EscapeText(buf, []byte(s))
+	return buf.String()
+}
+
+func (this *MediaServer) description() string {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, `<root xmlns="urn:schemas-upnp-org:device-1-0" xmlns:dlna="urn:schemas-dlna-org:device-1-0">`)
+	fmt.Fprintf(buf, `<specVersion><major>1</major><minor>0</minor></specVersion><device>`)
+	fmt.Fprintf(buf, `<deviceType>%s</deviceType>`, MediaServer_DeviceType)
+	fmt.Fprintf(buf, `<friendlyName>%s</friendlyName>`, mediaEscape(this.Name))
+	fmt.Fprintf(buf, `<manufacturer>go-sonos</manufacturer><modelName>go-sonos Media Server</modelName>`)
+	fmt.Fprintf(buf, `<UDN>uuid:%s</UDN><dlna:X_DLNADOC>DMS-1.50</dlna:X_DLNADOC><serviceList>`, this.UUID)
+	for _, svc := range []*mediaService{&mediaContentDirectory, &mediaConnectionManager} {
+		fmt.Fprintf(buf, `<service><serviceType>%s</serviceType>`, svc.serviceType)
+		fmt.Fprintf(buf, `<serviceId>urn:upnp-org:serviceId:%s</serviceId>`, svc.name)
+		fmt.Fprintf(buf, `<SCPDURL>%s%s.xml</SCPDURL>`, mediaDevicePrefix, svc.name)
+		fmt.Fprintf(buf, `<controlURL>%s%s/control</controlURL>`, mediaDevicePrefix, svc.name)
+		fmt.Fprintf(buf, `<eventSubURL>%s%s/event</eventSubURL></service>`, mediaDevicePrefix, svc.name)
+	}
+	fmt.Fprintf(buf, `</serviceList></device></root>`)
+	return buf.String()
+}
+
+//
+// The SOAP envelope of an action request.  Elements are matched by local
+// name, so any namespace prefixes the control point chooses are accepted.
+//
+type mediaEnvelope_XML struct {
+	Body struct {
+		Action struct {
+			XMLName xml.Name
+			Args    []struct {
+				XMLName xml.Name
+				Value   string `xml:",chardata"`
+			} `xml:",any"`
+		} `xml:",any"`
+	} `xml:"Body"`
+}
+
+func mediaRemoteIP(request *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if nil != err {
+		return nil
+	}
+	if i := strings.Index(host, "%"); 0 <= i {
+		host = host[:i]
+	}
+	return net.ParseIP(host)
+}
+
+func (this *MediaServer) control(writer http.ResponseWriter, request *http.Request, svc *mediaService) {
+	if "POST" != request.Method {
+		http.Error(writer, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(request.Body)
+	if nil != err {
+		return
+	}
+	doc := mediaEnvelope_XML{}
+	if err = xml.Unmarshal(body, &doc); nil != err {
+		this.fault(writer, &mediaFault{mediaError_InvalidAction, "Invalid Action"})
+		return
+	}
+	action := doc.Body.Action.XMLName.Local
+	args := make(map[string]string)
+	for _, arg := range doc.Body.Action.Args {
+		args[arg.XMLName.Local] = arg.Value
+	}
+	handler, has := svc.handlers[action]
+	if !has {
+		this.fault(writer, &mediaFault{mediaError_InvalidAction, "Invalid Action"})
+		return
+	}
+	out, err := handler(this, args, mediaRemoteIP(request))
+	if nil != err {
+		if fault, ok := err.(*mediaFault); ok {
+			this.fault(writer, fault)
+		} else {
+			this.fault(writer, &mediaFault{mediaError_CannotProcessRequest, err.Error()})
+		}
+		return
+	}
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, `%s<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" `, xml.Header)
+	fmt.Fprintf(buf, `s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>`)
+	fmt.Fprintf(buf, `<u:%sResponse xmlns:u="%s">`, action, svc.serviceType)
+	for _, arg := range out {
+		fmt.Fprintf(buf, "<%s>%s</%s>", arg.Key, mediaEscape(fmt.Sprintf("%v", arg.Value)), arg.Key)
+	}
+	fmt.Fprintf(buf, `</u:%sResponse></s:Body></s:Envelope>`, action)
+	writer.Header().Set("Content-Type", "text/xml; charset=\"utf-8\"")
+	writer.Header().Set("EXT", "")
+	writer.Write(buf.Bytes())
+}
+
+func (this *MediaServer) fault(writer http.ResponseWriter, fault *mediaFault) {
+	writer.Header().Set("Content-Type", "text/xml; charset=\"utf-8\"")
+	writer.WriteHeader(http.StatusInternalServerError)
+	fmt.Fprintf(writer, `%s<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" `, xml.Header)
+	fmt.Fprintf(writer, `s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body><s:Fault>`)
+	fmt.Fprintf(writer, `<faultcode>s:Client</faultcode><faultstring>UPnPError</faultstring><detail>`)
+	fmt.Fprintf(writer, `<UPnPError xmlns="urn:schemas-upnp-org:control-1-0"><errorCode>%d</errorCode>`, fault.code)
+	fmt.Fprintf(writer, `<errorDescription>%s</errorDescription></UPnPError>`, mediaEscape(fault.description))
+	fmt.Fprintf(writer, `</detail></s:Fault></s:Body></s:Envelope>`)
+}
+
+// Returns the unsigned argument @name, which may be absent
+func mediaUint(args map[string]string, name string) (n int, err error) {
+	value := strings.TrimSpace(args[name])
+	if "" == value {
+		return 0, nil
+	}
+	var u uint64
+	if u, err = strconv.ParseUint(value, 10, 32); nil != err {
+		return 0, &mediaFault{mediaError_InvalidArgs, "Invalid " + name}
+	}
+	return int(u), nil
+}
+
+// Returns the page of @objs requested by StartingIndex and RequestedCount
+func mediaPage(objs []*Object, args map[string]string) (page []*Object, err error) {
+	var start, count int
+	if start, err = mediaUint(args, "StartingIndex"); nil != err {
+		return
+	} else if count, err = mediaUint(args, "RequestedCount"); nil != err {
+		return
+	}
+	if start >= len(objs) {
+		return nil, nil
+	}
+	page = objs[start:]
+	if 0 < count && count < len(page) {
+		page = page[:count]
+	}
+	return
+}
+
+// Formats @d as a <res> duration, H+:MM:SS.FFF
+func mediaDuration(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+//
+// Renders @objs as a DIDL-Lite document, giving each track the URI from
+// which a renderer at @remote can fetch it.
+//
+func (this *MediaServer) didl(objs []*Object, remote net.IP) string {
+	var containers []didl.Container
+	var items []didl.Item
+	for _, obj := range objs {
+		var creator []didl.Creator
+		var artist []didl.Artist
+		var genre []didl.Genre
+		var date []didl.Date
+		if "" != obj.Artist {
+			creator = []didl.Creator{{Value: obj.Artist}}
+			artist = []didl.Artist{{Value: obj.Artist}}
+		}
+		if "" != obj.Genre {
+			genre = []didl.Genre{{Value: obj.Genre}}
+		}
+		if "" != obj.Year {
+			date = []didl.Date{{Value: obj.Year}}
+		}
+		if obj.IsContainer() {
+			containers = append(containers, didl.Container{
+				ID:         obj.ID,
+				ParentID:   obj.ParentID,
+				Restricted: true,
+				ChildCount: obj.ChildCount(),
+				Searchable: true,
+				Title:      []didl.Title{{Value: obj.Title}},
+				Class:      []didl.Class{{Value: obj.Class}},
+				Creator:    creator,
+				Artist:     artist,
+				Genre:      genre,
+				Date:       date,
+			})
+			continue
+		}
+		item := didl.MusicTrack(obj.ID, obj.ParentID, obj.Title,
+			this.server.URIFor(obj.Item, remote), obj.Item.ProtocolInfo())
+		item.Res[0].Size = uint64(obj.Item.Size)
+		if 0 < obj.Duration {
+			item.Res[0].Duration = mediaDuration(obj.Duration)
+		}
+		item.Creator, item.Artist, item.Genre, item.Date = creator, artist, genre, date
+		if "" != obj.Album {
+			item.Album = []didl.Album{{Value: obj.Album}}
+		}
+		if 0 < obj.Track {
+			item.OriginalTrackNumber = []didl.OriginalTrackNumber{{Value: strconv.Itoa(obj.Track)}}
+		}
+		items = append(items, item)
+	}
+	doc, err := didl.Marshal(containers, items)
+	if nil != err {
+		log.Printf("Could not encode DIDL-Lite: %v", err)
+		return didl.EmptyDocument()
+	}
+	return doc
+}
+
+func mediaBrowse(this *MediaServer, args map[string]string, remote net.IP) (out upnp.Args, err error) {
+	library, updateID := this.state()
+	obj, has := library.Object(args["ObjectID"])
+	if !has {
+		return nil, &mediaFault{mediaError_NoSuchObject, "No such object"}
+	}
+	var objs []*Object
+	var total int
+	switch args["BrowseFlag"] {
+	case "BrowseMetadata":
+		objs, total = []*Object{obj}, 1
+	case "BrowseDirectChildren":
+		children, _ := library.Children(obj.ID)
+		if objs, err = mediaPage(children, args); nil != err {
+			return
+		}
+		total = len(children)
+	default:
+		return nil, &mediaFault{mediaError_InvalidArgs, "Invalid BrowseFlag"}
+	}
+	return upnp.Args{
+		{Key: "Result", Value: this.didl(objs, remote)},
+		{Key: "NumberReturned", Value: len(objs)},
+		{Key: "TotalMatches", Value: total},
+		{Key: "UpdateID", Value: updateID},
+	}, nil
+}
+
+func mediaSearch(this *MediaServer, args map[string]string, remote net.IP) (out upnp.Args, err error) {
+	library, updateID := this.state()
+	if _, has := library.Object(args["ContainerID"]); !has {
+		return nil, &mediaFault{mediaError_NoSuchObject, "No such container"}
+	}
+	matches, serr := library.Search(args["ContainerID"], args["SearchCriteria"])
+	if nil != serr {
+		return nil, &mediaFault{mediaError_BadSearchCriteria, serr.Error()}
+	}
+	var objs []*Object
+	if objs, err = mediaPage(matches, args); nil != err {
+		return
+	}
+	return upnp.Args{
+		{Key: "Result", Value: this.didl(objs, remote)},
+		{Key: "NumberReturned", Value: len(objs)},
+		{Key: "TotalMatches", Value: len(matches)},
+		{Key: "UpdateID", Value: updateID},
+	}, nil
+}
+
+func (this *MediaServer) state() (*Library, uint32) {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	return this.library, this.updateID
+}
+
+// The properties searches may test
+const mediaSearchCapabilities = "@id,@parentID,dc:title,dc:creator,dc:date,upnp:class," +
+	"upnp:artist,upnp:album,upnp:genre,upnp:originalTrackNumber"
+
+// The protocolInfo of every content type the server may offer
+func mediaSourceProtocolInfo() string {
+	seen := make(map[string]bool)
+	var infos []string
+	for _, ctype := range mediaTypes {
+		info := fmt.Sprintf("http-get:*:%s:*", ctype)
+		if !seen[info] {
+			seen[info] = true
+			infos = append(infos, info)
+		}
+	}
+	sort.Strings(infos)
+	return strings.Join(infos, ",")
+}
+
+// A handler for one action of a service
+type mediaHandler func(this *MediaServer, args map[string]string, remote net.IP) (upnp.Args, error)
+
+type mediaArgument struct {
+	name      string
+	direction string
+	variable  string
+}
+
+type mediaAction struct {
+	name string
+	args []mediaArgument
+}
+
+type mediaVariable struct {
+	name     string
+	dataType string
+	evented  bool
+	values   []string
+}
+
+// A service implemented by the MediaServer, and its description
+type mediaService struct {
+	name        string
+	serviceType string
+	actions     []mediaAction
+	variables   []mediaVariable
+	handlers    map[string]mediaHandler
+}
+
+// Renders the service control protocol description (SCPD)
+func (this *mediaService) scpd() string {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, `<scpd xmlns="urn:schemas-upnp-org:service-1-0">`)
+	fmt.Fprintf(buf, `<specVersion><major>1</major><minor>0</minor></specVersion><actionList>`)
+	for _, action := range this.actions {
+		fmt.Fprintf(buf, `<action><name>%s</name><argumentList>`, action.name)
+		for _, arg := range action.args {
+			fmt.Fprintf(buf, `<argument><name>%s</name><direction>%s</direction>`, arg.name, arg.direction)
+			fmt.Fprintf(buf, `<relatedStateVariable>%s</relatedStateVariable></argument>`, arg.variable)
+		}
+		fmt.Fprintf(buf, `</argumentList></action>`)
+	}
+	fmt.Fprintf(buf, `</actionList><serviceStateTable>`)
+	for _, v := range this.variables {
+		events := "no"
+		if v.evented {
+			events = "yes"
+		}
+		fmt.Fprintf(buf, `<stateVariable sendEvents="%s"><name>%s</name>`, events, v.name)
+		fmt.Fprintf(buf, `<dataType>%s</dataType>`, v.dataType)
+		if 0 < len(v.values) {
+			fmt.Fprintf(buf, `<allowedValueList>`)
+			for _, value := range v.values {
+				fmt.Fprintf(buf, `<allowedValue>%s</allowedValue>`, value)
+			}
+			fmt.Fprintf(buf, `</allowedValueList>`)
+		}
+		fmt.Fprintf(buf, `</stateVariable>`)
+	}
+	fmt.Fprintf(buf, `</serviceStateTable></scpd>`)
+	return buf.String()
+}
+
+var mediaContentDirectory = mediaService{
+	name:        "ContentDirectory",
+	serviceType: MediaServer_ContentDirectory,
+	actions: []mediaAction{
+		{"GetSearchCapabilities", []mediaArgument{{"SearchCaps", "out", "SearchCapabilities"}}},
+		{"GetSortCapabilities", []mediaArgument{{"SortCaps", "out", "SortCapabilities"}}},
+		{"GetSystemUpdateID", []mediaArgument{{"Id", "out", "SystemUpdateID"}}},
+		{"Browse", []mediaArgument{
+			{"ObjectID", "in", "A_ARG_TYPE_ObjectID"},
+			{"BrowseFlag", "in", "A_ARG_TYPE_BrowseFlag"},
+			{"Filter", "in", "A_ARG_TYPE_Filter"},
+			{"StartingIndex", "in", "A_ARG_TYPE_Index"},
+			{"RequestedCount", "in", "A_ARG_TYPE_Count"},
+			{"SortCriteria", "in", "A_ARG_TYPE_SortCriteria"},
+			{"Result", "out", "A_ARG_TYPE_Result"},
+			{"NumberReturned", "out", "A_ARG_TYPE_Count"},
+			{"TotalMatches", "out", "A_ARG_TYPE_Count"},
+			{"UpdateID", "out", "A_ARG_TYPE_UpdateID"},
+		}},
+		{"Search", []mediaArgument{
+			{"ContainerID", "in", "A_ARG_TYPE_ObjectID"},
+			{"SearchCriteria", "in", "A_ARG_TYPE_SearchCriteria"},
+			{"Filter", "in", "A_ARG_TYPE_Filter"},
+			{"StartingIndex", "in", "A_ARG_TYPE_Index"},
+			{"RequestedCount", "in", "A_ARG_TYPE_Count"},
+			{"SortCriteria", "in", "A_ARG_TYPE_SortCriteria"},
+			{"Result", "out", "A_ARG_TYPE_Result"},
+			{"NumberReturned", "out", "A_ARG_TYPE_Count"},
+			{"TotalMatches", "out", "A_ARG_TYPE_Count"},
+			{"UpdateID", "out", "A_ARG_TYPE_UpdateID"},
+		}},
+	},
+	variables: []mediaVariable{
+		{"SearchCapabilities", "string", false, nil},
+		{"SortCapabilities", "string", false, nil},
+		{"SystemUpdateID", "ui4", true, nil},
+		{"A_ARG_TYPE_ObjectID", "string", false, nil},
+		{"A_ARG_TYPE_Result", "string", false, nil},
+		{"A_ARG_TYPE_SearchCriteria", "string", false, nil},
+		{"A_ARG_TYPE_BrowseFlag", "string", false, []string{"BrowseMetadata", "BrowseDirectChildren"}},
+		{"A_ARG_TYPE_Filter", "string", false, nil},
+		{"A_ARG_TYPE_SortCriteria", "string", false, nil},
+		{"A_ARG_TYPE_Index", "ui4", false, nil},
+		{"A_ARG_TYPE_Count", "ui4", false, nil},
+		{"A_ARG_TYPE_UpdateID", "ui4", false, nil},
+	},
+	handlers: map[string]mediaHandler{
+		"GetSearchCapabilities": func(*MediaServer, map[string]string, net.IP) (upnp.Args, error) {
+			return upnp.Args{{Key: "SearchCaps", Value: mediaSearchCapabilities}}, nil
+		},
+		"GetSortCapabilities": func(*MediaServer, map[string]string, net.IP) (upnp.Args, error) {
+			return upnp.Args{{Key: "SortCaps", Value: ""}}, nil
+		},
+		"GetSystemUpdateID": func(this *MediaServer, _ map[string]string, _ net.IP) (upnp.Args, error) {
+			_, updateID := this.state()
+			return upnp.Args{{Key: "Id", Value: updateID}}, nil
+		},
+		"Browse": mediaBrowse,
+		"Search": mediaSearch,
+	},
+}
+
+var mediaConnectionManager = mediaService{
+	name:        "ConnectionManager",
+	serviceType: MediaServer_ConnectionManager,
+	actions: []mediaAction{
+		{"GetProtocolInfo", []mediaArgument{
+			{"Source", "out", "SourceProtocolInfo"},
+			{"Sink", "out", "SinkProtocolInfo"},
+		}},
+		{"GetCurrentConnectionIDs", []mediaArgument{{"ConnectionIDs", "out", "CurrentConnectionIDs"}}},
+		{"GetCurrentConnectionInfo", []mediaArgument{
+			{"ConnectionID", "in", "A_ARG_TYPE_ConnectionID"},
+			{"RcsID", "out", "A_ARG_TYPE_RcsID"},
+			{"AVTransportID", "out", "A_ARG_TYPE_AVTransportID"},
+			{"ProtocolInfo", "out", "A_ARG_TYPE_ProtocolInfo"},
+			{"PeerConnectionManager", "out", "A_ARG_TYPE_ConnectionManager"},
+			{"PeerConnectionID", "out", "A_ARG_TYPE_ConnectionID"},
+			{"Direction", "out", "A_ARG_TYPE_Direction"},
+			{"Status", "out", "A_ARG_TYPE_ConnectionStatus"},
+		}},
+	},
+	variables: []mediaVariable{
+		{"SourceProtocolInfo", "string", true, nil},
+		{"SinkProtocolInfo", "string", true, nil},
+		{"CurrentConnectionIDs", "string", true, nil},
+		{"A_ARG_TYPE_ConnectionStatus", "string", false,
+			[]string{"OK", "ContentFormatMismatch", "InsufficientBandwidth", "UnreliableChannel", "Unknown"}},
+		{"A_ARG_TYPE_ConnectionManager", "string", false, nil},
+		{"A_ARG_TYPE_Direction", "string", false, []string{"Input", "Output"}},
+		{"A_ARG_TYPE_ProtocolInfo", "string", false, nil},
+		{"A_ARG_TYPE_ConnectionID", "i4", false, nil},
+		{"A_ARG_TYPE_AVTransportID", "i4", false, nil},
+		{"A_ARG_TYPE_RcsID", "i4", false, nil},
+	},
+	handlers: map[string]mediaHandler{
+		"GetProtocolInfo": func(*MediaServer, map[string]string, net.IP) (upnp.Args, error) {
+			return upnp.Args{{Key: "Source", Value: mediaSourceProtocolInfo()}, {Key: "Sink", Value: ""}}, nil
+		},
+		"GetCurrentConnectionIDs": func(*MediaServer, map[string]string, net.IP) (upnp.Args, error) {
+			return upnp.Args{{Key: "ConnectionIDs", Value: "0"}}, nil
+		},
+		"GetCurrentConnectionInfo": func(_ *MediaServer, args map[string]string, _ net.IP) (upnp.Args, error) {
+			if "0" != strings.TrimSpace(args["ConnectionID"]) {
+				return nil, &mediaFault{mediaError_InvalidConnection, "Invalid connection reference"}
+			}
+			return upnp.Args{
+				{Key: "RcsID", Value: -1},
+				{Key: "AVTransportID", Value: -1},
+				{Key: "ProtocolInfo", Value: ""},
+				{Key: "PeerConnectionManager", Value: ""},
+				{Key: "PeerConnectionID", Value: -1},
+				{Key: "Direction", Value: "Output"},
+				{Key: "Status", Value: "OK"},
+			}, nil
+		},
+	},
+}
+
+//
+// A control point's subscription to the events of one service.  Events
+// are queued on pending and sent one at a time, in order, by the
+// subscription's deliver() goroutine, so that SEQ numbers reach the
+// control point in the order they count.
+//
+type mediaSubscription struct {
+	service   string
+	callbacks []string
+	seq       uint32
+	expires   time.Time
+	pending   []upnp.Args
+	wake      chan int
+	done      chan int
+}
+
+// Returns the evented variables of @service and their current values
+func (this *MediaServer) properties(service string) upnp.Args {
+	if MediaServer_ContentDirectory == service {
+		_, updateID := this.state()
+		return upnp.Args{{Key: "SystemUpdateID", Value: updateID}}
+	}
+	return upnp.Args{
+		{Key: "SourceProtocolInfo", Value: mediaSourceProtocolInfo()},
+		{Key: "SinkProtocolInfo", Value: ""},
+		{Key: "CurrentConnectionIDs", Value: "0"},
+	}
+}
+
+// Handles GENA SUBSCRIBE and UNSUBSCRIBE requests
+func (this *MediaServer) subscribe(writer http.ResponseWriter, request *http.Request, service string) {
+	sid := request.Header.Get("SID")
+	switch request.Method {
+	case "SUBSCRIBE":
+		initial := this.properties(service)
+		this.lock.Lock()
+		var sub *mediaSubscription
+		if "" != sid {
+			if sub = this.subs[sid]; nil == sub {
+				this.lock.Unlock()
+				http.Error(writer, "Precondition Failed", http.StatusPreconditionFailed)
+				return
+			}
+		} else {
+			var callbacks []string
+			for _, part := range strings.Split(request.Header.Get("CALLBACK"), ">") {
+				if i := strings.Index(part, "<"); 0 <= i {
+					callbacks = append(callbacks, part[i+1:])
+				}
+			}
+			if 0 == len(callbacks) || "upnp:event" != request.Header.Get("NT") {
+				this.lock.Unlock()
+				http.Error(writer, "Precondition Failed", http.StatusPreconditionFailed)
+				return
+			}
+			sid = fmt.Sprintf("uuid:%s", mediaUUID(fmt.Sprintf("%s %v %s", this.UUID, time.Now().UnixNano(), callbacks)))
+			sub = &mediaSubscription{
+				service:   service,
+				callbacks: callbacks,
+				wake:      make(chan int, 1),
+				done:      make(chan int),
+			}
+			this.subs[sid] = sub
+			// The initial event must precede any other
+			this.queue(sub, initial)
+			go this.deliver(sid, sub)
+		}
+		sub.expires = time.Now().Add(mediaSubscriptionTimeout)
+		this.lock.Unlock()
+		writer.Header().Set("SID", sid)
+		writer.Header().Set("TIMEOUT", fmt.Sprintf("Second-%d", int(mediaSubscriptionTimeout.Seconds())))
+		writer.WriteHeader(http.StatusOK)
+	case "UNSUBSCRIBE":
+		this.lock.Lock()
+		sub, has := this.subs[sid]
+		if has {
+			this.cancel(sid, sub)
+		}
+		this.lock.Unlock()
+		if !has {
+			http.Error(writer, "Precondition Failed", http.StatusPreconditionFailed)
+		}
+	default:
+		http.Error(writer, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Sends the current state of @service to each of its subscribers
+func (this *MediaServer) notify(service string) {
+	props := this.properties(service)
+	now := time.Now()
+	this.lock.Lock()
+	for sid, sub := range this.subs {
+		if now.After(sub.expires) {
+			this.cancel(sid, sub)
+		} else if service == sub.service {
+			this.queue(sub, props)
+		}
+	}
+	this.lock.Unlock()
+}
+
+// Queues @props for @sub; the caller holds the lock
+func (this *MediaServer) queue(sub *mediaSubscription, props upnp.Args) {
+	sub.pending = append(sub.pending, props)
+	select {
+	case sub.wake <- 1:
+	default:
+	}
+}
+
+// Ends @sub, dropping any events not yet sent; the caller holds the lock
+func (this *MediaServer) cancel(sid string, sub *mediaSubscription) {
+	delete(this.subs, sid)
+	close(sub.done)
+}
+
+// Sends the events queued for @sub in order until it is cancelled
+func (this *MediaServer) deliver(sid string, sub *mediaSubscription) {
+	for {
+		select {
+		case <-sub.wake:
+		case <-sub.done:
+			return
+		}
+		this.lock.Lock()
+		pending := sub.pending
+		sub.pending = nil
+		this.lock.Unlock()
+		for _, props := range pending {
+			select {
+			case <-sub.done:
+				return
+			default:
+			}
+			this.send(sid, sub, props)
+		}
+	}
+}
+
+// Delivers a NOTIFY to the first callback of @sub that accepts it
+func (this *MediaServer) send(sid string, sub *mediaSubscription, props upnp.Args) {
+	this.lock.Lock()
+	seq := sub.seq
+	sub.seq += 1
+	this.lock.Unlock()
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, `%s<e:propertyset xmlns:e="urn:schemas-upnp-org:event-1-0">`, xml.Header)
+	for _, prop := range props {
+		fmt.Fprintf(buf, "<e:property><%s>%s</%s></e:property>", prop.Key, mediaEscape(fmt.Sprintf("%v", prop.Value)), prop.Key)
+	}
+	fmt.Fprintf(buf, "</e:propertyset>")
+	client := &http.Client{Timeout: 10 * time.Second}
+	for _, callback := range sub.callbacks {
+		req, err := http.NewRequest("NOTIFY", callback, bytes.NewReader(buf.Bytes()))
+		if nil != err {
+			continue
+		}
+		req.Header.Set("CONTENT-TYPE", "text/xml; charset=\"utf-8\"")
+		req.Header.Set("NT", "upnp:event")
+		req.Header.Set("NTS", "upnp:propchange")
+		req.Header.Set("SID", sid)
+		req.Header.Set("SEQ", strconv.FormatUint(uint64(seq), 10))
+		if resp, err := client.Do(req); nil == err {
+			resp.Body.Close()
+			return
+		}
+	}
+	log.Printf("Could not deliver event %d to %s", seq, sid)
+}
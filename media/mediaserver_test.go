@@ -0,0 +1,111 @@
+//
+// go-sonos
+// ========
+//
+// Copyright (c) 2012, Ian T. Richards <ianr@panix.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//   * Redistributions of source code must retain the above copyright notice,
+//     this list of conditions and the following disclaimer.
+//   * Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+// TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package media
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testUpdateID = regexp.MustCompile(`<SystemUpdateID>(\d+)</SystemUpdateID>`)
+
+func TestEventOrder(t *testing.T) {
+	var lock sync.Mutex
+	var received []string
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		m := testUpdateID.FindSubmatch(body)
+		if nil == m {
+			t.Errorf("Event without SystemUpdateID: %s", body)
+			return
+		}
+		lock.Lock()
+		received = append(received, fmt.Sprintf("%s:%s", r.Header.Get("SEQ"), m[1]))
+		first := 1 == len(received)
+		lock.Unlock()
+		if first {
+			// Give later events the chance to overtake
+			time.Sleep(50 * time.Millisecond)
+		}
+	}))
+	defer callback.Close()
+
+	this := &MediaServer{updateID: 1, subs: make(map[string]*mediaSubscription)}
+	request := httptest.NewRequest("SUBSCRIBE", "/", nil)
+	request.Header.Set("CALLBACK", "<"+callback.URL+"/event>")
+	request.Header.Set("NT", "upnp:event")
+	recorder := httptest.NewRecorder()
+	this.subscribe(recorder, request, MediaServer_ContentDirectory)
+	sid := recorder.Header().Get("SID")
+	if http.StatusOK != recorder.Code || "" == sid {
+		t.Fatalf("SUBSCRIBE returned %d, SID %q", recorder.Code, sid)
+	}
+	for i := 0; i < 4; i++ {
+		this.lock.Lock()
+		this.updateID += 1
+		this.lock.Unlock()
+		this.notify(MediaServer_ContentDirectory)
+	}
+	expected := "[0:1 1:2 2:3 3:4 4:5]"
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		lock.Lock()
+		done := 5 <= len(received)
+		lock.Unlock()
+		if done {
+			break
+		}
+	}
+	lock.Lock()
+	if actual := fmt.Sprint(received); expected != actual {
+		t.Errorf("Received %s, expected %s", actual, expected)
+	}
+	lock.Unlock()
+
+	request = httptest.NewRequest("UNSUBSCRIBE", "/", nil)
+	request.Header.Set("SID", sid)
+	recorder = httptest.NewRecorder()
+	this.subscribe(recorder, request, MediaServer_ContentDirectory)
+	if http.StatusOK != recorder.Code || 0 != len(this.subs) {
+		t.Errorf("UNSUBSCRIBE returned %d, leaving %d subscriptions", recorder.Code, len(this.subs))
+	}
+	this.notify(MediaServer_ContentDirectory)
+	time.Sleep(50 * time.Millisecond)
+	lock.Lock()
+	if 5 != len(received) {
+		t.Errorf("Received %d events after unsubscribing", len(received)-5)
+	}
+	lock.Unlock()
+}
@@ -0,0 +1,356 @@
+//
+// go-sonos
+// ========
+//
+// Copyright (c) 2012, Ian T. Richards <ianr@panix.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//   * Redistributions of source code must retain the above copyright notice,
+//     this list of conditions and the following disclaimer.
+//   * Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+// TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// The descriptive tags of an audio file
+type Tags struct {
+	Title    string
+	Artist   string
+	Album    string
+	Genre    string
+	Year     string
+	Track    int
+	Disc     int
+	Duration time.Duration
+}
+
+//
+// Reads the tags of the audio file at @filename.  ID3 (v1 and v2) and
+// FLAC tags are understood; anything they leave out is guessed from the
+// Artist/Album/NN Title.ext layout of the path.
+//
+func ReadTags(filename string) (tags Tags, err error) {
+	var f *os.File
+	if f, err = os.Open(filename); nil != err {
+		return
+	}
+	defer f.Close()
+	magic := make([]byte, 4)
+	if _, rerr := io.ReadFull(f, magic); nil == rerr {
+		switch {
+		case bytes.HasPrefix(magic, []byte("ID3")):
+			tagsReadID3v2(f, &tags)
+		case bytes.Equal(magic, []byte("fLaC")):
+			tagsReadFLAC(f, &tags)
+		}
+		if "" == tags.Title {
+			tagsReadID3v1(f, &tags)
+		}
+	}
+	tagsFromPath(filename, &tags)
+	return
+}
+
+// Matches a leading track number in a file name, as in "03 - Title"
+var tagsTrackPrefix = regexp.MustCompile(`^(\d{1,3})[\s._-]+(.*)$`)
+
+func tagsFromPath(filename string, tags *Tags) {
+	dir := filepath.Dir(filename)
+	base := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	if m := tagsTrackPrefix.FindStringSubmatch(base); nil != m {
+		if 0 == tags.Track {
+			tags.Track, _ = strconv.Atoi(m[1])
+		}
+		base = m[2]
+	}
+	if "" == tags.Title {
+		tags.Title = base
+	}
+	if "" == tags.Album {
+		tags.Album = filepath.Base(dir)
+	}
+	if "" == tags.Artist {
+		tags.Artist = filepath.Base(filepath.Dir(dir))
+	}
+}
+
+// Parses a "track/total" style number
+func tagsNumber(value string) int {
+	value = strings.TrimSpace(strings.SplitN(value, "/", 2)[0])
+	n, _ := strconv.Atoi(value)
+	return n
+}
+
+func tagsSet(tags *Tags, key, value string) {
+	value = strings.TrimSpace(value)
+	if "" == value {
+		return
+	}
+	switch key {
+	case "TITLE":
+		tags.Title = value
+	case "ARTIST":
+		tags.Artist = value
+	case "ALBUM":
+		tags.Album = value
+	case "GENRE":
+		tags.Genre = value
+	case "DATE", "YEAR":
+		tags.Year = value
+	case "TRACKNUMBER":
+		tags.Track = tagsNumber(value)
+	case "DISCNUMBER":
+		tags.Disc = tagsNumber(value)
+	case "LENGTH":
+		if ms, err := strconv.Atoi(value); nil == err {
+			tags.Duration = time.Duration(ms) * time.Millisecond
+		}
+	}
+}
+
+// The ID3v2 frames we read, for 2.2 and for 2.3 and later
+var tagsID3Frames = map[string]string{
+	"TT2": "TITLE", "TIT2": "TITLE",
+	"TP1": "ARTIST", "TPE1": "ARTIST",
+	"TAL": "ALBUM", "TALB": "ALBUM",
+	"TCO": "GENRE", "TCON": "GENRE",
+	"TYE": "YEAR", "TYER": "YEAR", "TDRC": "DATE",
+	"TRK": "TRACKNUMBER", "TRCK": "TRACKNUMBER",
+	"TPA": "DISCNUMBER", "TPOS": "DISCNUMBER",
+	"TLE": "LENGTH", "TLEN": "LENGTH",
+}
+
+func tagsSyncsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+// Decodes an ID3v2 text frame body, which begins with an encoding byte
+func tagsID3Text(body []byte) string {
+	if 0 == len(body) {
+		return ""
+	}
+	enc, body := body[0], body[1:]
+	switch enc {
+	case 1, 2:
+		var order binary.ByteOrder = binary.BigEndian
+		if 1 == enc && 2 <= len(body) {
+			if 0xff == body[0] && 0xfe == body[1] {
+				order = binary.LittleEndian
+			}
+			body = body[2:]
+		}
+		units := make([]uint16, 0, len(body)/2)
+		for i := 0; i+1 < len(body); i += 2 {
+			u := order.Uint16(body[i:])
+			if 0 == u {
+				break
+			}
+			units = append(units, u)
+		}
+		return string(utf16.Decode(units))
+	case 3:
+		return strings.TrimRight(string(body), "\x00")
+	}
+	return tagsLatin1(body)
+}
+
+func tagsLatin1(b []byte) string {
+	if i := bytes.IndexByte(b, 0); 0 <= i {
+		b = b[:i]
+	}
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+func tagsReadID3v2(f *os.File, tags *Tags) {
+	header := make([]byte, 10)
+	if _, err := f.ReadAt(header, 0); nil != err {
+		return
+	}
+	version, flags := header[3], header[5]
+	data := make([]byte, tagsSyncsafe(header[6:]))
+	if _, err := f.ReadAt(data, 10); nil != err {
+		return
+	}
+	if 3 <= version && 0 != flags&0x40 && 4 <= len(data) {
+		skip := int(binary.BigEndian.Uint32(data))
+		if 4 == version {
+			skip = tagsSyncsafe(data)
+		} else {
+			skip += 4
+		}
+		if skip > len(data) {
+			return
+		}
+		data = data[skip:]
+	}
+	idlen, hdrlen := 4, 10
+	if 2 == version {
+		idlen, hdrlen = 3, 6
+	}
+	for hdrlen <= len(data) && 0 != data[0] {
+		id := string(data[:idlen])
+		var size int
+		switch version {
+		case 2:
+			size = int(data[3])<<16 | int(data[4])<<8 | int(data[5])
+		case 3:
+			size = int(binary.BigEndian.Uint32(data[4:]))
+		default:
+			size = tagsSyncsafe(data[4:])
+		}
+		if 0 > size || size > len(data)-hdrlen {
+			return
+		}
+		if key, has := tagsID3Frames[id]; has {
+			tagsSet(tags, key, tagsID3Text(data[hdrlen:hdrlen+size]))
+		}
+		data = data[hdrlen+size:]
+	}
+	if "" != tags.Genre {
+		tags.Genre = tagsID3Genre(tags.Genre)
+	}
+}
+
+// Resolves an ID3 genre reference such as "(17)" or "17"
+func tagsID3Genre(genre string) string {
+	ref := strings.TrimSuffix(strings.TrimPrefix(genre, "("), ")")
+	if n, err := strconv.Atoi(ref); nil == err && 0 <= n && n < len(tagsID3v1Genres) {
+		return tagsID3v1Genres[n]
+	}
+	return genre
+}
+
+// The first of the ID3v1 genres, which are all that most files use
+var tagsID3v1Genres = []string{
+	"Blues", "Classic Rock", "Country", "Dance", "Disco", "Funk", "Grunge",
+	"Hip-Hop", "Jazz", "Metal", "New Age", "Oldies", "Other", "Pop", "R&B",
+	"Rap", "Reggae", "Rock", "Techno", "Industrial", "Alternative", "Ska",
+	"Death Metal", "Pranks", "Soundtrack", "Euro-Techno", "Ambient",
+	"Trip-Hop", "Vocal", "Jazz+Funk", "Fusion", "Trance", "Classical",
+	"Instrumental", "Acid", "House", "Game", "Sound Clip", "Gospel", "Noise",
+	"AlternRock", "Bass", "Soul", "Punk", "Space", "Meditative",
+	"Instrumental Pop", "Instrumental Rock", "Ethnic", "Gothic", "Darkwave",
+	"Techno-Industrial", "Electronic", "Pop-Folk", "Eurodance", "Dream",
+	"Southern Rock", "Comedy", "Cult", "Gangsta", "Top 40", "Christian Rap",
+	"Pop/Funk", "Jungle", "Native American", "Cabaret", "New Wave",
+	"Psychadelic", "Rave", "Showtunes", "Trailer", "Lo-Fi", "Tribal",
+	"Acid Punk", "Acid Jazz", "Polka", "Retro", "Musical", "Rock & Roll",
+	"Hard Rock",
+}
+
+func tagsReadID3v1(f *os.File, tags *Tags) {
+	info, err := f.Stat()
+	if nil != err || 128 > info.Size() {
+		return
+	}
+	tag := make([]byte, 128)
+	if _, err := f.ReadAt(tag, info.Size()-128); nil != err || "TAG" != string(tag[:3]) {
+		return
+	}
+	tagsSet(tags, "TITLE", tagsLatin1(tag[3:33]))
+	tagsSet(tags, "ARTIST", tagsLatin1(tag[33:63]))
+	tagsSet(tags, "ALBUM", tagsLatin1(tag[63:93]))
+	tagsSet(tags, "YEAR", tagsLatin1(tag[93:97]))
+	if 0 == tag[125] && 0 != tag[126] {
+		tags.Track = int(tag[126])
+	}
+	if int(tag[127]) < len(tagsID3v1Genres) {
+		tags.Genre = tagsID3v1Genres[tag[127]]
+	}
+}
+
+func tagsReadFLAC(f *os.File, tags *Tags) {
+	offset := int64(4)
+	header := make([]byte, 4)
+	for {
+		if _, err := f.ReadAt(header, offset); nil != err {
+			return
+		}
+		last, kind := 0 != header[0]&0x80, header[0]&0x7f
+		size := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+		offset += 4
+		switch kind {
+		case 0:
+			block := make([]byte, 18)
+			if _, err := f.ReadAt(block, offset); nil == err {
+				bits := binary.BigEndian.Uint64(block[10:])
+				rate := bits >> 44
+				samples := bits & (1<<36 - 1)
+				if 0 < rate {
+					tags.Duration = time.Duration(samples) * time.Second / time.Duration(rate)
+				}
+			}
+		case 4:
+			block := make([]byte, size)
+			if _, err := f.ReadAt(block, offset); nil == err {
+				tagsReadVorbisComment(block, tags)
+			}
+		}
+		if last {
+			return
+		}
+		offset += size
+	}
+}
+
+func tagsReadVorbisComment(block []byte, tags *Tags) {
+	next := func() (field []byte) {
+		if 4 > len(block) {
+			return nil
+		}
+		n := int(binary.LittleEndian.Uint32(block))
+		if 0 > n || n > len(block)-4 {
+			block = nil
+			return nil
+		}
+		field, block = block[4:4+n], block[4+n:]
+		return
+	}
+	next()
+	if 4 > len(block) {
+		return
+	}
+	count := int(binary.LittleEndian.Uint32(block))
+	block = block[4:]
+	for i := 0; i < count && 0 < len(block); i++ {
+		comment := strings.SplitN(string(next()), "=", 2)
+		if 2 == len(comment) {
+			tagsSet(tags, strings.ToUpper(comment[0]), comment[1])
+		}
+	}
+}
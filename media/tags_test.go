@@ -0,0 +1,192 @@
+//
+// go-sonos
+// ========
+//
+// Copyright (c) 2012, Ian T. Richards <ianr@panix.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//   * Redistributions of source code must retain the above copyright notice,
+//     this list of conditions and the following disclaimer.
+//   * Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+// TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testSyncsafe(n int) []byte {
+	return []byte{byte(n >> 21 & 0x7f), byte(n >> 14 & 0x7f), byte(n >> 7 & 0x7f), byte(n & 0x7f)}
+}
+
+// An ID3v2 frame of @version holding @body
+func testID3Frame(version byte, id string, body []byte) []byte {
+	frame := []byte(id)
+	switch version {
+	case 2:
+		frame = append(frame, byte(len(body)>>16), byte(len(body)>>8), byte(len(body)))
+	case 3:
+		frame = binary.BigEndian.AppendUint32(frame, uint32(len(body)))
+		frame = append(frame, 0, 0)
+	default:
+		frame = append(frame, testSyncsafe(len(body))...)
+		frame = append(frame, 0, 0)
+	}
+	return append(frame, body...)
+}
+
+// A text frame body in UTF-8 (ID3v2.4) or Latin-1
+func testID3Text(enc byte, text string) []byte {
+	return append([]byte{enc}, text...)
+}
+
+// A text frame body in UTF-16 with a little-endian byte order mark
+func testID3UTF16(text string) []byte {
+	body := []byte{1, 0xff, 0xfe}
+	for _, r := range text {
+		body = binary.LittleEndian.AppendUint16(body, uint16(r))
+	}
+	return append(body, 0, 0)
+}
+
+// An ID3v2 tag of @version holding @frames, followed by some audio
+func testID3v2(version byte, frames ...[]byte) []byte {
+	data := bytes.Join(frames, nil)
+	tag := append([]byte{'I', 'D', '3', version, 0, 0}, testSyncsafe(len(data))...)
+	return append(append(tag, data...), make([]byte, 64)...)
+}
+
+// Some audio followed by an ID3v1.1 tag
+func testID3v1(title, artist, album, year string, track, genre byte) []byte {
+	tag := make([]byte, 128)
+	copy(tag, "TAG")
+	copy(tag[3:33], title)
+	copy(tag[33:63], artist)
+	copy(tag[63:93], album)
+	copy(tag[93:97], year)
+	tag[126], tag[127] = track, genre
+	return append(make([]byte, 256), tag...)
+}
+
+// A FLAC file of @seconds at 44.1kHz with the Vorbis comments @comments
+func testFLAC(seconds uint64, comments ...string) []byte {
+	out := []byte("fLaC")
+	streamInfo := make([]byte, 34)
+	binary.BigEndian.PutUint64(streamInfo[10:], 44100<<44|44100*seconds)
+	out = append(out, 0, 0, 0, byte(len(streamInfo)))
+	out = append(out, streamInfo...)
+	block := binary.LittleEndian.AppendUint32(nil, 6)
+	block = append(block, "vendor"...)
+	block = binary.LittleEndian.AppendUint32(block, uint32(len(comments)))
+	for _, comment := range comments {
+		block = binary.LittleEndian.AppendUint32(block, uint32(len(comment)))
+		block = append(block, comment...)
+	}
+	out = append(out, 0x84, byte(len(block)>>16), byte(len(block)>>8), byte(len(block)))
+	return append(append(out, block...), make([]byte, 64)...)
+}
+
+func TestReadTags(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		content []byte
+		tags    Tags
+	}{
+		{"ID3v2.3", "Path Artist/Path Album/05 Path Title.mp3",
+			testID3v2(3,
+				testID3Frame(3, "TIT2", testID3Text(0, "Ace of Spades")),
+				testID3Frame(3, "TPE1", testID3Text(0, "Mot\xf6rhead")),
+				testID3Frame(3, "TALB", testID3UTF16("Ace of Spades")),
+				testID3Frame(3, "TCON", testID3Text(0, "(17)")),
+				testID3Frame(3, "TYER", testID3Text(0, "1980")),
+				testID3Frame(3, "TRCK", testID3Text(0, "1/12")),
+				testID3Frame(3, "TPOS", testID3Text(0, "1/1")),
+				testID3Frame(3, "TLEN", testID3Text(0, "169000")),
+				testID3Frame(3, "COMM", testID3Text(0, "ignored"))),
+			Tags{Title: "Ace of Spades", Artist: "Motörhead", Album: "Ace of Spades", Genre: "Rock",
+				Year: "1980", Track: 1, Disc: 1, Duration: 169 * time.Second}},
+		{"ID3v2.2", "Path Artist/Path Album/05 Path Title.mp3",
+			testID3v2(2,
+				testID3Frame(2, "TT2", testID3Text(0, "Title")),
+				testID3Frame(2, "TP1", testID3Text(0, "Artist"))),
+			Tags{Title: "Title", Artist: "Artist", Album: "Path Album", Track: 5}},
+		{"ID3v2.4", "a/b/c.mp3",
+			testID3v2(4,
+				testID3Frame(4, "TIT2", testID3Text(3, "Déjà Vu")),
+				testID3Frame(4, "TDRC", testID3Text(3, "1970")),
+				testID3Frame(4, "TCON", testID3Text(3, "Folk Rock"))),
+			Tags{Title: "Déjà Vu", Artist: "a", Album: "b", Genre: "Folk Rock", Year: "1970"}},
+		{"ID3v2 frame overrunning the tag", "Path Artist/Path Album/Path Title.mp3",
+			testID3v2(3,
+				testID3Frame(3, "TIT2", testID3Text(0, "Title")),
+				[]byte{'T', 'P', 'E', '1', 0, 0, 1, 0, 0, 0, 0, 'A'}),
+			Tags{Title: "Title", Artist: "Path Artist", Album: "Path Album"}},
+		{"ID3v2 longer than the file", "Path Artist/Path Album/Path Title.mp3",
+			[]byte{'I', 'D', '3', 3, 0, 0, 0, 0, 0x7f, 0x7f},
+			Tags{Title: "Path Title", Artist: "Path Artist", Album: "Path Album"}},
+		{"ID3v1", "Path Artist/Path Album/Path Title.mp3",
+			testID3v1("So What", "Miles Davis", "Kind of Blue", "1959", 1, 8),
+			Tags{Title: "So What", Artist: "Miles Davis", Album: "Kind of Blue", Genre: "Jazz", Year: "1959", Track: 1}},
+		{"FLAC", "Path Artist/Path Album/Path Title.flac",
+			testFLAC(90, "TITLE=Title", "artist=Artist", "TRACKNUMBER=2/10", "DISCNUMBER=2", "NOEQUALS"),
+			Tags{Title: "Title", Artist: "Artist", Album: "Path Album", Track: 2, Disc: 2, Duration: 90 * time.Second}},
+		{"no tags", "Path Artist/Path Album/03 - Path Title.mp3",
+			make([]byte, 64),
+			Tags{Title: "Path Title", Artist: "Path Artist", Album: "Path Album", Track: 3}},
+		{"empty", "Path Artist/Path Album/1.Path Title.mp3",
+			nil,
+			Tags{Title: "Path Title", Artist: "Path Artist", Album: "Path Album", Track: 1}},
+	}
+	root := t.TempDir()
+	for _, test := range tests {
+		filename := filepath.Join(root, test.name, filepath.FromSlash(test.path))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); nil != err {
+			t.Fatal(err)
+		} else if err := os.WriteFile(filename, test.content, 0644); nil != err {
+			t.Fatal(err)
+		}
+		tags, err := ReadTags(filename)
+		if nil != err {
+			t.Errorf("%s: %v", test.name, err)
+		} else if test.tags != tags {
+			t.Errorf("%s: read %+v, expected %+v", test.name, tags, test.tags)
+		}
+	}
+	if _, err := ReadTags(filepath.Join(root, "missing.mp3")); nil == err {
+		t.Error("Read the tags of a missing file")
+	}
+}
+
+func TestID3Genre(t *testing.T) {
+	for in, out := range map[string]string{
+		"(17)": "Rock", "17": "Rock", "0": "Blues", "(200)": "(200)", "Folk": "Folk", "(-1)": "(-1)",
+	} {
+		if genre := tagsID3Genre(in); out != genre {
+			t.Errorf("tagsID3Genre(%q) = %q, expected %q", in, genre, out)
+		}
+	}
+}
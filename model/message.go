@@ -38,11 +38,20 @@ import (
 	"time"
 )
 
+//
+// The position within the current track.  TrackDuration and RelTime are
+// zero when the player reports them as NOT_IMPLEMENTED (e.g. for a radio
+// stream), in which case Remaining and PercentComplete are zero too.
+// The JSON encoding, with durations in milliseconds, is given by
+// MarshalJSON().
+//
 type PositionInfo struct {
 	Track               uint32
 	TrackDuration       time.Duration
 	TrackURI            string
 	RelTime             time.Duration
+	Remaining           time.Duration
+	PercentComplete     float64
 	ProtocolInfo        string
 	Title               string
 	Class               string
@@ -51,24 +60,9 @@ type PositionInfo struct {
 	OriginalTrackNumber string
 }
 
-func getDuration(in string) (d time.Duration, err error) {
-	in = strings.Replace(in, ":", "h", 1)
-	in = strings.Replace(in, ":", "m", 1)
-	in += "s"
-	return time.ParseDuration(in)
-}
-
 func GetPositionInfoMessage(in *upnp.PositionInfo) *PositionInfo {
-	var trackDuration, relTime time.Duration
-	trackDuration, err := getDuration(in.TrackDuration)
-	if nil == err {
-		trackDuration /= time.Second
-	}
-
-	relTime, err = getDuration(in.RelTime)
-	if nil == err {
-		relTime /= time.Second
-	}
+	trackDuration, _ := upnp.ParseTime(in.TrackDuration)
+	relTime, _ := upnp.ParseTime(in.RelTime)
 
 	out := &PositionInfo{
 		Track:         in.Track,
@@ -76,6 +70,10 @@ func GetPositionInfoMessage(in *upnp.PositionInfo) *PositionInfo {
 		TrackURI:      in.TrackURI,
 		RelTime:       relTime,
 	}
+	if 0 < trackDuration && relTime <= trackDuration {
+		out.Remaining = trackDuration - relTime
+		out.PercentComplete = 100 * float64(relTime) / float64(trackDuration)
+	}
 
 	metadata := &didl.Lite{}
 	xml.Unmarshal([]byte(in.TrackMetaData), metadata)
@@ -111,16 +109,17 @@ func GetPositionInfoMessage(in *upnp.PositionInfo) *PositionInfo {
 	return out
 }
 
+// An entry in a queue or browse result, the "queueElement" definition of schema.json
 type QueueElement struct {
-	ID                  string
-	ParentID            string
-	TrackURI            string
-	Title               string
-	Class               string
-	AlbumArtURI         string
-	Creator             string
-	Album               string
-	OriginalTrackNumber string
+	ID                  string `json:"id"`
+	ParentID            string `json:"parentId"`
+	TrackURI            string `json:"trackUri,omitempty"`
+	Title               string `json:"title"`
+	Class               string `json:"class"`
+	AlbumArtURI         string `json:"albumArtUri,omitempty"`
+	Creator             string `json:"creator,omitempty"`
+	Album               string `json:"album,omitempty"`
+	OriginalTrackNumber string `json:"originalTrackNumber,omitempty"`
 }
 
 func protectEncoding(s string) string {
@@ -135,7 +134,7 @@ func GetQueueContentsMessage(in []Object) []QueueElement {
 			ParentID:            obj.ParentID(),
 			TrackURI:            obj.Res(),
 			Title:               obj.Title(),
-			Class:               obj.Class(),
+			Class:               obj.Class().String(),
 			AlbumArtURI:         obj.AlbumArtURI(),
 			Creator:             obj.Creator(),
 			Album:               obj.Album(),
@@ -0,0 +1,61 @@
+//
+// go-sonos
+// ========
+//
+// Copyright (c) 2012, Ian T. Richards <ianr@panix.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//   * Redistributions of source code must retain the above copyright notice,
+//     this list of conditions and the following disclaimer.
+//   * Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+// TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package model
+
+import (
+	"github.com/ianr0bkny/go-sonos/upnp"
+	"testing"
+	"time"
+)
+
+func TestGetPositionInfoMessage(t *testing.T) {
+	tests := []struct {
+		duration  string
+		relTime   string
+		remaining time.Duration
+		percent   float64
+	}{
+		{"0:04:00", "0:01:00", 3 * time.Minute, 25},
+		{"0:04:00", "0:00:00", 4 * time.Minute, 0},
+		{"0:04:00", "0:04:00", 0, 100},
+		{"10:00:00", "5:00:00", 5 * time.Hour, 50},
+		{"0:00:02", "0:00:00.5", 1500 * time.Millisecond, 25},
+		// A stream, and a position past the end
+		{upnp.TimeNotImplemented, upnp.TimeNotImplemented, 0, 0},
+		{"0:00:00", "0:01:00", 0, 0},
+		{"0:04:00", "0:05:00", 0, 0},
+	}
+	for _, test := range tests {
+		out := GetPositionInfoMessage(&upnp.PositionInfo{TrackDuration: test.duration, RelTime: test.relTime})
+		if test.remaining != out.Remaining || test.percent != out.PercentComplete {
+			t.Errorf("%s of %s: remaining %v, %v%% complete", test.relTime, test.duration, out.Remaining, out.PercentComplete)
+		}
+	}
+}
@@ -35,9 +35,94 @@ package model
 
 import (
 	"github.com/ianr0bkny/go-sonos/didl"
+	"github.com/ianr0bkny/go-sonos/upnp"
 	_ "log"
+	"strconv"
+	"strings"
+	"time"
 )
 
+//
+// The UPnP class of an object, a dotted path such as
+// object.item.audioItem.musicTrack in which each component refines the
+// one before it.
+//
+type Class string
+
+// Returns the class name
+func (this Class) String() string {
+	return string(this)
+}
+
+// True if the class is @base or is derived from it
+func (this Class) IsA(base string) bool {
+	return string(this) == base || strings.HasPrefix(string(this), base+".")
+}
+
+// True for object.container and its derived classes
+func (this Class) IsContainer() bool {
+	return this.IsA("object.container")
+}
+
+// True for object.item and its derived classes
+func (this Class) IsItem() bool {
+	return this.IsA("object.item")
+}
+
+// The class this class is derived from, or "" for object
+func (this Class) Parent() Class {
+	if i := strings.LastIndex(string(this), "."); 0 <= i {
+		return this[:i]
+	}
+	return ""
+}
+
+// A performer or other contributor, and the role given for them
+type Artist struct {
+	Name string `json:"name"`
+	// e.g. "Performer", "Composer" or "AlbumArtist"; may be empty
+	Role string `json:"role,omitempty"`
+}
+
+//
+// The four fields of a UPnP protocolInfo string, as in
+// http-get:*:audio/mpeg:* (ConnectionManager:1 section 2.5.2).
+//
+type ProtocolInfo struct {
+	Protocol       string
+	Network        string
+	ContentFormat  string
+	AdditionalInfo string
+}
+
+// Splits a protocolInfo string into its fields
+func ParseProtocolInfo(in string) (info ProtocolInfo) {
+	fields := strings.SplitN(in, ":", 4)
+	for len(fields) < 4 {
+		fields = append(fields, "")
+	}
+	info.Protocol, info.Network = fields[0], fields[1]
+	info.ContentFormat, info.AdditionalInfo = fields[2], fields[3]
+	return
+}
+
+// Joins the fields back into a protocolInfo string
+func (this ProtocolInfo) String() string {
+	return strings.Join([]string{this.Protocol, this.Network, this.ContentFormat, this.AdditionalInfo}, ":")
+}
+
+// A <res> of an object: one way of fetching what it describes
+type Resource struct {
+	URI          string
+	ProtocolInfo ProtocolInfo
+	// Zero when not given
+	Duration        time.Duration
+	Size            uint64
+	Bitrate         uint
+	SampleFrequency uint
+	NrAudioChannels uint
+}
+
 // An abstraction of a DIDL-Lite <Container> or <Item> block.
 type Object interface {
 	// The ObjectID of this item or container
@@ -71,7 +156,7 @@ type Object interface {
 	//
 	//  Items:
 	//	* object.item.audioItem.musicTrack
-	Class() string
+	Class() Class
 
 	// The URI to use to access the artwork for this container or item.
 	AlbumArtURI() string
@@ -89,35 +174,96 @@ type Object interface {
 
 	// True, if this Object represents a container; false otherwise.
 	IsContainer() bool
+
+	// The playing time of the first resource that gives one, or zero.
+	Duration() time.Duration
+
+	// The upnp:artist entries with their roles, followed by any album
+	// artists (with role "AlbumArtist").  When neither is given the
+	// creator is returned with an empty role.
+	Artists() []Artist
+
+	// The names of the genres of this container or item.
+	Genres() []string
+
+	// The year from dc:date, or zero.
+	Year() int
+
+	// Every resource of this container or item, in document order.
+	Resources() []Resource
+
+	// The number of children of a container, where the server gives it.
+	ChildCount() int
 }
 
 //
 // A flattened structure of exported fields to allow Objects to be passed
 // via XML, JSON, or other encoding relying on reflection.  Fields in this
 // struct mirror the usage of like-named methods in the Object interface.
+// The JSON encoding is the "object" definition of schema.json.
 //
 type ObjectMessage struct {
-	ID          string
-	ParentID    string
-	URI         string
-	Title       string
-	Class       string
-	AlbumArtURI string
-	Creator     string
-	Album       string
+	ID                  string            `json:"id"`
+	ParentID            string            `json:"parentId"`
+	URI                 string            `json:"uri,omitempty"`
+	Title               string            `json:"title"`
+	Class               string            `json:"class"`
+	AlbumArtURI         string            `json:"albumArtUri,omitempty"`
+	Creator             string            `json:"creator,omitempty"`
+	Album               string            `json:"album,omitempty"`
+	OriginalTrackNumber string            `json:"originalTrackNumber,omitempty"`
+	Container           bool              `json:"container"`
+	Restricted          bool              `json:"restricted"`
+	DurationMs          int64             `json:"durationMs,omitempty"`
+	Artists             []Artist          `json:"artists,omitempty"`
+	Genres              []string          `json:"genres,omitempty"`
+	Year                int               `json:"year,omitempty"`
+	ChildCount          int               `json:"childCount,omitempty"`
+	Resources           []ResourceMessage `json:"resources,omitempty"`
+}
+
+// The JSON encoding of a Resource, the "resource" definition of schema.json
+type ResourceMessage struct {
+	URI             string `json:"uri"`
+	ProtocolInfo    string `json:"protocolInfo,omitempty"`
+	DurationMs      int64  `json:"durationMs,omitempty"`
+	Size            uint64 `json:"size,omitempty"`
+	Bitrate         uint   `json:"bitrate,omitempty"`
+	SampleFrequency uint   `json:"sampleFrequency,omitempty"`
+	NrAudioChannels uint   `json:"nrAudioChannels,omitempty"`
 }
 
 func makeObjectMessage(obj Object) *ObjectMessage {
-	return &ObjectMessage{
-		ID:          obj.ID(),
-		ParentID:    obj.ParentID(),
-		URI:         obj.Res(),
-		Title:       obj.Title(),
-		Class:       obj.Class(),
-		AlbumArtURI: obj.AlbumArtURI(),
-		Creator:     obj.Creator(),
-		Album:       obj.Album(),
+	out := &ObjectMessage{
+		ID:                  obj.ID(),
+		ParentID:            obj.ParentID(),
+		URI:                 obj.Res(),
+		Title:               obj.Title(),
+		Class:               obj.Class().String(),
+		AlbumArtURI:         obj.AlbumArtURI(),
+		Creator:             obj.Creator(),
+		Album:               obj.Album(),
+		OriginalTrackNumber: obj.OriginalTrackNumber(),
+		Container:           obj.IsContainer(),
+		Restricted:          obj.Restricted(),
+		DurationMs:          wireMillis(obj.Duration()),
+		Artists:             obj.Artists(),
+		Genres:              obj.Genres(),
+		Year:                obj.Year(),
+		ChildCount:          obj.ChildCount(),
+	}
+	for _, res := range obj.Resources() {
+		out.Resources = append(out.Resources, ResourceMessage{
+			URI:             res.URI,
+			ProtocolInfo:    res.ProtocolInfo.String(),
+			DurationMs:      wireMillis(res.Duration),
+			Size:            res.Size,
+			Bitrate:         res.Bitrate,
+			SampleFrequency: res.SampleFrequency,
+			NrAudioChannels: res.NrAudioChannels,
+		})
 	}
+	return out
 }
 
 type modelObjectImpl struct {
@@ -132,6 +278,11 @@ type modelObjectImpl struct {
 	album               string
 	originalTrackNumber string
 	isContainer         bool
+	artists             []Artist
+	genres              []string
+	year                int
+	resources           []Resource
+	childCount          int
 }
 
 func (this modelObjectImpl) ID() string {
@@ -154,8 +305,8 @@ func (this modelObjectImpl) Title() string {
 	return this.title
 }
 
-func (this modelObjectImpl) Class() string {
-	return this.class
+func (this modelObjectImpl) Class() Class {
+	return Class(this.class)
 }
 
 func (this modelObjectImpl) AlbumArtURI() string {
@@ -178,6 +329,86 @@ func (this modelObjectImpl) IsContainer() bool {
 	return this.isContainer
 }
 
+func (this modelObjectImpl) Duration() time.Duration {
+	for _, res := range this.resources {
+		if 0 < res.Duration {
+			return res.Duration
+		}
+	}
+	return 0
+}
+
+func (this modelObjectImpl) Artists() []Artist {
+	return this.artists
+}
+
+func (this modelObjectImpl) Genres() []string {
+	return this.genres
+}
+
+func (this modelObjectImpl) Year() int {
+	return this.year
+}
+
+func (this modelObjectImpl) Resources() []Resource {
+	return this.resources
+}
+
+func (this modelObjectImpl) ChildCount() int {
+	return this.childCount
+}
+
+func makeResources(in []didl.Res) (out []Resource) {
+	for _, res := range in {
+		resource := Resource{
+			URI:             res.Value,
+			ProtocolInfo:    ParseProtocolInfo(res.ProtocolInfo),
+			Size:            res.Size,
+			Bitrate:         res.Bitrate,
+			SampleFrequency: res.SampleFrequency,
+			NrAudioChannels: res.NrAudioChannels,
+		}
+		if d, err := upnp.ParseTime(res.Duration); nil == err {
+			resource.Duration = d
+		}
+		out = append(out, resource)
+	}
+	return
+}
+
+func makeArtists(artists []didl.Artist, albumArtists [][]didl.AlbumArtist, creator string) (out []Artist) {
+	for _, artist := range artists {
+		out = append(out, Artist{Name: artist.Value, Role: artist.Role})
+	}
+	seen := make(map[string]bool)
+	for _, list := range albumArtists {
+		for _, artist := range list {
+			if !seen[artist.Value] {
+				seen[artist.Value] = true
+				out = append(out, Artist{Name: artist.Value, Role: "AlbumArtist"})
+			}
+		}
+	}
+	if 0 == len(out) && "" != creator {
+		out = append(out, Artist{Name: creator})
+	}
+	return
+}
+
+func makeGenres(in []didl.Genre) (out []string) {
+	for _, genre := range in {
+		out = append(out, genre.Value)
+	}
+	return
+}
+
+func makeYear(in []didl.Date) (year int) {
+	if 0 < len(in) && 4 <= len(in[0].Value) {
+		year, _ = strconv.Atoi(in[0].Value[:4])
+	}
+	return
+}
+
 func makeContainer(in *didl.Container) Object {
 	obj := modelObjectImpl{}
 	obj.id = in.ID
@@ -199,6 +430,11 @@ func makeContainer(in *didl.Container) Object {
 		obj.creator = in.Creator[0].Value
 	}
 	obj.isContainer = true
+	obj.artists = makeArtists(in.Artist, [][]didl.AlbumArtist{in.AlbumArtist, in.SonosAlbumArtist}, obj.creator)
+	obj.genres = makeGenres(in.Genre)
+	obj.year = makeYear(in.Date)
+	obj.resources = makeResources(in.Res)
+	obj.childCount = in.ChildCount
 	return obj
 }
 
@@ -228,6 +464,10 @@ func makeItem(in *didl.Item) Object {
 	if 0 < len(in.OriginalTrackNumber) {
 		obj.originalTrackNumber = in.OriginalTrackNumber[0].Value
 	}
+	obj.artists = makeArtists(in.Artist, [][]didl.AlbumArtist{in.AlbumArtist, in.SonosAlbumArtist}, obj.creator)
+	obj.genres = makeGenres(in.Genre)
+	obj.year = makeYear(in.Date)
+	obj.resources = makeResources(in.Res)
 	return obj
 }
 
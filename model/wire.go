@@ -0,0 +1,570 @@
+//
+// go-sonos
+// ========
+//
+// Copyright (c) 2012, Ian T. Richards <ianr@panix.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//   * Redistributions of source code must retain the above copyright notice,
+//     this list of conditions and the following disclaimer.
+//   * Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+// TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package model
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/ianr0bkny/go-sonos/didl"
+	"github.com/ianr0bkny/go-sonos/ssdp"
+	"github.com/ianr0bkny/go-sonos/upnp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//
+// The version of the JSON encodings in this package.  The version is
+// raised whenever a field is renamed, removed or changes meaning; new
+// fields may be added without a change of version.  schema.json in this
+// directory describes version 1.
+//
+// All of the encodings follow the same rules, so that they map directly
+// onto protocol buffer messages: field names are lowerCamelCase, times
+// and durations are integer milliseconds in fields ending "Ms", and
+// optional fields are omitted rather than sent as null.
+//
+const WireVersion = 1
+
+// The names given in Envelope.Type
+const (
+	WireType_Object         = "object"
+	WireType_Objects        = "objects"
+	WireType_Queue          = "queue"
+	WireType_PositionInfo   = "positionInfo"
+	WireType_TransportInfo  = "transportInfo"
+	WireType_Groups         = "groups"
+	WireType_Alarms         = "alarms"
+	WireType_TransportEvent = "transportEvent"
+	WireType_RenderingEvent = "renderingEvent"
+	WireType_Device         = "device"
+	WireType_Devices        = "devices"
+	WireType_PrefixIndex    = "prefixIndex"
+)
+
+//
+// The wrapper around every message sent by csweb and by cscl --json.
+// Type names the definition in schema.json that Value follows, and is
+// empty for plain values such as a volume or the boolean result of a
+// command.  Error is set, and Value omitted, when a request failed.
+//
+type Envelope struct {
+	Version int         `json:"version"`
+	Type    string      `json:"type,omitempty"`
+	Error   string      `json:"error,omitempty"`
+	Value   interface{} `json:"value,omitempty"`
+}
+
+// Wraps @value, naming its type when it is one of the messages here
+func MakeEnvelope(value interface{}) *Envelope {
+	return &Envelope{
+		Version: WireVersion,
+		Type:    wireType(value),
+		Value:   value,
+	}
+}
+
+// Wraps the failure @err
+func MakeErrorEnvelope(err error) *Envelope {
+	return &Envelope{
+		Version: WireVersion,
+		Error:   fmt.Sprintf("%v", err),
+	}
+}
+
+func wireType(value interface{}) string {
+	switch value.(type) {
+	case *ObjectMessage, ObjectMessage:
+		return WireType_Object
+	case []*ObjectMessage:
+		return WireType_Objects
+	case []QueueElement:
+		return WireType_Queue
+	case *PositionInfo, PositionInfo:
+		return WireType_PositionInfo
+	case *TransportInfoMessage, TransportInfoMessage:
+		return WireType_TransportInfo
+	case []GroupMessage:
+		return WireType_Groups
+	case *AlarmListMessage, AlarmListMessage:
+		return WireType_Alarms
+	case *TransportEventMessage, TransportEventMessage:
+		return WireType_TransportEvent
+	case *RenderingEventMessage, RenderingEventMessage:
+		return WireType_RenderingEvent
+	case *DeviceMessage, DeviceMessage:
+		return WireType_Device
+	case []DeviceMessage:
+		return WireType_Devices
+	case *PrefixIndexMessage, PrefixIndexMessage:
+		return WireType_PrefixIndex
+	}
+	return ""
+}
+
+// Durations go on the wire as integer milliseconds
+func wireMillis(d time.Duration) int64 {
+	return int64(d / time.Millisecond)
+}
+
+// Parses a UPnP time value to milliseconds, giving zero when there is none
+func wireTimeMillis(in string) int64 {
+	d, _ := upnp.ParseTime(in)
+	return wireMillis(d)
+}
+
+// The JSON encoding of PositionInfo, the "positionInfo" definition of schema.json
+type positionInfoJSON struct {
+	Track               uint32  `json:"track"`
+	TrackDurationMs     int64   `json:"trackDurationMs"`
+	TrackURI            string  `json:"trackUri,omitempty"`
+	RelTimeMs           int64   `json:"relTimeMs"`
+	RemainingMs         int64   `json:"remainingMs"`
+	PercentComplete     float64 `json:"percentComplete"`
+	ProtocolInfo        string  `json:"protocolInfo,omitempty"`
+	Title               string  `json:"title,omitempty"`
+	Class               string  `json:"class,omitempty"`
+	Creator             string  `json:"creator,omitempty"`
+	Album               string  `json:"album,omitempty"`
+	OriginalTrackNumber string  `json:"originalTrackNumber,omitempty"`
+}
+
+func (this PositionInfo) MarshalJSON() ([]byte, error) {
+	return json.Marshal(positionInfoJSON{
+		Track:               this.Track,
+		TrackDurationMs:     wireMillis(this.TrackDuration),
+		TrackURI:            this.TrackURI,
+		RelTimeMs:           wireMillis(this.RelTime),
+		RemainingMs:         wireMillis(this.Remaining),
+		PercentComplete:     this.PercentComplete,
+		ProtocolInfo:        this.ProtocolInfo,
+		Title:               this.Title,
+		Class:               this.Class,
+		Creator:             this.Creator,
+		Album:               this.Album,
+		OriginalTrackNumber: this.OriginalTrackNumber,
+	})
+}
+
+func (this *PositionInfo) UnmarshalJSON(data []byte) error {
+	in := positionInfoJSON{}
+	if err := json.Unmarshal(data, &in); nil != err {
+		return err
+	}
+	*this = PositionInfo{
+		Track:               in.Track,
+		TrackDuration:       time.Duration(in.TrackDurationMs) * time.Millisecond,
+		TrackURI:            in.TrackURI,
+		RelTime:             time.Duration(in.RelTimeMs) * time.Millisecond,
+		Remaining:           time.Duration(in.RemainingMs) * time.Millisecond,
+		PercentComplete:     in.PercentComplete,
+		ProtocolInfo:        in.ProtocolInfo,
+		Title:               in.Title,
+		Class:               in.Class,
+		Creator:             in.Creator,
+		Album:               in.Album,
+		OriginalTrackNumber: in.OriginalTrackNumber,
+	}
+	return nil
+}
+
+// The "transportInfo" definition of schema.json
+type TransportInfoMessage struct {
+	State  string `json:"state"`
+	Status string `json:"status"`
+	Speed  string `json:"speed"`
+}
+
+func GetTransportInfoMessage(in *upnp.TransportInfo) *TransportInfoMessage {
+	return &TransportInfoMessage{
+		State:  in.CurrentTransportState,
+		Status: in.CurrentTransportStatus,
+		Speed:  in.CurrentSpeed,
+	}
+}
+
+// A player in a group, the "groupMember" definition of schema.json
+type GroupMemberMessage struct {
+	UUID            string `json:"uuid"`
+	Name            string `json:"name"`
+	Location        string `json:"location"`
+	SoftwareVersion string `json:"softwareVersion,omitempty"`
+	Invisible       bool   `json:"invisible,omitempty"`
+	ZoneBridge      bool   `json:"zoneBridge,omitempty"`
+	// Bonded players, as in ZoneGroupMember.ChannelMapSet
+	ChannelMapSet   string               `json:"channelMapSet,omitempty"`
+	HTSatChanMapSet string               `json:"htSatChanMapSet,omitempty"`
+	Satellites      []GroupMemberMessage `json:"satellites,omitempty"`
+}
+
+// A group of players, the "group" definition of schema.json
+type GroupMessage struct {
+	ID string `json:"id"`
+	// The UUID of the member that coordinates playback
+	Coordinator string               `json:"coordinator"`
+	Members     []GroupMemberMessage `json:"members"`
+}
+
+func makeGroupMemberMessage(in *upnp.ZoneGroupMember) (out GroupMemberMessage) {
+	out = GroupMemberMessage{
+		UUID:            in.UUID,
+		Name:            in.ZoneName,
+		Location:        in.Location,
+		SoftwareVersion: in.SoftwareVersion,
+		Invisible:       "1" == in.Invisible,
+		ZoneBridge:      "1" == in.IsZoneBridge,
+		ChannelMapSet:   in.ChannelMapSet,
+		HTSatChanMapSet: in.HTSatChanMapSet,
+	}
+	for i := range in.Satellite {
+		out.Satellites = append(out.Satellites, makeGroupMemberMessage(&in.Satellite[i]))
+	}
+	return
+}
+
+// Creates the message for the topology given by GetZoneGroupState()
+func GetGroupsMessage(in *upnp.ZoneGroups) (out []GroupMessage) {
+	out = []GroupMessage{}
+	for _, group := range in.ZoneGroup {
+		msg := GroupMessage{
+			ID:          group.ID,
+			Coordinator: group.Coordinator,
+			Members:     []GroupMemberMessage{},
+		}
+		for i := range group.ZoneGroupMember {
+			msg.Members = append(msg.Members, makeGroupMemberMessage(&group.ZoneGroupMember[i]))
+		}
+		out = append(out, msg)
+	}
+	return
+}
+
+// An alarm, the "alarm" definition of schema.json
+type AlarmMessage struct {
+	ID uint32 `json:"id"`
+	// The local time of day at which the alarm starts, as HH:MM:SS
+	StartTime  string `json:"startTime"`
+	DurationMs int64  `json:"durationMs,omitempty"`
+	// One of the Recurrence_* constants of upnp, or ON_<days>
+	Recurrence         string `json:"recurrence"`
+	Enabled            bool   `json:"enabled"`
+	RoomUUID           string `json:"roomUuid"`
+	ProgramURI         string `json:"programUri,omitempty"`
+	ProgramMetaData    string `json:"programMetaData,omitempty"`
+	PlayMode           string `json:"playMode,omitempty"`
+	Volume             uint16 `json:"volume"`
+	IncludeLinkedZones bool   `json:"includeLinkedZones"`
+}
+
+// The alarms of a household, the "alarmList" definition of schema.json
+type AlarmListMessage struct {
+	// Changes whenever an alarm is added, changed or removed
+	Version string         `json:"version"`
+	Alarms  []AlarmMessage `json:"alarms"`
+}
+
+type alarm_XML struct {
+	ID                 uint32 `xml:"ID,attr"`
+	StartTime          string `xml:"StartTime,attr"`
+	Duration           string `xml:"Duration,attr"`
+	Recurrence         string `xml:"Recurrence,attr"`
+	Enabled            string `xml:"Enabled,attr"`
+	RoomUUID           string `xml:"RoomUUID,attr"`
+	ProgramURI         string `xml:"ProgramURI,attr"`
+	ProgramMetaData    string `xml:"ProgramMetaData,attr"`
+	PlayMode           string `xml:"PlayMode,attr"`
+	Volume             uint16 `xml:"Volume,attr"`
+	IncludeLinkedZones string `xml:"IncludeLinkedZones,attr"`
+}
+
+type alarmList_XML struct {
+	XMLName xml.Name
+	Alarm   []alarm_XML
+}
+
+//
+// Creates the message for the CurrentAlarmList and CurrentAlarmListVersion
+// returned by AlarmClock.ListAlarms().
+//
+func GetAlarmListMessage(list, version string) (out *AlarmListMessage, err error) {
+	out = &AlarmListMessage{
+		Version: version,
+		Alarms:  []AlarmMessage{},
+	}
+	doc := alarmList_XML{}
+	if err = xml.Unmarshal([]byte(list), &doc); nil != err {
+		return out, errors.New(fmt.Sprintf("Malformed alarm list: %v", err))
+	}
+	for _, alarm := range doc.Alarm {
+		out.Alarms = append(out.Alarms, AlarmMessage{
+			ID:                 alarm.ID,
+			StartTime:          alarm.StartTime,
+			DurationMs:         wireTimeMillis(alarm.Duration),
+			Recurrence:         alarm.Recurrence,
+			Enabled:            "1" == alarm.Enabled,
+			RoomUUID:           alarm.RoomUUID,
+			ProgramURI:         alarm.ProgramURI,
+			ProgramMetaData:    alarm.ProgramMetaData,
+			PlayMode:           alarm.PlayMode,
+			Volume:             alarm.Volume,
+			IncludeLinkedZones: "1" == alarm.IncludeLinkedZones,
+		})
+	}
+	return
+}
+
+//
+// The changes carried by an AVTransport event, the "transportEvent"
+// definition of schema.json.  Only the state variables the event names
+// are set, so that one it clears, such as NextTrackURI at the end of the
+// queue, is present as an empty string; the others are omitted.
+//
+type TransportEventMessage struct {
+	// The UUID of the player that sent the event
+	UUID                 string         `json:"uuid"`
+	TransportState       *string        `json:"transportState,omitempty"`
+	TransportStatus      *string        `json:"transportStatus,omitempty"`
+	PlayMode             *string        `json:"playMode,omitempty"`
+	CrossfadeMode        *bool          `json:"crossfadeMode,omitempty"`
+	NumberOfTracks       *uint32        `json:"numberOfTracks,omitempty"`
+	CurrentTrack         *uint32        `json:"currentTrack,omitempty"`
+	CurrentSection       *uint32        `json:"currentSection,omitempty"`
+	CurrentTrackURI      *string        `json:"currentTrackUri,omitempty"`
+	CurrentTrackDuration *int64         `json:"currentTrackDurationMs,omitempty"`
+	CurrentTrackMetaData *ObjectMessage `json:"currentTrackMetaData,omitempty"`
+	NextTrackURI         *string        `json:"nextTrackUri,omitempty"`
+	AVTransportURI       *string        `json:"avTransportUri,omitempty"`
+	SleepTimerGeneration *uint32        `json:"sleepTimerGeneration,omitempty"`
+	AlarmRunning         *bool          `json:"alarmRunning,omitempty"`
+	SnoozeRunning        *bool          `json:"snoozeRunning,omitempty"`
+	RestartPending       *bool          `json:"restartPending,omitempty"`
+}
+
+//
+// The changes carried by a RenderingControl event, the "renderingEvent"
+// definition of schema.json.  The per-channel values are keyed by channel
+// (e.g. "Master", "LF", "RF"); as for TransportEventMessage only the state
+// variables the event names are set.
+//
+type RenderingEventMessage struct {
+	// The UUID of the player that sent the event
+	UUID               string            `json:"uuid"`
+	Volume             map[string]uint16 `json:"volume,omitempty"`
+	Mute               map[string]bool   `json:"mute,omitempty"`
+	Loudness           map[string]bool   `json:"loudness,omitempty"`
+	Bass               *int              `json:"bass,omitempty"`
+	Treble             *int              `json:"treble,omitempty"`
+	OutputFixed        *bool             `json:"outputFixed,omitempty"`
+	HeadphoneConnected *bool             `json:"headphoneConnected,omitempty"`
+}
+
+// The player UUID from the UDN of @svc (e.g. uuid:RINCON_000E58000000_MR)
+func wireEventUUID(svc *upnp.Service) string {
+	if nil == svc {
+		return ""
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(svc.UDN(), "uuid:"), "_MR")
+}
+
+func wireString(name xml.Name, val string) *string {
+	if "" == name.Local {
+		return nil
+	}
+	return &val
+}
+
+func wireUint32(name xml.Name, val string) *uint32 {
+	if "" == name.Local {
+		return nil
+	}
+	n, _ := strconv.ParseUint(val, 10, 32)
+	out := uint32(n)
+	return &out
+}
+
+func wireInt(name xml.Name, val string) *int {
+	if "" == name.Local {
+		return nil
+	}
+	n, _ := strconv.Atoi(val)
+	return &n
+}
+
+func wireBool(name xml.Name, val string) *bool {
+	if "" == name.Local {
+		return nil
+	}
+	b := "1" == val || "true" == strings.ToLower(val)
+	return &b
+}
+
+func GetTransportEventMessage(evt *upnp.AVTransportEvent) *TransportEventMessage {
+	change := &evt.LastChange.InstanceID
+	out := &TransportEventMessage{
+		UUID:                 wireEventUUID(evt.Svc),
+		TransportState:       wireString(change.TransportState.XMLName, change.TransportState.Val),
+		TransportStatus:      wireString(change.TransportStatus.XMLName, change.TransportStatus.Val),
+		PlayMode:             wireString(change.CurrentPlayMode.XMLName, change.CurrentPlayMode.Val),
+		CrossfadeMode:        wireBool(change.CurrentCrossfadeMode.XMLName, change.CurrentCrossfadeMode.Val),
+		NumberOfTracks:       wireUint32(change.NumberOfTracks.XMLName, change.NumberOfTracks.Val),
+		CurrentTrack:         wireUint32(change.CurrentTrack.XMLName, change.CurrentTrack.Val),
+		CurrentSection:       wireUint32(change.CurrentSection.XMLName, change.CurrentSection.Val),
+		CurrentTrackURI:      wireString(change.CurrentTrackURI.XMLName, change.CurrentTrackURI.Val),
+		NextTrackURI:         wireString(change.NextTrackURI.XMLName, change.NextTrackURI.Val),
+		AVTransportURI:       wireString(change.AVTransportURI.XMLName, change.AVTransportURI.Val),
+		SleepTimerGeneration: wireUint32(change.SleepTimerGeneration.XMLName, change.SleepTimerGeneration.Val),
+		AlarmRunning:         wireBool(change.AlarmRunning.XMLName, change.AlarmRunning.Val),
+		SnoozeRunning:        wireBool(change.SnoozeRunning.XMLName, change.SnoozeRunning.Val),
+		RestartPending:       wireBool(change.RestartPending.XMLName, change.RestartPending.Val),
+	}
+	if "" != change.CurrentTrackDuration.XMLName.Local {
+		ms := wireTimeMillis(change.CurrentTrackDuration.Val)
+		out.CurrentTrackDuration = &ms
+	}
+	if "" != change.CurrentTrackMetaData.Val {
+		metadata := &didl.Lite{}
+		if nil == xml.Unmarshal([]byte(change.CurrentTrackMetaData.Val), metadata) {
+			if objects := ObjectStream(metadata); 0 < len(objects) {
+				out.CurrentTrackMetaData = makeObjectMessage(objects[0])
+			}
+		}
+	}
+	return out
+}
+
+func GetRenderingEventMessage(evt *upnp.RenderingControlEvent) *RenderingEventMessage {
+	change := &evt.LastChange.InstanceID
+	out := &RenderingEventMessage{
+		UUID: wireEventUUID(evt.Svc),
+	}
+	for _, v := range change.Volume {
+		if nil == out.Volume {
+			out.Volume = make(map[string]uint16)
+		}
+		n, _ := strconv.ParseUint(v.Val, 10, 16)
+		out.Volume[v.Channel] = uint16(n)
+	}
+	for _, v := range change.Mute {
+		if nil == out.Mute {
+			out.Mute = make(map[string]bool)
+		}
+		out.Mute[v.Channel] = "1" == v.Val
+	}
+	for _, v := range change.Loudness {
+		if nil == out.Loudness {
+			out.Loudness = make(map[string]bool)
+		}
+		out.Loudness[v.Channel] = "1" == v.Val
+	}
+	if 0 < len(change.Bass) {
+		out.Bass = wireInt(change.Bass[0].XMLName, change.Bass[0].Val)
+	}
+	if 0 < len(change.Treble) {
+		out.Treble = wireInt(change.Treble[0].XMLName, change.Treble[0].Val)
+	}
+	if 0 < len(change.OutputFixed) {
+		out.OutputFixed = wireBool(change.OutputFixed[0].XMLName, change.OutputFixed[0].Val)
+	}
+	if 0 < len(change.HeadphoneConnected) {
+		out.HeadphoneConnected = wireBool(change.HeadphoneConnected[0].XMLName, change.HeadphoneConnected[0].Val)
+	}
+	return out
+}
+
+// A device found by discovery, the "device" definition of schema.json
+type DeviceMessage struct {
+	UUID           string   `json:"uuid"`
+	Name           string   `json:"name"`
+	Product        string   `json:"product"`
+	ProductVersion string   `json:"productVersion,omitempty"`
+	Location       string   `json:"location"`
+	Services       []string `json:"services,omitempty"`
+	LastSeenMs     int64    `json:"lastSeenMs,omitempty"`
+	Interface      string   `json:"interface,omitempty"`
+	LocalAddr      string   `json:"localAddr,omitempty"`
+}
+
+func GetDeviceMessage(dev ssdp.Device) *DeviceMessage {
+	out := &DeviceMessage{
+		UUID:           string(dev.UUID()),
+		Name:           dev.Name(),
+		Product:        dev.Product(),
+		ProductVersion: dev.ProductVersion(),
+		Location:       string(dev.Location()),
+		Interface:      dev.Interface(),
+	}
+	for _, key := range dev.Services() {
+		out.Services = append(out.Services, string(key))
+	}
+	sort.Strings(out.Services)
+	if seen := dev.LastSeen(); !seen.IsZero() {
+		out.LastSeenMs = seen.UnixNano() / int64(time.Millisecond)
+	}
+	if addr := dev.LocalAddr(); nil != addr {
+		out.LocalAddr = addr.String()
+	}
+	return out
+}
+
+// The children of a container beginning with one prefix, the "prefixEntry" definition of schema.json
+type PrefixEntryMessage struct {
+	Prefix        string `json:"prefix"`
+	StartingIndex uint32 `json:"startingIndex"`
+	Count         uint32 `json:"count"`
+}
+
+// An alphabetical index of a container, the "prefixIndex" definition of schema.json
+type PrefixIndexMessage struct {
+	ObjectID     string               `json:"objectId"`
+	UpdateID     uint32               `json:"updateId"`
+	TotalMatches uint32               `json:"totalMatches"`
+	Entries      []PrefixEntryMessage `json:"entries"`
+}
+
+func GetPrefixIndexMessage(in *upnp.PrefixIndex) *PrefixIndexMessage {
+	out := &PrefixIndexMessage{
+		ObjectID:     in.ObjectID,
+		UpdateID:     in.UpdateID,
+		TotalMatches: in.TotalMatches,
+		Entries:      []PrefixEntryMessage{},
+	}
+	for _, entry := range in.Entries {
+		out.Entries = append(out.Entries, PrefixEntryMessage{
+			Prefix:        entry.Prefix,
+			StartingIndex: entry.StartingIndex,
+			Count:         entry.Count,
+		})
+	}
+	return out
+}
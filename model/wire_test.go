@@ -0,0 +1,172 @@
+//
+// go-sonos
+// ========
+//
+// Copyright (c) 2012, Ian T. Richards <ianr@panix.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//   * Redistributions of source code must retain the above copyright notice,
+//     this list of conditions and the following disclaimer.
+//   * Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+// TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package model
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"github.com/ianr0bkny/go-sonos/upnp"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Checks that @value encodes as @golden
+func testWire(t *testing.T, value interface{}, golden string) {
+	if data, err := json.Marshal(value); nil != err {
+		t.Error(err)
+	} else if golden != string(data) {
+		t.Errorf("Encoded as %s\nexpected %s", data, golden)
+	}
+}
+
+func TestPositionInfoWire(t *testing.T) {
+	tests := []struct {
+		in     PositionInfo
+		golden string
+	}{
+		{PositionInfo{
+			Track:               3,
+			TrackDuration:       4 * time.Minute,
+			TrackURI:            "x-file-cifs://nas/music/a.flac",
+			RelTime:             time.Minute + 500*time.Millisecond,
+			Remaining:           3*time.Minute - 500*time.Millisecond,
+			PercentComplete:     25,
+			ProtocolInfo:        "x-file-cifs:*:audio/flac:*",
+			Title:               "Help!",
+			Class:               "object.item.audioItem.musicTrack",
+			Creator:             "The Beatles",
+			Album:               "Help!",
+			OriginalTrackNumber: "1",
+		}, `{"track":3,"trackDurationMs":240000,"trackUri":"x-file-cifs://nas/music/a.flac",` +
+			`"relTimeMs":60500,"remainingMs":179500,"percentComplete":25,"protocolInfo":"x-file-cifs:*:audio/flac:*",` +
+			`"title":"Help!","class":"object.item.audioItem.musicTrack","creator":"The Beatles","album":"Help!",` +
+			`"originalTrackNumber":"1"}`},
+		// A stream: the durations are sent as zero, the strings omitted
+		{PositionInfo{Track: 1}, `{"track":1,"trackDurationMs":0,"relTimeMs":0,"remainingMs":0,"percentComplete":0}`},
+	}
+	for _, test := range tests {
+		testWire(t, test.in, test.golden)
+		testWire(t, &test.in, test.golden)
+		out := PositionInfo{}
+		if err := json.Unmarshal([]byte(test.golden), &out); nil != err {
+			t.Error(err)
+		} else if !reflect.DeepEqual(test.in, out) {
+			t.Errorf("Decoded %s as %+v", test.golden, out)
+		}
+	}
+	testWire(t, MakeEnvelope(&PositionInfo{Track: 1}), `{"version":1,"type":"positionInfo",`+
+		`"value":{"track":1,"trackDurationMs":0,"relTimeMs":0,"remainingMs":0,"percentComplete":0}}`)
+	if err := json.Unmarshal([]byte(`{"track":"1"}`), &PositionInfo{}); nil == err {
+		t.Error("Decoded a string track number")
+	}
+}
+
+func TestAlarmListWire(t *testing.T) {
+	tests := []struct {
+		list   string
+		golden string
+	}{
+		{`<Alarms><Alarm ID="4" StartTime="07:00:00" Duration="02:00:00" Recurrence="WEEKDAYS" Enabled="1" ` +
+			`RoomUUID="RINCON_000E58000001" ProgramURI="x-rincon-buzzer:0" ProgramMetaData="" ` +
+			`PlayMode="SHUFFLE_NOREPEAT" Volume="25" IncludeLinkedZones="0"/>` +
+			`<Alarm ID="5" StartTime="22:30:00" Duration="" Recurrence="ON_06" Enabled="0" ` +
+			`RoomUUID="RINCON_000E58000002" ProgramURI="" ProgramMetaData="" PlayMode="NORMAL" Volume="10" ` +
+			`IncludeLinkedZones="1"/></Alarms>`,
+			`{"version":"RINCON_000E58000001:12","alarms":[` +
+				`{"id":4,"startTime":"07:00:00","durationMs":7200000,"recurrence":"WEEKDAYS","enabled":true,` +
+				`"roomUuid":"RINCON_000E58000001","programUri":"x-rincon-buzzer:0","playMode":"SHUFFLE_NOREPEAT",` +
+				`"volume":25,"includeLinkedZones":false},` +
+				`{"id":5,"startTime":"22:30:00","recurrence":"ON_06","enabled":false,` +
+				`"roomUuid":"RINCON_000E58000002","playMode":"NORMAL","volume":10,"includeLinkedZones":true}]}`},
+		// No alarms are sent as an empty list, not null
+		{`<Alarms></Alarms>`, `{"version":"RINCON_000E58000001:12","alarms":[]}`},
+	}
+	for _, test := range tests {
+		out, err := GetAlarmListMessage(test.list, "RINCON_000E58000001:12")
+		if nil != err {
+			t.Error(err)
+			continue
+		}
+		testWire(t, out, test.golden)
+	}
+}
+
+func TestAlarmListMalformed(t *testing.T) {
+	for _, list := range []string{"", `<Alarms><Alarm ID="4"`, `<Alarms><Alarm ID="four"/></Alarms>`} {
+		out, err := GetAlarmListMessage(list, "7")
+		if nil == err || !strings.HasPrefix(err.Error(), "Malformed alarm list: ") {
+			t.Errorf("%q: error %v", list, err)
+		}
+		// The message is still well formed, for the envelope's sake
+		testWire(t, out, `{"version":"7","alarms":[]}`)
+	}
+}
+
+// The event for a LastChange naming the elements of @instance
+func testTransportEvent(t *testing.T, instance string) *upnp.AVTransportEvent {
+	var lastChange strings.Builder
+	xml.EscapeText(&lastChange, []byte(`<Event xmlns="urn:schemas-upnp-org:metadata-1-0/AVT/">`+
+		`<InstanceID val="0">`+instance+`</InstanceID></Event>`))
+	channel := make(chan upnp.Event, 1)
+	var avt upnp.AVTransport
+	if err := avt.HandleProperty(nil, "<LastChange>"+lastChange.String()+"</LastChange>", channel); nil != err {
+		t.Fatal(err)
+	}
+	avt.EndSet(nil, channel)
+	evt := (<-channel).(upnp.AVTransportEvent)
+	return &evt
+}
+
+func TestTransportEventWire(t *testing.T) {
+	tests := []struct {
+		instance string
+		golden   string
+	}{
+		// The end of the queue clears NextTrackURI, which is sent as
+		// empty; the variables the event does not name are omitted
+		{`<TransportState val="PLAYING"/><CurrentTrack val="12"/><CurrentTrackDuration val="0:03:30"/>` +
+			`<NextTrackURI val=""/>`,
+			`{"uuid":"","transportState":"PLAYING","currentTrack":12,"currentTrackDurationMs":210000,"nextTrackUri":""}`},
+		{`<CurrentPlayMode val="REPEAT_ALL"/><CurrentCrossfadeMode val="1"/><NumberOfTracks val="40"/>` +
+			`<AVTransportURI val="x-rincon-queue:RINCON_000E58000001#0"/><SleepTimerGeneration val="0"/>` +
+			`<AlarmRunning val="0"/><SnoozeRunning val="0"/><RestartPending val="0"/>`,
+			`{"uuid":"","playMode":"REPEAT_ALL","crossfadeMode":true,"numberOfTracks":40,` +
+				`"avTransportUri":"x-rincon-queue:RINCON_000E58000001#0","sleepTimerGeneration":0,` +
+				`"alarmRunning":false,"snoozeRunning":false,"restartPending":false}`},
+		{``, `{"uuid":""}`},
+	}
+	for _, test := range tests {
+		out := GetTransportEventMessage(testTransportEvent(t, test.instance))
+		testWire(t, out, test.golden)
+		testWire(t, MakeEnvelope(out), `{"version":1,"type":"transportEvent","value":`+test.golden+`}`)
+	}
+}
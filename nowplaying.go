@@ -0,0 +1,405 @@
+//
+// go-sonos
+// ========
+//
+// Copyright (c) 2012, Ian T. Richards <ianr@panix.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//   * Redistributions of source code must retain the above copyright notice,
+//     this list of conditions and the following disclaimer.
+//   * Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+// TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package sonos
+
+import (
+	"encoding/xml"
+	"github.com/ianr0bkny/go-sonos/didl"
+	"github.com/ianr0bkny/go-sonos/ssdp"
+	"github.com/ianr0bkny/go-sonos/upnp"
+	"github.com/ianr0bkny/go-sonos/uri"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//
+// What a group is playing, merged from its transport's position, media
+// and state and from the DIDL-Lite metadata that comes with them.
+//
+type NowPlaying struct {
+	// The kind of source the group plays from
+	Source uri.Kind
+	// The transport URI: the queue, station, input and so on
+	URI      string
+	TrackURI string
+	// True for radio and other live streams.  Station and Show then
+	// describe the stream; Title, Artist and Album what it plays now,
+	// where the station says.
+	IsStream bool
+	Station  string
+	Show     string
+	Title    string
+	Artist   string
+	Album    string
+	// The album art as an absolute http URL, if there is any
+	ArtURL string
+	// The track number within the queue
+	Track    uint32
+	Position time.Duration
+	Duration time.Duration
+	// One of the upnp.State_* values
+	State    string
+	PlayMode string
+	// When Position was read
+	at time.Time
+	// True once AVTransport events have been received for the player
+	live bool
+	// True when an event may have moved Position in a way it does not
+	// say, so that it must be read again
+	stale bool
+}
+
+//
+// Splits the song a station reports in <r:streamContent>, given either as
+// "Artist - Title" or as "TYPE=SNG|TITLE ...|ARTIST ...|ALBUM ...".
+//
+func nowPlayingStreamContent(content string) (title, artist, album string) {
+	if strings.HasPrefix(content, "TYPE=") {
+		for _, field := range strings.Split(content, "|") {
+			kv := strings.SplitN(field, " ", 2)
+			if 2 != len(kv) {
+				continue
+			}
+			switch kv[0] {
+			case "TITLE":
+				title = kv[1]
+			case "ARTIST":
+				artist = kv[1]
+			case "ALBUM":
+				album = kv[1]
+			}
+		}
+		return
+	}
+	if parts := strings.SplitN(content, " - ", 2); 2 == len(parts) {
+		return parts[1], parts[0], ""
+	}
+	return content, "", ""
+}
+
+func nowPlayingItem(metadata string) *didl.Item {
+	doc := didl.Lite{}
+	if err := xml.Unmarshal([]byte(metadata), &doc); nil != err || 0 == len(doc.Item) {
+		return nil
+	}
+	return &doc.Item[0]
+}
+
+// The base that relative art URIs are resolved against
+func nowPlayingBase(player *Player) *url.URL {
+	base, err := url.Parse(string(player.Location))
+	if nil != err {
+		return nil
+	}
+	return &url.URL{Scheme: base.Scheme, Host: base.Host}
+}
+
+// Applies the transport URI and its metadata
+func (this *NowPlaying) setMedia(current, metadata string) {
+	this.URI = current
+	this.Source = uri.Kind_Unknown
+	if u, err := uri.Parse(current); nil == err {
+		this.Source = u.Kind
+	}
+	this.IsStream = uri.Kind_Radio == this.Source
+	this.Station = ""
+	if item := nowPlayingItem(metadata); nil != item {
+		if 0 < len(item.Class) && didl.Class_AudioBroadcast == item.Class[0].Value {
+			this.IsStream = true
+		}
+		if this.IsStream && 0 < len(item.Title) {
+			this.Station = item.Title[0].Value
+		}
+	}
+}
+
+// Applies the metadata of the current track
+func (this *NowPlaying) setTrack(base *url.URL, metadata string) {
+	this.Title, this.Artist, this.Album, this.ArtURL, this.Show = "", "", "", "", ""
+	item := nowPlayingItem(metadata)
+	if nil == item {
+		return
+	}
+	if 0 < len(item.Title) {
+		this.Title = item.Title[0].Value
+	}
+	if 0 < len(item.Creator) {
+		this.Artist = item.Creator[0].Value
+	} else if 0 < len(item.Artist) {
+		this.Artist = item.Artist[0].Value
+	}
+	if 0 < len(item.Album) {
+		this.Album = item.Album[0].Value
+	}
+	if 0 < len(item.AlbumArtURI) && "" != item.AlbumArtURI[0].Value {
+		this.ArtURL = item.AlbumArtURI[0].Value
+		if ref, err := url.Parse(this.ArtURL); nil == err && nil != base {
+			this.ArtURL = base.ResolveReference(ref).String()
+		}
+	}
+	if 0 < len(item.RadioShowMd) {
+		// Given as "Show name,p123456"
+		this.Show = strings.SplitN(item.RadioShowMd[0].Value, ",p", 2)[0]
+	}
+	// Sonos reports its own status (ZPSTR_CONNECTING etc.) the same way
+	if 0 < len(item.StreamContent) && !strings.HasPrefix(item.StreamContent[0].Value, "ZPSTR_") {
+		content := item.StreamContent[0].Value
+		if "" != content {
+			this.IsStream = true
+			this.Title, this.Artist, this.Album = nowPlayingStreamContent(content)
+		}
+	}
+}
+
+// The position now, counting on from when it was read while playing
+func (this *NowPlaying) position(now time.Time) time.Duration {
+	pos := this.Position
+	if upnp.State_PLAYING == this.State && !this.at.IsZero() {
+		pos += now.Sub(this.at)
+		if 0 < this.Duration && pos > this.Duration {
+			pos = this.Duration
+		}
+	}
+	return pos
+}
+
+// A copy with Position brought up to date
+func (this *NowPlaying) current() *NowPlaying {
+	now := time.Now()
+	np := *this
+	np.Position = this.position(now)
+	np.at = now
+	return &np
+}
+
+//
+// Returns what the room's group is playing.  Once WatchPlayback() has
+// subscribed the household to AVTransport events, and those events are
+// passed to Household.HandleEvent(), the answer comes from them without
+// asking the coordinator, save for the position after an event that
+// changes the transport state or the track number without giving it;
+// otherwise the coordinator is asked each time.
+//
+func (this *Zone) NowPlaying() (np *NowPlaying, err error) {
+	var coordinator *Player
+	if coordinator, err = this.coordinatorPlayer(); nil != err {
+		return
+	}
+	if np = this.household.nowPlaying(coordinator.UUID); nil != np {
+		if !np.stale {
+			return
+		}
+		var position *upnp.PositionInfo
+		if err = this.withCoordinator(func(s *Sonos) (err error) {
+			position, err = s.AVTransport.GetPositionInfo(0)
+			return
+		}); nil != err {
+			return nil, err
+		}
+		return this.household.refreshPosition(coordinator.UUID, position), nil
+	}
+	np = &NowPlaying{}
+	err = this.withCoordinator(func(s *Sonos) (err error) {
+		var media *upnp.MediaInfo
+		var position *upnp.PositionInfo
+		var transport *upnp.TransportInfo
+		var settings *upnp.TransportSettings
+		if media, err = s.AVTransport.GetMediaInfo(0); nil != err {
+			return
+		} else if position, err = s.AVTransport.GetPositionInfo(0); nil != err {
+			return
+		} else if transport, err = s.AVTransport.GetTransportInfo(0); nil != err {
+			return
+		} else if settings, err = s.AVTransport.GetTransportSettings(0); nil != err {
+			return
+		}
+		if coordinator, err = this.coordinatorPlayer(); nil != err {
+			return
+		}
+		np.setMedia(media.CurrentURI, media.CurrentURIMetaData)
+		np.setTrack(nowPlayingBase(coordinator), position.TrackMetaData)
+		np.TrackURI = position.TrackURI
+		np.Track = position.Track
+		np.Duration, _ = upnp.ParseTime(position.TrackDuration)
+		np.Position, _ = upnp.ParseTime(position.RelTime)
+		np.at = time.Now()
+		np.State = transport.CurrentTransportState
+		np.PlayMode = settings.PlayMode
+		return
+	})
+	if nil != err {
+		return nil, err
+	}
+	this.household.lock.Lock()
+	if nil == this.household.playing {
+		this.household.playing = make(map[ssdp.UUID]*NowPlaying)
+	}
+	if old := this.household.playing[coordinator.UUID]; nil == old || !old.live {
+		this.household.playing[coordinator.UUID] = np
+	}
+	this.household.lock.Unlock()
+	return np.current(), nil
+}
+
+// Returns what @uuid is playing, if events are keeping it current
+func (this *Household) nowPlaying(uuid ssdp.UUID) *NowPlaying {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	if np := this.playing[uuid]; nil != np && np.live {
+		return np.current()
+	}
+	return nil
+}
+
+//
+// Applies @position, read because events left the position of @uuid
+// stale, unless the track has changed again since, and returns what
+// @uuid is playing.
+//
+func (this *Household) refreshPosition(uuid ssdp.UUID, position *upnp.PositionInfo) *NowPlaying {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	np := this.playing[uuid]
+	if position.TrackURI == np.TrackURI {
+		np.Position, _ = upnp.ParseTime(position.RelTime)
+		if duration, err := upnp.ParseTime(position.TrackDuration); nil == err {
+			np.Duration = duration
+		}
+		np.at = time.Now()
+		np.stale = false
+	}
+	return np.current()
+}
+
+//
+// Subscribes @reactor to the AVTransport events of every player not
+// already watched, so that passing the events read from the reactor to
+// HandleEvent() keeps Zone.NowPlaying() current.  Call it again after
+// the topology changes to watch players that have joined.
+//
+func (this *Household) WatchPlayback(reactor upnp.Reactor) (err error) {
+	for _, room := range this.Rooms() {
+		this.lock.RLock()
+		_, has := this.watched[room.Main.UUID]
+		this.lock.RUnlock()
+		if has {
+			continue
+		}
+		sonos, cerr := room.Main.Connect(reactor, SVC_AV_TRANSPORT)
+		if nil != cerr {
+			if nil == err {
+				err = cerr
+			}
+			continue
+		}
+		this.lock.Lock()
+		if nil == this.watched {
+			this.watched = make(map[ssdp.UUID]*Sonos)
+		}
+		this.watched[room.Main.UUID] = sonos
+		this.lock.Unlock()
+	}
+	return
+}
+
+// Applies an AVTransport event to what the sending player is playing
+func (this *Household) handlePlayback(evt upnp.AVTransportEvent) bool {
+	if nil == evt.Svc {
+		return false
+	}
+	udn := strings.TrimPrefix(evt.Svc.UDN(), "uuid:")
+	// The transport belongs to the player's MediaRenderer (RINCON_..._MR)
+	if i := strings.LastIndex(udn, "_M"); 0 < i {
+		udn = udn[:i]
+	}
+	player := this.Player(ssdp.UUID(udn))
+	if nil == player {
+		return false
+	}
+	change := &evt.LastChange.InstanceID
+	// Elements absent from the change are left as they were
+	has := func(name xml.Name) bool {
+		return "" != name.Local
+	}
+	now := time.Now()
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if nil == this.playing {
+		this.playing = make(map[ssdp.UUID]*NowPlaying)
+	}
+	// A new entry, a change of state (which a seek passes through) and a
+	// move to another track in the queue all move the position without
+	// the event saying where to.  Sonos repeats CurrentTrackURI in most
+	// changes, so that alone says nothing.
+	np := &NowPlaying{stale: true}
+	if old := this.playing[player.UUID]; nil != old {
+		*np = *old
+	}
+	np.Position, np.at = np.position(now), now
+	if has(change.TransportState.XMLName) {
+		if change.TransportState.Val != np.State {
+			np.stale = true
+		}
+		np.State = change.TransportState.Val
+	}
+	if has(change.CurrentPlayMode.XMLName) {
+		np.PlayMode = change.CurrentPlayMode.Val
+	}
+	if has(change.AVTransportURI.XMLName) {
+		np.setMedia(change.AVTransportURI.Val, change.AVTransportURIMetaData.Val)
+	}
+	if has(change.CurrentTrack.XMLName) {
+		if n, err := strconv.ParseUint(change.CurrentTrack.Val, 10, 32); nil == err {
+			if uint32(n) != np.Track {
+				np.stale = true
+			}
+			np.Track = uint32(n)
+		}
+	}
+	if has(change.CurrentTrackURI.XMLName) {
+		if change.CurrentTrackURI.Val != np.TrackURI {
+			np.Position = 0
+		}
+		np.TrackURI = change.CurrentTrackURI.Val
+	}
+	if has(change.CurrentTrackDuration.XMLName) {
+		np.Duration, _ = upnp.ParseTime(change.CurrentTrackDuration.Val)
+	}
+	if has(change.CurrentTrackMetaData.XMLName) {
+		np.IsStream = uri.Kind_Radio == np.Source
+		np.setTrack(nowPlayingBase(player), change.CurrentTrackMetaData.Val)
+	}
+	np.live = true
+	this.playing[player.UUID] = np
+	return true
+}
@@ -0,0 +1,134 @@
+//
+// go-sonos
+// ========
+//
+// Copyright (c) 2012, Ian T. Richards <ianr@panix.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//   * Redistributions of source code must retain the above copyright notice,
+//     this list of conditions and the following disclaimer.
+//   * Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+// TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package sonos
+
+import (
+	"encoding/xml"
+	"github.com/ianr0bkny/go-sonos/ssdp"
+	"github.com/ianr0bkny/go-sonos/upnp"
+	"strings"
+	"testing"
+)
+
+// A household of one player, RINCON_1 in the Kitchen
+func testKitchen(t *testing.T) *Household {
+	groups, err := upnp.ParseZoneGroupState(`<ZoneGroups><ZoneGroup Coordinator="RINCON_1" ID="RINCON_1:1">` +
+		`<ZoneGroupMember UUID="RINCON_1" Location="http://127.0.0.1:1400/xml/device_description.xml" ZoneName="Kitchen"/>` +
+		`</ZoneGroup></ZoneGroups>`)
+	if nil != err {
+		t.Fatal(err)
+	}
+	household := &Household{}
+	household.update(groups)
+	return household
+}
+
+//
+// The event @svc sends for a LastChange naming the elements of
+// @instance, as the reactor would deliver it.
+//
+func testPlaybackEvent(t *testing.T, svc *upnp.Service, instance string) upnp.AVTransportEvent {
+	var lastChange strings.Builder
+	xml.EscapeText(&lastChange, []byte(`<Event xmlns="urn:schemas-upnp-org:metadata-1-0/AVT/">`+
+		`<InstanceID val="0">`+instance+`</InstanceID></Event>`))
+	channel := make(chan upnp.Event, 1)
+	var avt upnp.AVTransport
+	if err := avt.HandleProperty(svc, "<LastChange>"+lastChange.String()+"</LastChange>", channel); nil != err {
+		t.Fatal(err)
+	}
+	avt.EndSet(svc, channel)
+	return (<-channel).(upnp.AVTransportEvent)
+}
+
+func TestNowPlayingStale(t *testing.T) {
+	household := testKitchen(t)
+	svc := testDevice(t, "uuid:RINCON_1_MR", map[string][]string{"AVTransport": nil}, nil)["AVTransport"][0]
+	steps := []struct {
+		instance string
+		stale    bool
+	}{
+		// A new entry
+		{`<TransportState val="PLAYING"/><CurrentTrack val="1"/><CurrentTrackURI val="x-file-cifs://nas/a.flac"/>` +
+			`<CurrentTrackDuration val="0:03:00"/>`, true},
+		// Sonos repeats the track URI in most changes
+		{`<TransportState val="PLAYING"/><CurrentTrack val="1"/><CurrentTrackURI val="x-file-cifs://nas/a.flac"/>`, false},
+		{`<CurrentTrackURI val="x-file-cifs://nas/a.flac"/><CurrentTrackDuration val="0:03:00"/>`, false},
+		{`<CurrentPlayMode val="SHUFFLE"/>`, false},
+		// A seek passes through TRANSITIONING
+		{`<TransportState val="TRANSITIONING"/>`, true},
+		{`<TransportState val="PLAYING"/>`, true},
+		{`<TransportState val="PAUSED_PLAYBACK"/><CurrentTrackURI val="x-file-cifs://nas/a.flac"/>`, true},
+		// The next track in the queue
+		{`<CurrentTrack val="2"/><CurrentTrackURI val="x-file-cifs://nas/b.flac"/>`, true},
+		// The same track again, as with repeat one
+		{`<CurrentTrack val="3"/><CurrentTrackURI val="x-file-cifs://nas/b.flac"/>`, true},
+	}
+	uuid := ssdp.UUID("RINCON_1")
+	for i, step := range steps {
+		if !household.handlePlayback(testPlaybackEvent(t, svc, step.instance)) {
+			t.Fatalf("Step %d: event not applied", i)
+		}
+		np := household.playing[uuid]
+		if step.stale != np.stale {
+			t.Errorf("Step %d: stale %v, expected %v", i, np.stale, step.stale)
+		}
+		// As Zone.NowPlaying() would on finding it stale
+		household.refreshPosition(uuid, &upnp.PositionInfo{TrackURI: np.TrackURI, RelTime: "0:01:00"})
+	}
+	np := household.nowPlaying(uuid)
+	if "PAUSED_PLAYBACK" != np.State || "SHUFFLE" != np.PlayMode || 3 != np.Track ||
+		"x-file-cifs://nas/b.flac" != np.TrackURI || 3*60e9 != np.Duration {
+		t.Errorf("Now playing %+v", np)
+	}
+}
+
+func TestNowPlayingNewTrack(t *testing.T) {
+	household := testKitchen(t)
+	svc := testDevice(t, "uuid:RINCON_1_MR", map[string][]string{"AVTransport": nil}, nil)["AVTransport"][0]
+	uuid := ssdp.UUID("RINCON_1")
+	household.handlePlayback(testPlaybackEvent(t, svc,
+		`<TransportState val="PAUSED_PLAYBACK"/><CurrentTrack val="1"/><CurrentTrackURI val="x-file-cifs://nas/a.flac"/>`))
+	household.refreshPosition(uuid, &upnp.PositionInfo{TrackURI: "x-file-cifs://nas/a.flac", RelTime: "0:01:00"})
+	household.handlePlayback(testPlaybackEvent(t, svc, `<CurrentTrackURI val="x-file-cifs://nas/b.flac"/>`))
+	if np := household.nowPlaying(uuid); 0 != np.Position || np.stale {
+		t.Errorf("Position %v, stale %v", np.Position, np.stale)
+	}
+}
+
+func TestNowPlayingUnknownPlayer(t *testing.T) {
+	household := testKitchen(t)
+	svc := testDevice(t, "uuid:RINCON_2_MR", map[string][]string{"AVTransport": nil}, nil)["AVTransport"][0]
+	if household.handlePlayback(testPlaybackEvent(t, svc, `<TransportState val="PLAYING"/>`)) {
+		t.Error("Applied an event from a player outside the household")
+	}
+	if nil != household.nowPlaying(ssdp.UUID("RINCON_1")) {
+		t.Error("Now playing without an event")
+	}
+}
@@ -0,0 +1,202 @@
+//
+// go-sonos
+// ========
+//
+// Copyright (c) 2012, Ian T. Richards <ianr@panix.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//   * Redistributions of source code must retain the above copyright notice,
+//     this list of conditions and the following disclaimer.
+//   * Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+// TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package sonos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ianr0bkny/go-sonos/model"
+	"github.com/ianr0bkny/go-sonos/upnp"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// The kinds of object Search() looks for, each an attribute container
+const (
+	SearchKind_Artists   = ObjectID_Attribute_Artist
+	SearchKind_Albums    = ObjectID_Attribute_Album
+	SearchKind_Tracks    = ObjectID_Attribute_Tracks
+	SearchKind_Composers = ObjectID_Attribute_Composers
+	SearchKind_Genres    = ObjectID_Attribute_Genres
+	SearchKind_Playlists = ObjectID_Attribute_Playlists
+)
+
+// How the title of an object must match the search term
+const (
+	// The title, or a word in it, begins with the term
+	MatchMode_Prefix = iota
+	// The term appears anywhere in the title
+	MatchMode_Substring
+	// The title is the term
+	MatchMode_Exact
+)
+
+// Ranks of a match, best first; see searchRank()
+const (
+	searchRank_Exact = iota
+	searchRank_Prefix
+	searchRank_WordPrefix
+	searchRank_Substring
+	searchRank_None
+)
+
+type SearchOptions struct {
+	// One of the MatchMode_* constants
+	Mode int
+	// Titles and the term are compared ignoring case unless this is set
+	CaseSensitive bool
+	// The page of ranked results to return: Count results from the
+	// Start'th, or all of them from the Start'th when Count is zero.  A
+	// negative Start is taken as zero.
+	Start, Count int
+}
+
+type SearchResult struct {
+	// The matches in the requested page, best first
+	Objects []model.Object
+	// The number of matches across all pages
+	Total int
+}
+
+//
+// How well @title matches @term: exactly, as a prefix, as a prefix of a
+// word after the first, or as a substring, or searchRank_None if not at
+// all.  Both are expected to be case-folded already if required.
+//
+func searchRank(title, term string) int {
+	switch {
+	case title == term:
+		return searchRank_Exact
+	case strings.HasPrefix(title, term):
+		return searchRank_Prefix
+	}
+	if words := strings.Fields(title); 1 < len(words) {
+		for _, word := range words[1:] {
+			if strings.HasPrefix(word, term) {
+				return searchRank_WordPrefix
+			}
+		}
+	}
+	if strings.Contains(title, term) {
+		return searchRank_Substring
+	}
+	return searchRank_None
+}
+
+// The worst rank accepted by @mode
+func searchWorstRank(mode int) int {
+	switch mode {
+	case MatchMode_Exact:
+		return searchRank_Exact
+	case MatchMode_Substring:
+		return searchRank_Substring
+	}
+	return searchRank_WordPrefix
+}
+
+//
+// Search the music library for @kind (one of the SearchKind_* constants)
+// with titles matching @term.  @opts may be nil for a case-insensitive
+// prefix search returning every match.
+//
+// Prefix and exact searches browse @kind:@term (e.g. A:ARTIST:beat), so
+// the player does the matching over the whole library; substring searches
+// must browse all of @kind and match here.  Either way the results are
+// ranked, exact matches first, then titles beginning with @term, titles
+// with a later word beginning with it, and finally other substrings, and
+// alphabetically within each rank.
+//
+func (this *Sonos) Search(kind, term string, opts *SearchOptions) (result *SearchResult, err error) {
+	if nil == opts {
+		opts = &SearchOptions{}
+	}
+	switch kind {
+	case SearchKind_Artists, SearchKind_Albums, SearchKind_Tracks,
+		SearchKind_Composers, SearchKind_Genres, SearchKind_Playlists:
+	default:
+		return nil, errors.New(fmt.Sprintf("Cannot search for `%s'", kind))
+	}
+	objectId := kind
+	if "" != term && MatchMode_Substring != opts.Mode {
+		objectId = strings.Join([]string{kind, url.PathEscape(term)}, ":")
+	}
+	var browseResult *upnp.BrowseResult
+	req := &upnp.BrowseRequest{
+		ObjectID:     objectId,
+		BrowseFlag:   upnp.BrowseFlag_BrowseDirectChildren,
+		Filter:       upnp.BrowseFilter_All,
+		SortCriteria: upnp.BrowseSortCriteria_None,
+	}
+	if browseResult, err = this.BrowseAll(context.Background(), req); nil != err {
+		return
+	}
+
+	fold := func(s string) string {
+		if opts.CaseSensitive {
+			return s
+		}
+		return strings.ToLower(s)
+	}
+	type match struct {
+		obj   model.Object
+		rank  int
+		title string
+	}
+	var matches []match
+	worst := searchWorstRank(opts.Mode)
+	for _, obj := range model.ObjectStream(browseResult.Doc) {
+		title := fold(obj.Title())
+		if rank := searchRank(title, fold(term)); rank <= worst {
+			matches = append(matches, match{obj, rank, title})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].rank != matches[j].rank {
+			return matches[i].rank < matches[j].rank
+		}
+		return matches[i].title < matches[j].title
+	})
+
+	result = &SearchResult{Total: len(matches)}
+	start, end := opts.Start, len(matches)
+	if 0 > start {
+		start = 0
+	}
+	if 0 < opts.Count && start+opts.Count < end {
+		end = start + opts.Count
+	}
+	for i := start; i < end; i++ {
+		result.Objects = append(result.Objects, matches[i].obj)
+	}
+	return
+}
@@ -0,0 +1,268 @@
+//
+// go-sonos
+// ========
+//
+// Copyright (c) 2012, Ian T. Richards <ianr@panix.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//   * Redistributions of source code must retain the above copyright notice,
+//     this list of conditions and the following disclaimer.
+//   * Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+// TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package sonos
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSearchRank(t *testing.T) {
+	tests := []struct {
+		title string
+		term  string
+		rank  int
+	}{
+		{"", "", searchRank_Exact},
+		{"", "beat", searchRank_None},
+		{"   ", "beat", searchRank_None},
+		{"The Beatles", "", searchRank_Prefix},
+		{"beat", "beat", searchRank_Exact},
+		{"beatles", "beat", searchRank_Prefix},
+		{"the beatles", "beat", searchRank_WordPrefix},
+		{"the  beatles ", "beat", searchRank_WordPrefix},
+		{"heartbeat", "beat", searchRank_Substring},
+		{"the heartbeats", "beat", searchRank_Substring},
+		{"abba", "beat", searchRank_None},
+	}
+	for _, test := range tests {
+		if rank := searchRank(test.title, test.term); test.rank != rank {
+			t.Errorf("searchRank(%q, %q) = %d, expected %d", test.title, test.term, rank, test.rank)
+		}
+	}
+}
+
+func TestSearchWorstRank(t *testing.T) {
+	// As Search() folds case before ranking
+	fold := strings.ToLower
+	tests := []struct {
+		title string
+		term  string
+		mode  int
+		match bool
+	}{
+		{"The Beatles", "The Beatles", MatchMode_Exact, true},
+		{"The Beatles", "the beatles", MatchMode_Exact, true},
+		{"The Beatles", "the", MatchMode_Exact, false},
+		{"The Beatles", "BEAT", MatchMode_Prefix, true},
+		{"The Beatles", "the", MatchMode_Prefix, true},
+		{"Heartbeat", "beat", MatchMode_Prefix, false},
+		{"Heartbeat", "beat", MatchMode_Substring, true},
+		{"The Beatles", "beat", MatchMode_Substring, true},
+		{"Abba", "beat", MatchMode_Substring, false},
+		{"", "", MatchMode_Exact, true},
+		{"Abba", "", MatchMode_Exact, false},
+		{"Abba", "", MatchMode_Prefix, true},
+		{"Abba", "", MatchMode_Substring, true},
+	}
+	for _, test := range tests {
+		rank := searchRank(fold(test.title), fold(test.term))
+		if match := rank <= searchWorstRank(test.mode); test.match != match {
+			t.Errorf("%q against %q in mode %d: rank %d", test.title, test.term, test.mode, rank)
+		}
+	}
+	// Without folding a term differing in case does not match
+	if rank := searchRank("The Beatles", "BEAT"); searchRank_None != rank {
+		t.Errorf("Case-sensitive rank is %d", rank)
+	}
+}
+
+// An object in the library served by testLibrary()
+type testObject struct {
+	kind  string
+	id    string
+	title string
+	album string
+}
+
+var testObjects = []testObject{
+	{SearchKind_Artists, "A:ARTIST/Abba", "Abba", ""},
+	{SearchKind_Artists, "A:ARTIST/Beat%20Happening", "Beat Happening", ""},
+	{SearchKind_Artists, "A:ARTIST/beat", "beat", ""},
+	{SearchKind_Artists, "A:ARTIST/Heartbeat", "Heartbeat", ""},
+	{SearchKind_Artists, "A:ARTIST/The%20Beatles", "The Beatles", ""},
+	{SearchKind_Artists, "A:ARTIST/AC%2FDC%3A%20Live", "AC/DC: Live", ""},
+	{SearchKind_Tracks, "S://nas/help/01.flac", "Help!", "Help!"},
+	{SearchKind_Tracks, "S://nas/help/02.flac", "The Night Before", "Help!"},
+	{SearchKind_Tracks, "S://nas/help/07.flac", "help!", "Help!"},
+	{SearchKind_Tracks, "S://nas/1/24.flac", "Help!", "1"},
+	{SearchKind_Tracks, "S://nas/rubber/01.flac", "Help Me Out", "Help!"},
+}
+
+//
+// A player whose ContentDirectory answers Browse from testObjects, two
+// objects a page, matching the term of a KIND:term object ID as the
+// player does: ignoring case, against the start of the title or of any
+// word in it.  The object IDs browsed are appended to the returned
+// slice.
+//
+func testLibrary(t *testing.T) (sonos *Sonos, browsed *[]string) {
+	browsed = new([]string)
+	svc_map := testDevice(t, "uuid:RINCON_1_MS", map[string][]string{"ContentDirectory": {"Browse"}},
+		func(service, action string, body []byte) string {
+			var args struct {
+				ObjectID       string `xml:"Body>Browse>ObjectID"`
+				StartingIndex  int    `xml:"Body>Browse>StartingIndex"`
+				RequestedCount int    `xml:"Body>Browse>RequestedCount"`
+			}
+			if err := xml.Unmarshal(body, &args); nil != err {
+				t.Errorf("Malformed request: %v", err)
+			}
+			*browsed = append(*browsed, args.ObjectID)
+			kind, term := args.ObjectID, ""
+			if i := strings.Index(args.ObjectID[2:], ":"); -1 != i {
+				kind = args.ObjectID[:2+i]
+				var err error
+				if term, err = url.PathUnescape(args.ObjectID[3+i:]); nil != err {
+					t.Errorf("Malformed object ID %s", args.ObjectID)
+				}
+			}
+			var matches []testObject
+			for _, obj := range testObjects {
+				if kind != obj.kind {
+					continue
+				}
+				title := " " + strings.ToLower(obj.title)
+				if "" == term || strings.Contains(title, " "+strings.ToLower(term)) {
+					matches = append(matches, obj)
+				}
+			}
+			didl := `<DIDL-Lite xmlns="urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/" ` +
+				`xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:upnp="urn:schemas-upnp-org:metadata-1-0/upnp/">`
+			n := 0
+			for i := args.StartingIndex; i < len(matches) && n < 2 && n < args.RequestedCount; i, n = i+1, n+1 {
+				obj := matches[i]
+				if SearchKind_Tracks == obj.kind {
+					didl += fmt.Sprintf(`<item id="%s" parentID="%s" restricted="true"><dc:title>%s</dc:title>`+
+						`<upnp:class>object.item.audioItem.musicTrack</upnp:class><upnp:album>%s</upnp:album></item>`,
+						obj.id, args.ObjectID, obj.title, obj.album)
+				} else {
+					didl += fmt.Sprintf(`<container id="%s" parentID="%s" restricted="true"><dc:title>%s</dc:title>`+
+						`<upnp:class>object.container.person.musicArtist</upnp:class></container>`,
+						obj.id, args.ObjectID, obj.title)
+				}
+			}
+			didl += `</DIDL-Lite>`
+			var result strings.Builder
+			xml.EscapeText(&result, []byte(didl))
+			return fmt.Sprintf(`<u:BrowseResponse xmlns:u="urn:schemas-upnp-org:service:ContentDirectory:1">`+
+				`<Result>%s</Result><NumberReturned>%d</NumberReturned><TotalMatches>%d</TotalMatches>`+
+				`<UpdateID>1</UpdateID></u:BrowseResponse>`, result.String(), n, len(matches))
+		})
+	return MakeSonos(svc_map, nil, SVC_CONTENT_DIRECTORY), browsed
+}
+
+// The titles of @result, and the total
+func testTitles(result *SearchResult) string {
+	var titles []string
+	for _, obj := range result.Objects {
+		titles = append(titles, obj.Title())
+	}
+	return fmt.Sprintf("%d %q", result.Total, titles)
+}
+
+func TestSearch(t *testing.T) {
+	tests := []struct {
+		term    string
+		opts    *SearchOptions
+		browsed string
+		titles  string
+	}{
+		// The player matches the term for a prefix search; the term is
+		// escaped as a path segment, which leaves a colon in it as it is
+		{"beat", nil, "A:ARTIST:beat", `3 ["beat" "Beat Happening" "The Beatles"]`},
+		{"BEAT", nil, "A:ARTIST:BEAT", `3 ["beat" "Beat Happening" "The Beatles"]`},
+		{"AC/DC: L", nil, "A:ARTIST:AC%2FDC:%20L", `1 ["AC/DC: Live"]`},
+		{"beat", &SearchOptions{CaseSensitive: true}, "A:ARTIST:beat", `1 ["beat"]`},
+		{"beat", &SearchOptions{Mode: MatchMode_Exact}, "A:ARTIST:beat", `1 ["beat"]`},
+		// A substring search browses the whole kind
+		{"beat", &SearchOptions{Mode: MatchMode_Substring}, "A:ARTIST",
+			`4 ["beat" "Beat Happening" "The Beatles" "Heartbeat"]`},
+		{"", &SearchOptions{Mode: MatchMode_Substring}, "A:ARTIST",
+			`6 ["Abba" "AC/DC: Live" "beat" "Beat Happening" "Heartbeat" "The Beatles"]`},
+		{"", nil, "A:ARTIST", `6 ["Abba" "AC/DC: Live" "beat" "Beat Happening" "Heartbeat" "The Beatles"]`},
+		// Pages of the ranked matches
+		{"beat", &SearchOptions{Mode: MatchMode_Substring, Start: 1, Count: 2}, "A:ARTIST",
+			`4 ["Beat Happening" "The Beatles"]`},
+		{"beat", &SearchOptions{Mode: MatchMode_Substring, Start: 3, Count: 2}, "A:ARTIST", `4 ["Heartbeat"]`},
+		{"beat", &SearchOptions{Mode: MatchMode_Substring, Start: 2}, "A:ARTIST", `4 ["The Beatles" "Heartbeat"]`},
+		{"beat", &SearchOptions{Mode: MatchMode_Substring, Start: -1, Count: 1}, "A:ARTIST", `4 ["beat"]`},
+		{"beat", &SearchOptions{Mode: MatchMode_Substring, Start: 4}, "A:ARTIST", `4 []`},
+	}
+	for _, test := range tests {
+		sonos, browsed := testLibrary(t)
+		result, err := sonos.Search(SearchKind_Artists, test.term, test.opts)
+		if nil != err {
+			t.Errorf("%q: %v", test.term, err)
+			continue
+		}
+		// Every page is browsed from the same object
+		for _, objectId := range *browsed {
+			if test.browsed != objectId {
+				t.Errorf("%q: browsed %v, expected %s", test.term, *browsed, test.browsed)
+				break
+			}
+		}
+		if titles := testTitles(result); test.titles != titles {
+			t.Errorf("%q %+v: found %s, expected %s", test.term, test.opts, titles, test.titles)
+		}
+	}
+}
+
+func TestSearchKind(t *testing.T) {
+	sonos, browsed := testLibrary(t)
+	if _, err := sonos.Search("A:ALBUMARTIST", "beat", nil); nil == err {
+		t.Error("Searched an unknown kind")
+	}
+	if 0 != len(*browsed) {
+		t.Errorf("Browsed %v", *browsed)
+	}
+}
+
+func TestGetTrackFromAlbum(t *testing.T) {
+	sonos, browsed := testLibrary(t)
+	tracks, err := sonos.GetTrackFromAlbum("Help!", "Help!")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if "[A:TRACKS:Help%21 A:TRACKS:Help%21]" != fmt.Sprint(*browsed) {
+		t.Errorf("Browsed %v", *browsed)
+	}
+	// Not help! nor the same title on another album
+	if 1 != len(tracks) || "S://nas/help/01.flac" != tracks[0].ID() || "Help!" != tracks[0].Album() {
+		t.Errorf("Found %v", tracks)
+	}
+	if tracks, err = sonos.GetTrackFromAlbum("Revolver", "Help!"); nil != err || 0 != len(tracks) {
+		t.Errorf("Found %v, %v", tracks, err)
+	}
+}
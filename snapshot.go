@@ -0,0 +1,199 @@
+//
+// go-sonos
+// ========
+//
+// Copyright (c) 2012, Ian T. Richards <ianr@panix.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//   * Redistributions of source code must retain the above copyright notice,
+//     this list of conditions and the following disclaimer.
+//   * Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+// TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package sonos
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ianr0bkny/go-sonos/ssdp"
+	"github.com/ianr0bkny/go-sonos/upnp"
+	"github.com/ianr0bkny/go-sonos/uri"
+)
+
+// The rendering state of one room in a snapshot
+type SnapshotRoom struct {
+	UUID   ssdp.UUID
+	Name   string
+	Volume uint16
+	Mute   bool
+}
+
+//
+// The playback state of a zone and the group it belongs to, captured by
+// Take() so that it can be put back by Restore(), e.g. around an
+// announcement.
+//
+type Snapshot struct {
+	zone *Zone
+	// The coordinator of the group, and every room in it (coordinator first)
+	Coordinator ssdp.UUID
+	Rooms       []SnapshotRoom
+	// What the coordinator was playing
+	MediaInfo         upnp.MediaInfo
+	PositionInfo      upnp.PositionInfo
+	TransportInfo     upnp.TransportInfo
+	TransportSettings upnp.TransportSettings
+	CrossfadeMode     bool
+	taken             bool
+}
+
+// Returns an empty snapshot of @zone
+func MakeSnapshot(zone *Zone) *Snapshot {
+	return &Snapshot{zone: zone}
+}
+
+// Record the first error of several
+func snapshotKeep(first *error, err error) {
+	if nil == *first && nil != err {
+		*first = err
+	}
+}
+
+// Capture the current state of the zone's group
+func (this *Snapshot) Take() (err error) {
+	room, err := this.zone.Room()
+	if nil != err {
+		return
+	}
+	household := this.zone.household
+	coordinator := room.Group.Coordinator
+	this.Coordinator = coordinator.Main.UUID
+	this.Rooms = nil
+	err = household.call(coordinator.Main, func(s *Sonos) (err error) {
+		var media *upnp.MediaInfo
+		var position *upnp.PositionInfo
+		var transport *upnp.TransportInfo
+		var settings *upnp.TransportSettings
+		if media, err = s.AVTransport.GetMediaInfo(0); nil != err {
+			return
+		} else if position, err = s.AVTransport.GetPositionInfo(0); nil != err {
+			return
+		} else if transport, err = s.AVTransport.GetTransportInfo(0); nil != err {
+			return
+		} else if settings, err = s.AVTransport.GetTransportSettings(0); nil != err {
+			return
+		} else if this.CrossfadeMode, err = s.AVTransport.GetCrossfadeMode(0); nil != err {
+			return
+		}
+		this.MediaInfo = *media
+		this.PositionInfo = *position
+		this.TransportInfo = *transport
+		this.TransportSettings = *settings
+		return
+	})
+	if nil != err {
+		return
+	}
+	for _, member := range room.Group.Rooms {
+		state := SnapshotRoom{UUID: member.Main.UUID, Name: member.Name}
+		err = household.call(member.Main, func(s *Sonos) (err error) {
+			if state.Volume, err = s.RenderingControl.GetVolume(0, upnp.Channel_Master); nil == err {
+				state.Mute, err = s.RenderingControl.GetMute(0, upnp.Channel_Master)
+			}
+			return
+		})
+		if nil != err {
+			return
+		}
+		this.Rooms = append(this.Rooms, state)
+	}
+	this.taken = true
+	return
+}
+
+// True if the coordinator was playing its own queue
+func (this *Snapshot) playingQueue() bool {
+	u, err := uri.Parse(this.MediaInfo.CurrentURI)
+	return nil == err && uri.Kind_Queue == u.Kind
+}
+
+//
+// Put back the state recorded by Take(): the group's membership, then
+// the coordinator's source, position, play mode and crossfade, then the
+// volume and mute of each room, and finally playback if it was playing.
+// Every step is attempted; the first error is returned.
+//
+func (this *Snapshot) Restore() (err error) {
+	if !this.taken {
+		return errors.New("No snapshot has been taken")
+	}
+	household := this.zone.household
+	var names []string
+	for _, room := range this.Rooms {
+		names = append(names, string(room.UUID))
+	}
+	snapshotKeep(&err, household.SetGroups([][]string{names}))
+	coordinator := household.Player(this.Coordinator)
+	if nil == coordinator {
+		snapshotKeep(&err, errors.New(fmt.Sprintf("Coordinator %s has left the household", this.Coordinator)))
+		return
+	}
+	snapshotKeep(&err, household.call(coordinator, func(s *Sonos) (err error) {
+		if "" != this.MediaInfo.CurrentURI {
+			metadata := this.MediaInfo.CurrentURIMetaData
+			if this.playingQueue() {
+				metadata = ""
+			}
+			snapshotKeep(&err, s.AVTransport.SetAVTransportURI(0, this.MediaInfo.CurrentURI, metadata))
+		}
+		if this.playingQueue() && nil == err {
+			if 0 < this.PositionInfo.Track {
+				snapshotKeep(&err, s.AVTransport.Seek(0, upnp.SeekMode_TRACK_NR, fmt.Sprintf("%d", this.PositionInfo.Track)))
+			}
+			if offset, perr := upnp.ParseTime(this.PositionInfo.RelTime); nil == perr && 0 < offset {
+				snapshotKeep(&err, s.AVTransport.SeekTime(0, offset))
+			}
+		}
+		if "" != this.TransportSettings.PlayMode {
+			snapshotKeep(&err, s.AVTransport.SetPlayMode(0, this.TransportSettings.PlayMode))
+		}
+		snapshotKeep(&err, s.AVTransport.SetCrossfadeMode(0, this.CrossfadeMode))
+		return
+	}))
+	for _, state := range this.Rooms {
+		state := state
+		if player := household.Player(state.UUID); nil == player {
+			snapshotKeep(&err, errors.New(fmt.Sprintf("Room `%s' has left the household", state.Name)))
+		} else {
+			snapshotKeep(&err, household.call(player, func(s *Sonos) (err error) {
+				snapshotKeep(&err, s.RenderingControl.SetVolume(0, upnp.Channel_Master, state.Volume))
+				snapshotKeep(&err, s.RenderingControl.SetMute(0, upnp.Channel_Master, state.Mute))
+				return
+			}))
+		}
+	}
+	if upnp.State_PLAYING == this.TransportInfo.CurrentTransportState {
+		snapshotKeep(&err, household.call(coordinator, func(s *Sonos) error {
+			return s.AVTransport.Play(0, upnp.PlaySpeed_1)
+		}))
+	}
+	return
+}
@@ -42,6 +42,12 @@ import (
 const MUSIC_SERVICES = "schemas-upnp-org-MusicServices"
 const SONOS = "Sonos"
 
+// The search target for devices implementing the MusicServices API
+const MUSIC_SERVICES_SEARCH_TARGET = "urn:schemas-upnp-org:service:MusicServices:1"
+
+// The search target for Sonos players
+const ZONE_PLAYER_SEARCH_TARGET = "urn:schemas-upnp-org:device:ZonePlayer:1"
+
 type Sonos struct {
 	upnp.AlarmClock
 	upnp.AVTransport
@@ -244,6 +250,36 @@ func MakeReactor(ifiname, port string) upnp.Reactor {
 
 func Discover(ifiname, port string) (mgr ssdp.Manager, err error) {
 	mgr = ssdp.MakeManager()
-	mgr.Discover(ifiname, port, false)
+	err = mgr.Discover(ifiname, port, false)
+	return
+}
+
+//
+// Returns discovery options that search only for the MusicServices
+// service, so that the results can be passed to ConnectAny(), and that
+// stop waiting once @count players have answered (0 to wait out the
+// full duration).
+//
+func DiscoveryOptions(count int) *ssdp.DiscoveryOptions {
+	options := ssdp.DefaultDiscoveryOptions()
+	options.SearchTargets = []string{MUSIC_SERVICES_SEARCH_TARGET}
+	options.MinDevices = count
+	return options
+}
+
+func DiscoverWithOptions(ifiname, port string, options *ssdp.DiscoveryOptions) (mgr ssdp.Manager, err error) {
+	mgr = ssdp.MakeManager()
+	err = mgr.DiscoverWithOptions(ifiname, port, false, options)
+	return
+}
+
+//
+// Finds players by fetching their device descriptions directly from
+// @hosts (addresses, or CIDR ranges such as "192.168.1.0/24"), for
+// networks where multicast discovery does not reach them.
+//
+func Probe(hosts []string) (mgr ssdp.Manager, err error) {
+	mgr = ssdp.MakeManager()
+	err = mgr.Probe(hosts, ssdp.DefaultProbeOptions())
 	return
 }
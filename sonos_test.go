@@ -47,7 +47,7 @@ const (
 	TEST_RECIVA        = "basement"
 	TEST_DISCOVER_PORT = "13104"
 	TEST_EVENTING_PORT = "13106"
-	TEST_NETWORK       = "eth0"
+	TEST_NETWORK       = ssdp.AllInterfaces
 )
 
 var testSonos *sonos.Sonos
@@ -0,0 +1,443 @@
+//
+// go-sonos
+// ========
+//
+// Copyright (c) 2012, Ian T. Richards <ianr@panix.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//   * Redistributions of source code must retain the above copyright notice,
+//     this list of conditions and the following disclaimer.
+//   * Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+// TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package ssdp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// The SERVER header sent when an Advertisement does not give one
+	ssdpDefaultServer = "unix/5.1 UPnP/1.1 go-sonos/1.0"
+	// The most a responder may delay its reply to M-SEARCH (UPnP 1.1)
+	ssdpMaxMX = 5
+)
+
+// A device that may be embedded in an advertised root device
+type EmbeddedDevice struct {
+	// The device's own UUID (without the uuid: prefix)
+	UUID UUID
+	// The device type URN (e.g. urn:schemas-upnp-org:device:MediaRenderer:1)
+	DeviceType string
+	// The service type URNs the device implements
+	Services []string
+}
+
+//
+// A root device, and the devices and services embedded in it, to announce
+// on the network.  The host part of Location may be left empty (as in
+// "http://:8200/description.xml"), in which case the address of the
+// interface each message is sent from is substituted.
+//
+type Advertisement struct {
+	EmbeddedDevice
+	// The URL of the root device description
+	Location Location
+	// The SERVER header, defaulting to a generic go-sonos string
+	Server string
+	// How long receivers may cache the advertisement, defaulting to
+	// 1800 seconds.  Announcements are repeated at a third of this.
+	MaxAge time.Duration
+	// Embedded devices, announced under the root device's location
+	Devices []EmbeddedDevice
+	// The address families to advertise in, defaulting to Family_IPv4
+	Families []string
+}
+
+// One NT/USN pair announced for an advertisement
+type ssdpTarget struct {
+	nt  string
+	usn string
+}
+
+// Announces a device with ssdp:alive and ssdp:byebye and answers M-SEARCH
+type Advertiser interface {
+	// Begins advertising on ifiname, which is resolved as for
+	// Manager.Discover(): a single interface name, a comma-separated list,
+	// or AllInterfaces.  It fails if already advertising; after Close()
+	// it may be called again.
+	Advertise(ifiname string) error
+	// Sends ssdp:byebye for every target and stops advertising
+	Close() error
+}
+
+type ssdpDefaultAdvertiser struct {
+	adv      Advertisement
+	targets  []ssdpTarget
+	sockets  []*ssdpSocket
+	stopChan chan int
+	wait     sync.WaitGroup
+	lock     sync.Mutex
+}
+
+// Returns an advertiser for @adv, which is copied
+func MakeAdvertiser(adv *Advertisement) Advertiser {
+	this := &ssdpDefaultAdvertiser{adv: *adv}
+	if "" == this.adv.Server {
+		this.adv.Server = ssdpDefaultServer
+	}
+	if 0 >= this.adv.MaxAge {
+		this.adv.MaxAge = ssdpDefaultMaxAge
+	}
+	if 0 == len(this.adv.Families) {
+		this.adv.Families = []string{Family_IPv4}
+	}
+	this.targets = ssdpAdvertisementTargets(&this.adv)
+	return this
+}
+
+// Lists the NT/USN pairs a root device and its embedded devices and
+// services are announced under, as required by UPnP Device Architecture
+// 1.1 section 1.1.2.
+func ssdpAdvertisementTargets(adv *Advertisement) (targets []ssdpTarget) {
+	root := fmt.Sprintf("uuid:%s", adv.UUID)
+	targets = append(targets, ssdpTarget{"upnp:rootdevice", root + "::upnp:rootdevice"})
+	devices := append([]EmbeddedDevice{adv.EmbeddedDevice}, adv.Devices...)
+	for _, dev := range devices {
+		uuid := fmt.Sprintf("uuid:%s", dev.UUID)
+		targets = append(targets, ssdpTarget{uuid, uuid})
+		targets = append(targets, ssdpTarget{dev.DeviceType, uuid + "::" + dev.DeviceType})
+	}
+	for _, dev := range devices {
+		uuid := fmt.Sprintf("uuid:%s", dev.UUID)
+		for _, svc := range dev.Services {
+			targets = append(targets, ssdpTarget{svc, uuid + "::" + svc})
+		}
+	}
+	return
+}
+
+// Splits a device or service type URN into its unversioned part and version
+func ssdpSplitVersion(urn string) (base string, version int64) {
+	base = urn
+	if i := strings.LastIndex(urn, ":"); -1 != i && strings.HasPrefix(urn, "urn:") {
+		if v, err := strconv.ParseInt(urn[i+1:], 10, 64); nil == err {
+			base, version = urn[:i], v
+		}
+	}
+	return
+}
+
+//
+// Returns the targets that answer a search for @st, each with the ST to
+// report.  A search for a type matches any version at or above the one
+// requested, and is answered with the requested version.
+//
+func (this *ssdpDefaultAdvertiser) ssdpMatchSearch(st string) (matches []ssdpTarget) {
+	stBase, stVersion := ssdpSplitVersion(st)
+	for _, target := range this.targets {
+		if SearchTarget_All == st {
+			matches = append(matches, target)
+		} else if st == target.nt {
+			matches = append(matches, target)
+		} else if base, version := ssdpSplitVersion(target.nt); 0 < stVersion && base == stBase && stVersion <= version {
+			usn := strings.TrimSuffix(target.usn, target.nt) + st
+			matches = append(matches, ssdpTarget{st, usn})
+		}
+	}
+	return
+}
+
+// Fills an empty host in the advertised location with @local
+func (this *ssdpDefaultAdvertiser) ssdpLocation(local net.IP) string {
+	loc := string(this.adv.Location)
+	u, err := url.Parse(loc)
+	if nil != err {
+		return loc
+	} else if host := u.Hostname(); "" != host && !net.ParseIP(host).IsUnspecified() {
+		return loc
+	} else if nil == local.To4() && local.IsLinkLocalUnicast() {
+		return loc /*the peer could not use a zoned address*/
+	}
+	if port := u.Port(); "" != port {
+		u.Host = net.JoinHostPort(local.String(), port)
+	} else if nil != local.To4() {
+		u.Host = local.String()
+	} else {
+		u.Host = "[" + local.String() + "]"
+	}
+	return u.String()
+}
+
+func (this *ssdpDefaultAdvertiser) ssdpNotifyMessage(sock *ssdpSocket, host, nts string, target ssdpTarget) (msg *bytes.Buffer) {
+	msg = new(bytes.Buffer)
+	msg.WriteString("NOTIFY * HTTP/1.1\r\n")
+	msg.WriteString(fmt.Sprintf("HOST: %s\r\n", host))
+	if "ssdp:alive" == nts {
+		msg.WriteString(fmt.Sprintf("CACHE-CONTROL: max-age=%d\r\n", int(this.adv.MaxAge/time.Second)))
+		msg.WriteString(fmt.Sprintf("LOCATION: %s\r\n", this.ssdpLocation(sock.unicast.addr.IP)))
+		msg.WriteString(fmt.Sprintf("SERVER: %s\r\n", this.adv.Server))
+	}
+	msg.WriteString(fmt.Sprintf("NT: %s\r\n", target.nt))
+	msg.WriteString(fmt.Sprintf("NTS: %s\r\n", nts))
+	msg.WriteString(fmt.Sprintf("USN: %s\r\n", target.usn))
+	msg.WriteString("\r\n")
+	return
+}
+
+func (this *ssdpDefaultAdvertiser) ssdpResponseMessage(sock *ssdpSocket, target ssdpTarget) (msg *bytes.Buffer) {
+	msg = new(bytes.Buffer)
+	msg.WriteString("HTTP/1.1 200 OK\r\n")
+	msg.WriteString(fmt.Sprintf("CACHE-CONTROL: max-age=%d\r\n", int(this.adv.MaxAge/time.Second)))
+	msg.WriteString(fmt.Sprintf("DATE: %s\r\n", time.Now().UTC().Format(time.RFC1123)))
+	msg.WriteString("EXT:\r\n")
+	msg.WriteString(fmt.Sprintf("LOCATION: %s\r\n", this.ssdpLocation(sock.unicast.addr.IP)))
+	msg.WriteString(fmt.Sprintf("SERVER: %s\r\n", this.adv.Server))
+	msg.WriteString(fmt.Sprintf("ST: %s\r\n", target.nt))
+	msg.WriteString(fmt.Sprintf("USN: %s\r\n", target.usn))
+	msg.WriteString("\r\n")
+	return
+}
+
+// Multicasts a NOTIFY of type @nts for every target on each of @sockets
+func (this *ssdpDefaultAdvertiser) ssdpSendNotify(sockets []*ssdpSocket, nts string) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	for _, sock := range sockets {
+		for _, group := range sock.groups {
+			for _, target := range this.targets {
+				msg := this.ssdpNotifyMessage(sock, group.host, nts, target)
+				if _, err := sock.unicast.conn.WriteTo(msg.Bytes(), group.addr); nil != err {
+					log.Printf("Notify on %s via %s failed: %v", sock.ifi.Name, group.host, err)
+				}
+			}
+		}
+	}
+}
+
+// Answers a search from @addr after a random delay of up to MX seconds
+func (this *ssdpDefaultAdvertiser) ssdpAnswerSearch(raw *ssdpRawMessage, sock *ssdpSocket, addr *net.UDPAddr, stop chan int) {
+	if "\"ssdp:discover\"" != raw.header["Man"] {
+		return
+	}
+	matches := this.ssdpMatchSearch(raw.header["St"])
+	if 0 == len(matches) {
+		return
+	}
+	mx, err := strconv.Atoi(raw.header["Mx"])
+	if nil != err || 1 > mx {
+		mx = 1
+	} else if ssdpMaxMX < mx {
+		mx = ssdpMaxMX
+	}
+	delay := time.Duration(rand.Int63n(int64(time.Duration(mx) * time.Second)))
+	this.wait.Add(1)
+	go func() {
+		defer this.wait.Done()
+		select {
+		case <-time.After(delay):
+		case <-stop:
+			return
+		}
+		for _, target := range matches {
+			msg := this.ssdpResponseMessage(sock, target)
+			if _, err := sock.unicast.conn.WriteTo(msg.Bytes(), addr); nil != err {
+				log.Printf("Search response to %s failed: %v", addr, err)
+			}
+		}
+	}()
+}
+
+// Handles one datagram, ignoring anything that does not parse.  The
+// multicast sockets are bound to the wildcard address, so every socket
+// sees a search that arrived on any interface; only the socket whose
+// interface shares a subnet with the sender answers, so that LOCATION
+// names an address the sender can reach.
+func (this *ssdpDefaultAdvertiser) ssdpHandlePacket(packet []byte, sock *ssdpSocket, addr *net.UDPAddr, stop chan int) {
+	defer func() {
+		if r := recover(); nil != r {
+			log.Printf("Ignoring malformed message from %s: %v", addr, r)
+		}
+	}()
+	if addrs, err := sock.ifi.Addrs(); nil != err || !ssdpOnLink(sock.ifi.Name, addrs, addr) {
+		return
+	}
+	if raw := ssdpParseInput(packet); ssdpSearch == raw.msgtype {
+		this.ssdpAnswerSearch(raw, sock, addr, stop)
+	}
+}
+
+func (this *ssdpDefaultAdvertiser) ssdpListenLoop(conn *net.UDPConn, sock *ssdpSocket, stop chan int) {
+	defer this.wait.Done()
+	packet := make([]byte, 65536) /*max size of a single UDP packet*/
+	for {
+		n, addr, err := conn.ReadFromUDP(packet)
+		if nil != err {
+			return
+		}
+		this.ssdpHandlePacket(packet[:n], sock, addr, stop)
+	}
+}
+
+// Repeats the announcement well within max-age until stopped
+func (this *ssdpDefaultAdvertiser) ssdpAnnounceLoop(sockets []*ssdpSocket, stop chan int) {
+	defer this.wait.Done()
+	ticker := time.NewTicker(this.adv.MaxAge / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			this.ssdpSendNotify(sockets, "ssdp:alive")
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (this *ssdpDefaultAdvertiser) ssdpOpenSocket(ifi net.Interface, family string) (sock *ssdpSocket, err error) {
+	sock = &ssdpSocket{ifi: ifi, family: family}
+	lip, err := InterfaceAddrFamily(&ifi, family)
+	if nil != err {
+		return
+	}
+	laddr := &net.UDPAddr{IP: lip.IP, Zone: lip.Zone}
+	if sock.unicast.conn, err = net.ListenUDP(family, laddr); nil != err {
+		return
+	}
+	sock.unicast.addr = laddr
+	for _, group := range ssdpBroadcastGroups(family) {
+		var maddr *net.UDPAddr
+		if maddr, err = net.ResolveUDPAddr(family, group); nil != err {
+			break
+		}
+		if Family_IPv6 == family {
+			maddr.Zone = ifi.Name
+		}
+		var mc *net.UDPConn
+		if mc, err = net.ListenMulticastUDP(family, &ifi, maddr); nil != err {
+			break
+		}
+		sock.groups = append(sock.groups, ssdpGroup{group, maddr})
+		sock.multicast = append(sock.multicast, ssdpConnection{mc, maddr})
+	}
+	if nil != err {
+		this.ssdpCloseSocket(sock)
+	}
+	return
+}
+
+func (this *ssdpDefaultAdvertiser) ssdpCloseSocket(sock *ssdpSocket) {
+	if nil != sock.unicast.conn {
+		sock.unicast.conn.Close()
+	}
+	for _, mc := range sock.multicast {
+		mc.conn.Close()
+	}
+}
+
+func (this *ssdpDefaultAdvertiser) Advertise(ifiname string) (err error) {
+	if "" == this.adv.UUID || "" == this.adv.DeviceType || "" == this.adv.Location {
+		return errors.New("An advertisement needs a UUID, device type and location")
+	}
+	if this.ssdpAdvertising() {
+		return errors.New("Already advertising")
+	}
+	ifis, err := Interfaces(ifiname)
+	if nil != err {
+		return
+	}
+	var sockets []*ssdpSocket
+	for _, ifi := range ifis {
+		for _, family := range this.adv.Families {
+			if _, err := InterfaceAddrFamily(&ifi, family); nil != err {
+				log.Printf("Skipping advertisement: %v", err)
+				continue
+			}
+			sock, err := this.ssdpOpenSocket(ifi, family)
+			if nil != err {
+				for _, sock := range sockets {
+					this.ssdpCloseSocket(sock)
+				}
+				return err
+			}
+			sockets = append(sockets, sock)
+		}
+	}
+	if 0 == len(sockets) {
+		return errors.New("No interface has an address in the requested families")
+	}
+	// Each run has its own stop channel, so that one stopped by Close()
+	// does not end the next
+	stop := make(chan int)
+	this.lock.Lock()
+	if 0 < len(this.sockets) {
+		this.lock.Unlock()
+		for _, sock := range sockets {
+			this.ssdpCloseSocket(sock)
+		}
+		return errors.New("Already advertising")
+	}
+	this.sockets, this.stopChan = sockets, stop
+	this.lock.Unlock()
+	for _, sock := range sockets {
+		for _, mc := range sock.multicast {
+			this.wait.Add(1)
+			go this.ssdpListenLoop(mc.conn, sock, stop)
+		}
+	}
+	this.ssdpSendNotify(sockets, "ssdp:alive")
+	this.wait.Add(1)
+	go this.ssdpAnnounceLoop(sockets, stop)
+	return
+}
+
+func (this *ssdpDefaultAdvertiser) ssdpAdvertising() bool {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return 0 < len(this.sockets)
+}
+
+func (this *ssdpDefaultAdvertiser) Close() (err error) {
+	this.lock.Lock()
+	sockets, stop := this.sockets, this.stopChan
+	this.sockets, this.stopChan = nil, nil
+	this.lock.Unlock()
+	if 0 == len(sockets) {
+		return
+	}
+	close(stop)
+	this.ssdpSendNotify(sockets, "ssdp:byebye")
+	for _, sock := range sockets {
+		this.ssdpCloseSocket(sock)
+	}
+	this.wait.Wait()
+	return
+}
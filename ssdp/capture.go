@@ -0,0 +1,210 @@
+//
+// go-sonos
+// ========
+//
+// Copyright (c) 2012, Ian T. Richards <ianr@panix.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//   * Redistributions of source code must retain the above copyright notice,
+//     this list of conditions and the following disclaimer.
+//   * Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+// TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package ssdp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"time"
+)
+
+// The message types named in a capture
+const (
+	Capture_Search   = "M-SEARCH"
+	Capture_Notify   = "NOTIFY"
+	Capture_Response = "RESPONSE"
+	Capture_Invalid  = "INVALID"
+)
+
+// One message recorded by a sniffing manager
+type CaptureEntry struct {
+	// When the message arrived
+	Time time.Time `json:"time"`
+	// The sender, as host:port
+	Source string `json:"source"`
+	// The interface the message arrived on
+	Interface string `json:"interface"`
+	// One of the Capture_* message types
+	Type string `json:"type"`
+	// The parsed header fields, with canonicalized names
+	Headers map[string]string `json:"headers,omitempty"`
+	// The message exactly as received
+	Raw string `json:"raw"`
+}
+
+func ssdpCaptureType(raw *ssdpRawMessage) string {
+	if nil == raw {
+		return Capture_Invalid
+	}
+	switch raw.msgtype {
+	case ssdpSearch:
+		return Capture_Search
+	case ssdpNotify:
+		return Capture_Notify
+	case ssdpResponse:
+		return Capture_Response
+	}
+	return Capture_Invalid
+}
+
+// Append a datagram to the capture, if sniffing
+func (this *ssdpDefaultManager) ssdpRecord(packet []byte, addr *net.UDPAddr, sock *ssdpSocket, raw *ssdpRawMessage) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if !this.capturing {
+		return
+	}
+	entry := CaptureEntry{
+		Time:      time.Now(),
+		Interface: sock.ifi.Name,
+		Type:      ssdpCaptureType(raw),
+		Raw:       string(packet),
+	}
+	if nil != addr {
+		entry.Source = addr.String()
+	}
+	if nil != raw {
+		entry.Headers = raw.header
+	}
+	this.capture = append(this.capture, entry)
+}
+
+func (this *ssdpDefaultManager) Sniff(ifiname string) (err error) {
+	ifis, err := Interfaces(ifiname)
+	if nil != err {
+		return
+	}
+	this.lock.Lock()
+	this.capturing = true
+	this.lock.Unlock()
+	this.ssdpStartUpdateLoop()
+	for _, ifi := range ifis {
+		for _, family := range []string{Family_IPv4, Family_IPv6} {
+			lip, err := InterfaceAddrFamily(&ifi, family)
+			if nil != err {
+				continue
+			}
+			sock := &ssdpSocket{ifi: ifi, family: family}
+			sock.unicast.addr = &net.UDPAddr{IP: lip.IP, Zone: lip.Zone}
+			this.sockets = append(this.sockets, sock)
+			if err = this.ssdpMulticastDiscoverImpl(sock, true); nil != err {
+				return err
+			}
+		}
+	}
+	if 0 == len(this.sockets) {
+		err = errors.New("No interface is available to sniff")
+	}
+	return
+}
+
+func (this *ssdpDefaultManager) Capture() (entries []CaptureEntry) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	entries = make([]CaptureEntry, len(this.capture))
+	copy(entries, this.capture)
+	return
+}
+
+func (this *ssdpDefaultManager) SaveCapture(filename string) (err error) {
+	f, err := os.Create(filename)
+	if nil != err {
+		return
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	for _, entry := range this.Capture() {
+		if err = enc.Encode(&entry); nil != err {
+			return
+		}
+	}
+	return f.Sync()
+}
+
+// Reads the entries of a capture file written by SaveCapture()
+func ReadCapture(filename string) (entries []CaptureEntry, err error) {
+	f, err := os.Open(filename)
+	if nil != err {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 65536), 4*65536)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		if 0 == len(scanner.Bytes()) {
+			continue
+		}
+		var entry CaptureEntry
+		if err = json.Unmarshal(scanner.Bytes(), &entry); nil != err {
+			return nil, errors.New(fmt.Sprintf("%s:%d: %v", filename, lineno, err))
+		}
+		entries = append(entries, entry)
+	}
+	err = scanner.Err()
+	return
+}
+
+// Apply one captured message to the device list directly, so that the
+// result is visible as soon as the call returns.
+func (this *ssdpDefaultManager) ssdpReplayEntry(entry *CaptureEntry) {
+	defer func() {
+		if r := recover(); nil != r {
+			log.Printf("Ignoring malformed message from %s: %v", entry.Source, r)
+		}
+	}()
+	raw := ssdpParseInput([]byte(entry.Raw))
+	switch raw.msgtype {
+	case ssdpResponse:
+		msg := this.ssdpHandleResponse(raw)
+		msg.ifiname = entry.Interface
+		this.ssdpIncludeResponse(msg)
+	case ssdpNotify:
+		msg := this.ssdpHandleNotify(raw)
+		msg.ifiname = entry.Interface
+		this.ssdpIncludeNotification(msg)
+	}
+}
+
+func (this *ssdpDefaultManager) ReplayCapture(filename string) (err error) {
+	entries, err := ReadCapture(filename)
+	if nil != err {
+		return
+	}
+	for i := range entries {
+		this.ssdpReplayEntry(&entries[i])
+	}
+	return
+}
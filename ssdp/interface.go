@@ -0,0 +1,219 @@
+//
+// go-sonos
+// ========
+//
+// Copyright (c) 2012, Ian T. Richards <ianr@panix.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//   * Redistributions of source code must retain the above copyright notice,
+//     this list of conditions and the following disclaimer.
+//   * Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+// TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package ssdp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Names every multicast-capable interface in calls taking an interface name
+const AllInterfaces = ""
+
+// Address families, named as for net.ListenUDP
+const (
+	Family_IPv4 = "udp4"
+	Family_IPv6 = "udp6"
+)
+
+//
+// Resolve @ifiname to a list of network interfaces, where @ifiname is a
+// single interface name (e.g. "eth0"), a comma-separated list of names
+// (e.g. "eth0,wlan0"), or AllInterfaces to select every interface that
+// is up, supports multicast, is not a loopback device, and has an IPv4
+// or IPv6 address.
+//
+func Interfaces(ifiname string) (ifis []net.Interface, err error) {
+	if AllInterfaces == strings.TrimSpace(ifiname) {
+		var all []net.Interface
+		if all, err = net.Interfaces(); nil != err {
+			return
+		}
+		for _, ifi := range all {
+			if 0 == ifi.Flags&net.FlagUp || 0 == ifi.Flags&net.FlagMulticast || 0 != ifi.Flags&net.FlagLoopback {
+				continue
+			} else if _, err := InterfaceAddrFamily(&ifi, Family_IPv4); nil == err {
+				ifis = append(ifis, ifi)
+			} else if _, err := InterfaceAddrFamily(&ifi, Family_IPv6); nil == err {
+				ifis = append(ifis, ifi)
+			}
+		}
+		if 0 == len(ifis) {
+			err = errors.New("No multicast-capable interfaces found")
+		}
+		return
+	}
+	for _, name := range strings.Split(ifiname, ",") {
+		var ifi *net.Interface
+		if ifi, err = net.InterfaceByName(strings.TrimSpace(name)); nil != err {
+			return
+		}
+		ifis = append(ifis, *ifi)
+	}
+	return
+}
+
+//
+// Returns the first IPv4 address assigned to @ifi.
+//
+func InterfaceAddr(ifi *net.Interface) (ip net.IP, err error) {
+	var addr *net.IPAddr
+	if addr, err = InterfaceAddrFamily(ifi, Family_IPv4); nil == err {
+		ip = addr.IP
+	}
+	return
+}
+
+//
+// Returns an address of the given family (Family_IPv4 or Family_IPv6)
+// assigned to @ifi.  For IPv6 a global address is preferred to a
+// link-local one; link-local addresses carry the interface name as
+// their zone.
+//
+func InterfaceAddrFamily(ifi *net.Interface, family string) (addr *net.IPAddr, err error) {
+	addrs, err := ifi.Addrs()
+	if nil != err {
+		return
+	}
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok || !ssdpIsFamily(ipnet.IP, family) {
+			continue
+		} else if ipnet.IP.IsLinkLocalUnicast() {
+			if nil == addr {
+				addr = &net.IPAddr{IP: ipnet.IP, Zone: ifi.Name}
+			}
+			continue
+		}
+		addr = &net.IPAddr{IP: ipnet.IP}
+		return
+	}
+	if nil == addr {
+		err = errors.New(fmt.Sprintf("No %s address found for interface %s", ssdpFamilyName(family), ifi.Name))
+	}
+	return
+}
+
+func ssdpIsFamily(ip net.IP, family string) bool {
+	if Family_IPv4 == family {
+		return nil != ip.To4()
+	}
+	return nil == ip.To4() && nil != ip.To16()
+}
+
+func ssdpFamilyName(family string) string {
+	if Family_IPv4 == family {
+		return "IPv4"
+	}
+	return "IPv6"
+}
+
+//
+// Whether @remote is on the link of the interface named @name, whose
+// addresses are @addrs: a link-local IPv6 sender must carry the
+// interface as its zone, and any other sender must fall within one of
+// the interface's subnets.
+//
+func ssdpOnLink(name string, addrs []net.Addr, remote *net.UDPAddr) bool {
+	if nil == remote {
+		return false
+	}
+	if nil == remote.IP.To4() && remote.IP.IsLinkLocalUnicast() {
+		return "" == remote.Zone || name == remote.Zone
+	}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && ipnet.Contains(remote.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+//
+// Choose the address, among those assigned to @ifis, from which @remote
+// is reachable.  Only addresses of the same family as @remote are
+// considered, and one on the same subnet as @remote is preferred;
+// failing that the address the routing table would use is taken if it
+// belongs to one of @ifis, and otherwise the first address found, with
+// link-local addresses tried last.  When @remote is nil an IPv4 address
+// is preferred.
+//
+func LocalAddrFor(ifis []net.Interface, remote net.IP) (local net.IP, err error) {
+	families := []string{Family_IPv4, Family_IPv6}
+	if nil != remote {
+		families = []string{Family_IPv4}
+		if nil == remote.To4() {
+			families = []string{Family_IPv6}
+		}
+	}
+	var candidates, linkLocal []net.IP
+	for _, family := range families {
+		for _, ifi := range ifis {
+			addrs, err := ifi.Addrs()
+			if nil != err {
+				continue
+			}
+			for _, addr := range addrs {
+				if ipnet, ok := addr.(*net.IPNet); ok && ssdpIsFamily(ipnet.IP, family) {
+					if nil != remote && ipnet.Contains(remote) {
+						local = ipnet.IP
+						return local, nil
+					} else if ipnet.IP.IsLinkLocalUnicast() {
+						linkLocal = append(linkLocal, ipnet.IP)
+					} else {
+						candidates = append(candidates, ipnet.IP)
+					}
+				}
+			}
+		}
+	}
+	candidates = append(candidates, linkLocal...)
+	if 0 == len(candidates) {
+		err = errors.New("No usable local address found")
+		return
+	}
+	if nil != remote {
+		if conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: remote, Port: 1900}); nil == err {
+			routed := conn.LocalAddr().(*net.UDPAddr).IP
+			conn.Close()
+			for _, ip := range candidates {
+				if ip.Equal(routed) {
+					local = ip
+					return local, nil
+				}
+			}
+		}
+	}
+	local = candidates[0]
+	return
+}
@@ -0,0 +1,293 @@
+//
+// go-sonos
+// ========
+//
+// Copyright (c) 2012, Ian T. Richards <ianr@panix.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//   * Redistributions of source code must retain the above copyright notice,
+//     this list of conditions and the following disclaimer.
+//   * Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+// TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package ssdp
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// The port and path at which a Sonos player serves its description
+	ProbePort = "1400"
+	ProbePath = "/xml/device_description.xml"
+	// The largest CIDR range Probe() will expand, in host bits
+	ssdpMaxProbeBits = 16
+)
+
+// Controls a direct probe of known hosts
+type ProbeOptions struct {
+	// The port probed on hosts given without one (default ProbePort)
+	Port string
+	// The path of the device description (default ProbePath)
+	Path string
+	// How many hosts are probed at once (default 16)
+	Concurrency int
+	// How long to wait for each host (default 2s)
+	Timeout time.Duration
+}
+
+// Returns options that probe for Sonos players
+func DefaultProbeOptions() *ProbeOptions {
+	return &ProbeOptions{
+		Port:        ProbePort,
+		Path:        ProbePath,
+		Concurrency: 16,
+		Timeout:     2 * time.Second,
+	}
+}
+
+func (this *ProbeOptions) normalize() (options ProbeOptions) {
+	defaults := DefaultProbeOptions()
+	if nil != this {
+		options = *this
+	}
+	if "" == options.Port {
+		options.Port = defaults.Port
+	}
+	if "" == options.Path {
+		options.Path = defaults.Path
+	}
+	if 0 >= options.Concurrency {
+		options.Concurrency = defaults.Concurrency
+	}
+	if 0 >= options.Timeout {
+		options.Timeout = defaults.Timeout
+	}
+	return
+}
+
+// A device description to fetch
+type ssdpProbeURL struct {
+	location string
+	quiet    bool
+}
+
+type ssdpServiceList_XML struct {
+	Service []struct {
+		ServiceType string `xml:"serviceType"`
+	} `xml:"service"`
+}
+
+type ssdpDeviceList_XML struct {
+	Device []ssdpDevice_XML `xml:"device"`
+}
+
+type ssdpDevice_XML struct {
+	DeviceType  string              `xml:"deviceType"`
+	UDN         string              `xml:"UDN"`
+	ServiceList ssdpServiceList_XML `xml:"serviceList"`
+	DeviceList  ssdpDeviceList_XML  `xml:"deviceList"`
+}
+
+type ssdpDescription_XML struct {
+	XMLName xml.Name       `xml:"root"`
+	Device  ssdpDevice_XML `xml:"device"`
+}
+
+//
+// Expand @hosts into the URLs of the device descriptions to fetch, where
+// each entry is an address or host name, optionally with a port, or a
+// CIDR range (e.g. "192.168.1.0/24").  The network and broadcast
+// addresses of IPv4 ranges are skipped.  Addresses taken from a range
+// are marked quiet, as most are expected not to answer.
+//
+func ssdpProbeURLs(hosts []string, options *ProbeOptions) (urls []ssdpProbeURL, err error) {
+	add := func(host, port string, quiet bool) {
+		location := fmt.Sprintf("http://%s%s", net.JoinHostPort(host, port), options.Path)
+		urls = append(urls, ssdpProbeURL{location, quiet})
+	}
+	for _, entry := range hosts {
+		entry = strings.TrimSpace(entry)
+		if "" == entry {
+			continue
+		} else if ip, ipnet, perr := net.ParseCIDR(entry); nil == perr {
+			ones, bits := ipnet.Mask.Size()
+			if ssdpMaxProbeBits < bits-ones {
+				return nil, errors.New(fmt.Sprintf("Range %s is too large to probe", entry))
+			}
+			count := 1 << uint(bits-ones)
+			ip = ipnet.IP
+			for i := 0; i < count; i++ {
+				if nil != ip.To4() && 2 <= bits-ones && (0 == i || count-1 == i) {
+					/*network or broadcast address*/
+				} else {
+					add(ip.String(), options.Port, true)
+				}
+				ip = ssdpNextIP(ip)
+			}
+		} else if host, port, serr := net.SplitHostPort(entry); nil == serr {
+			add(host, port, false)
+		} else {
+			add(strings.Trim(entry, "[]"), options.Port, false)
+		}
+	}
+	return
+}
+
+// Returns the address following @ip
+func ssdpNextIP(ip net.IP) (next net.IP) {
+	next = make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; 0 <= i; i-- {
+		next[i] += 1
+		if 0 != next[i] {
+			break
+		}
+	}
+	return
+}
+
+//
+// Fetch the device description at @location and convert it into the
+// search responses the device would have sent: one each for the root
+// device, every embedded device, and every service.
+//
+func (this *ssdpDefaultManager) ssdpProbeHost(client *http.Client, location string, ifis []net.Interface) (responses []*ssdpResponseMessage, err error) {
+	resp, err := client.Get(location)
+	if nil != err {
+		return
+	}
+	defer resp.Body.Close()
+	if http.StatusOK != resp.StatusCode {
+		err = errors.New(fmt.Sprintf("%s: %s", location, resp.Status))
+		return
+	}
+	desc := ssdpDescription_XML{}
+	if err = xml.NewDecoder(resp.Body).Decode(&desc); nil != err {
+		return
+	}
+	if "" == desc.Device.UDN {
+		err = errors.New(fmt.Sprintf("%s: device description has no UDN", location))
+		return
+	}
+	base := ssdpResponseMessage{
+		location:      Location(location),
+		cache_control: fmt.Sprintf("max-age=%d", int(ssdpDefaultMaxAge/time.Second)),
+	}
+	if server := resp.Header.Get("Server"); "" != server {
+		ssdpParseServerString(&base.ssdpServerDescription, server)
+	}
+	if host, _, herr := net.SplitHostPort(resp.Request.URL.Host); nil == herr {
+		if remote := net.ParseIP(host); nil != remote && 0 < len(ifis) {
+			if base.localAddr, herr = LocalAddrFor(ifis, remote); nil == herr {
+				base.ifiname = ssdpInterfaceWith(ifis, base.localAddr)
+			}
+		}
+	}
+	add := func(st, usn string) {
+		msg := base
+		msg.st = st
+		msg.usn = usn
+		responses = append(responses, &msg)
+	}
+	var walk func(dev *ssdpDevice_XML)
+	walk = func(dev *ssdpDevice_XML) {
+		add(dev.DeviceType, dev.UDN+"::"+dev.DeviceType) /*first, to name the device*/
+		add(dev.UDN, dev.UDN)
+		for _, svc := range dev.ServiceList.Service {
+			add(svc.ServiceType, dev.UDN+"::"+svc.ServiceType)
+		}
+		for i := range dev.DeviceList.Device {
+			walk(&dev.DeviceList.Device[i])
+		}
+	}
+	walk(&desc.Device)
+	add("upnp:rootdevice", desc.Device.UDN+"::upnp:rootdevice")
+	return
+}
+
+// Returns the name of the interface among @ifis that has address @ip
+func ssdpInterfaceWith(ifis []net.Interface, ip net.IP) string {
+	for _, ifi := range ifis {
+		if addrs, err := ifi.Addrs(); nil == err {
+			for _, addr := range addrs {
+				if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.Equal(ip) {
+					return ifi.Name
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func (this *ssdpDefaultManager) Probe(hosts []string, options *ProbeOptions) (err error) {
+	// Probed devices expire with their max-age like discovered ones
+	this.ssdpStartUpdateLoop()
+	opts := options.normalize()
+	urls, err := ssdpProbeURLs(hosts, &opts)
+	if nil != err {
+		return
+	}
+	ifis, _ := Interfaces(AllInterfaces)
+	client := &http.Client{Timeout: opts.Timeout}
+	queue := make(chan ssdpProbeURL)
+	var wait sync.WaitGroup
+	var lock sync.Mutex
+	found := 0
+	for i := 0; i < opts.Concurrency; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for url := range queue {
+				responses, err := this.ssdpProbeHost(client, url.location, ifis)
+				if nil != err {
+					if !url.quiet {
+						log.Printf("Probe failed: %v", err)
+					}
+					continue
+				}
+				for _, msg := range responses {
+					this.ssdpIncludeResponse(msg)
+				}
+				lock.Lock()
+				found += 1
+				lock.Unlock()
+			}
+		}()
+	}
+	for _, url := range urls {
+		queue <- url
+	}
+	close(queue)
+	wait.Wait()
+	if 0 == found && 0 < len(urls) {
+		err = errors.New("No device answered the probe")
+	}
+	return
+}
@@ -29,7 +29,7 @@
 //
 
 //
-// A client implementation of the SSDP protocol.
+// An implementation of the SSDP protocol.
 //
 //	mgr := ssdp.MakeManager()
 //	mgr.Discover("eth0", "13104", false)
@@ -44,6 +44,17 @@
 //	}
 //	mgr.Close()
 //
+// Discovered resources are dropped once the max-age advertised in their
+// CACHE-CONTROL header passes without a renewal, or as soon as they send
+// ssdp:byebye.  Each dropped device is posted to ExpiryChannel().
+//
+// Devices of our own are announced with an Advertiser:
+//
+//	adv := ssdp.MakeAdvertiser(&ssdp.Advertisement{...})
+//	adv.Advertise(ssdp.AllInterfaces)
+//	...
+//	adv.Close()
+//
 package ssdp
 
 import (
@@ -58,10 +69,12 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 var ssdpHNAPRegex *regexp.Regexp
+var ssdpMaxAgeRegex *regexp.Regexp
 var ssdpOtherDeviceRegex *regexp.Regexp
 var ssdpOtherDeviceUUIDRegex *regexp.Regexp
 var ssdpOtherServiceRegex *regexp.Regexp
@@ -78,6 +91,7 @@ var ssdpUPnPUIDRegex *regexp.Regexp
 
 func init() {
 	ssdpHNAPRegex = regexp.MustCompile("^hnap:(.+)$")
+	ssdpMaxAgeRegex = regexp.MustCompile("(?i)max-age\\s*=\\s*\"?([0-9]+)\"?")
 	ssdpOtherDeviceRegex = regexp.MustCompile("^urn:([^:]+):device:([^:]+)(:(.+))?$")
 	ssdpOtherDeviceUUIDRegex = regexp.MustCompile("^uuid:([^:]+)::urn:([^:]+):device:([^:]+)(:(.+))?$")
 	ssdpOtherServiceRegex = regexp.MustCompile("^urn:([^:]+):service:([^:]+)(:(.+))?$")
@@ -94,8 +108,28 @@ func init() {
 }
 
 const (
-	ssdpBroadcastGroup   = "239.255.255.250:1900"
-	ssdpBroadcastVersion = "udp"
+	ssdpBroadcastGroup = "239.255.255.250:1900"
+	// The IPv6 link-local and site-local SSDP groups
+	ssdpBroadcastGroupLinkLocal = "[FF02::C]:1900"
+	ssdpBroadcastGroupSiteLocal = "[FF05::C]:1900"
+)
+
+// Returns the multicast groups to search in the given address family
+func ssdpBroadcastGroups(family string) []string {
+	if Family_IPv6 == family {
+		return []string{ssdpBroadcastGroupLinkLocal, ssdpBroadcastGroupSiteLocal}
+	}
+	return []string{ssdpBroadcastGroup}
+}
+
+const (
+	// The lifetime assumed for an advertisement without a usable
+	// CACHE-CONTROL header (the minimum allowed by UPnP 1.1)
+	ssdpDefaultMaxAge = 1800 * time.Second
+	// How often the background sweeper looks for expired resources
+	ssdpSweepInterval = 5 * time.Second
+	// Room for expiry notifications that have not yet been read
+	ssdpExpiryQueueLength = 64
 )
 
 // Type protection for a device URI
@@ -117,8 +151,28 @@ type ssdpServerDescription struct {
 
 type ssdpResourceBase struct {
 	ssdpServerDescription
-	location Location
-	uuid     UUID
+	location  Location
+	uuid      UUID
+	lastSeen  time.Time
+	expires   time.Time
+	ifiname   string
+	localAddr net.IP
+}
+
+// Record that @res was advertised, pushing back the expiry time of this
+// resource by the advertised max-age.  An advertisement never shortens
+// the lifetime granted by an earlier one.
+func (this *ssdpResourceBase) ssdpTouch(res *ssdpResource) {
+	this.lastSeen = res.seen
+	this.ifiname = res.ifiname
+	this.localAddr = res.localAddr
+	if expires := res.seen.Add(res.maxAge); expires.After(this.expires) {
+		this.expires = expires
+	}
+}
+
+func (this *ssdpResourceBase) ssdpExpired(now time.Time) bool {
+	return now.After(this.expires)
 }
 
 // An abstraction of an SSDP service
@@ -157,6 +211,14 @@ type Device interface {
 	Service(key ServiceKey) (service Service, has bool)
 	// Return a list of services implemented by this device
 	Services() []ServiceKey
+	// The time of the most recent advertisement or search response
+	// naming this device
+	LastSeen() time.Time
+	// The name of the network interface on which the device was found
+	Interface() string
+	// The local address, on that interface, from which the device is
+	// reachable
+	LocalAddr() net.IP
 }
 
 type ssdpDevice struct {
@@ -192,6 +254,18 @@ func (this *ssdpDevice) Service(key ServiceKey) (service Service, has bool) {
 	return
 }
 
+func (this *ssdpDevice) LastSeen() time.Time {
+	return this.lastSeen
+}
+
+func (this *ssdpDevice) Interface() string {
+	return this.ifiname
+}
+
+func (this *ssdpDevice) LocalAddr() net.IP {
+	return this.localAddr
+}
+
 func (this *ssdpDevice) Services() []ServiceKey {
 	i := 0
 	keys := make([]ServiceKey, len(this.services))
@@ -228,13 +302,18 @@ const (
 
 type ssdpResource struct {
 	ssdpServerDescription
-	ssdptype ssdpResourceType
-	uuid     UUID
-	name     string
-	version  int64
-	uri      string
-	location Location
-	children []*ssdpResource
+	ssdptype  ssdpResourceType
+	uuid      UUID
+	name      string
+	version   int64
+	uri       string
+	location  Location
+	children  []*ssdpResource
+	seen      time.Time
+	maxAge    time.Duration
+	retire    bool
+	ifiname   string
+	localAddr net.IP
 }
 
 type ssdpMessageType int
@@ -253,6 +332,7 @@ type ssdpRawMessage struct {
 }
 
 type ssdpNotifyMessage struct {
+	ssdpServerDescription
 	_01_nls            string
 	cache_control      string
 	host               string
@@ -265,31 +345,36 @@ type ssdpNotifyMessage struct {
 	x_rincon_bootseq   string
 	x_rincon_household string
 	x_user_agent       string
+	ifiname            string
+	localAddr          net.IP
 }
 
 type ssdpNotifyQueue chan *ssdpNotifyMessage
 
 type ssdpResponseMessage struct {
 	ssdpServerDescription
-	_01_nls            string
-	al                 string
-	cache_control      string
-	date               string
-	ext                string
-	location           Location
-	opt                string
-	st                 string
-	usn                string
-	x_rincon_bootseq   string
-	x_rincon_household string
-	x_rincon_variant   string
-	x_rincon_wifimode  string
-	x_user_agent       string
-	content_length     string
-	bootid_upnp_org    string
-	configid_upnp_org  string
+	_01_nls                      string
+	al                           string
+	cache_control                string
+	date                         string
+	ext                          string
+	location                     Location
+	nts                          string
+	opt                          string
+	st                           string
+	usn                          string
+	x_rincon_bootseq             string
+	x_rincon_household           string
+	x_rincon_variant             string
+	x_rincon_wifimode            string
+	x_user_agent                 string
+	content_length               string
+	bootid_upnp_org              string
+	configid_upnp_org            string
 	household_smartspeaker_audio string
-	x_av_server_info   string
+	x_av_server_info             string
+	ifiname                      string
+	localAddr                    net.IP
 }
 
 type ssdpResponseQueue chan *ssdpResponseMessage
@@ -299,22 +384,181 @@ type ssdpConnection struct {
 	addr *net.UDPAddr
 }
 
+// A multicast group, with the HOST header used to address it
+type ssdpGroup struct {
+	host string
+	addr *net.UDPAddr
+}
+
+// The connections used to search from and listen on one interface in
+// one address family
+type ssdpSocket struct {
+	ifi       net.Interface
+	family    string
+	groups    []ssdpGroup
+	unicast   ssdpConnection
+	multicast []ssdpConnection
+}
+
 // A map of service key to minimum required version
 type ServiceQueryTerms map[ServiceKey]int64
 
+// The search target that matches every device and service
+const SearchTarget_All = "ssdp:all"
+
+//
+// Parameters controlling how an SSDP search is sent and how long to wait
+// for the replies.
+//
+type DiscoveryOptions struct {
+	// The total time to wait for responses, across all retransmits; the
+	// default when zero or less
+	Duration time.Duration
+	// The maximum number of seconds a device may wait before replying;
+	// UPnP allows 1 to 5
+	MX int
+	// The number of times each search is sent, spaced evenly across
+	// Duration, to make up for lost UDP packets
+	Retransmits int
+	// The search targets (ST) to query, e.g.
+	// "urn:schemas-upnp-org:device:ZonePlayer:1"; empty means ssdp:all
+	SearchTargets []string
+	// When positive, stop waiting as soon as this many distinct devices
+	// have answered one of the search targets
+	MinDevices int
+	// The address families to search (Family_IPv4, Family_IPv6); empty
+	// means IPv4 only.  IPv6 searches are sent to both the link-local
+	// (FF02::C) and site-local (FF05::C) groups.
+	Families []string
+}
+
+//
+// Returns the options used by Discover(): two ssdp:all searches three
+// seconds apart, with an MX of 3.
+//
+func DefaultDiscoveryOptions() *DiscoveryOptions {
+	return &DiscoveryOptions{
+		Duration:      6 * time.Second,
+		MX:            3,
+		Retransmits:   2,
+		SearchTargets: []string{SearchTarget_All},
+		Families:      []string{Family_IPv4},
+	}
+}
+
+func (this *DiscoveryOptions) normalize() (options DiscoveryOptions) {
+	if nil == this {
+		return *DefaultDiscoveryOptions()
+	}
+	options = *this
+	if options.Duration <= 0 {
+		options.Duration = DefaultDiscoveryOptions().Duration
+	}
+	if options.MX < 1 {
+		options.MX = 1
+	} else if options.MX > 5 {
+		options.MX = 5
+	}
+	if options.Retransmits < 1 {
+		options.Retransmits = 1
+	}
+	if 0 == len(options.SearchTargets) {
+		options.SearchTargets = []string{SearchTarget_All}
+	}
+	if 0 == len(options.Families) {
+		options.Families = []string{Family_IPv4}
+	}
+	return
+}
+
+// The state of a search in progress
+type ssdpSearchState struct {
+	targets map[string]bool
+	matched map[UUID]bool
+	needed  int
+	done    chan int
+}
+
+func ssdpNewSearch(options *DiscoveryOptions) (search *ssdpSearchState) {
+	search = &ssdpSearchState{}
+	search.targets = make(map[string]bool)
+	for _, st := range options.SearchTargets {
+		search.targets[st] = true
+	}
+	search.matched = make(map[UUID]bool)
+	search.needed = options.MinDevices
+	search.done = make(chan int)
+	return
+}
+
+// Count a device answering @st, signalling completion once enough
+// distinct devices have answered.
+func (this *ssdpSearchState) ssdpCount(st, usn string) {
+	if 0 >= this.needed || this.needed <= len(this.matched) {
+		return
+	} else if !this.targets[SearchTarget_All] && !this.targets[st] {
+		return
+	}
+	if uuid := ssdpUUIDFromUSN(usn); 0 < len(uuid) {
+		this.matched[uuid] = true
+		if this.needed <= len(this.matched) {
+			close(this.done)
+		}
+	}
+}
+
+// Extract the UUID from a Unique Service Name (e.g. "uuid:X::upnp:rootdevice")
+func ssdpUUIDFromUSN(usn string) UUID {
+	if m := ssdpUPnPUIDRegex.FindStringSubmatch(strings.SplitN(usn, "::", 2)[0]); 0 < len(m) {
+		return UUID(m[1])
+	}
+	return ""
+}
+
 // Encapsulates SSDP discovery, handles updates, and stores results
 type Manager interface {
 	// Initiates SSDP discovery, where ifiname names a network device
 	// to query, port gives a free port on that network device to listen
 	// for responses, and the subscribe flag (currrently unimplemented)
 	// determines whether to listen to asynchronous updates after the
-	// initial query is complete.
+	// initial query is complete.  Several devices may be queried at
+	// once by giving a comma-separated list (e.g. "eth0,wlan0"), or
+	// AllInterfaces to query every multicast-capable device; the results
+	// are merged.  An error is returned if no socket can be opened or no
+	// query sent.
 	Discover(ifiname, port string, subscribe bool) error
+	// As Discover(), with the search targets and timing given by options.
+	DiscoverWithOptions(ifiname, port string, subscribe bool, options *DiscoveryOptions) error
+	// Fetches the device description of each of @hosts directly over
+	// HTTP, for networks where multicast does not reach the devices.
+	// Entries may be addresses or host names, with or without a port,
+	// or CIDR ranges; the devices found are merged with those from
+	// Discover().  Probed devices expire with their max-age and are not
+	// renewed by advertisements, so a long-running caller should probe
+	// again within it.
+	Probe(hosts []string, options *ProbeOptions) error
+	// Listens passively on the multicast groups of ifiname, recording
+	// every message seen without sending any search.  Messages are
+	// still applied to the device list.
+	Sniff(ifiname string) error
+	// Returns the messages recorded since Sniff() was called
+	Capture() []CaptureEntry
+	// Writes the messages recorded since Sniff() was called to the
+	// named file, one JSON object per line
+	SaveCapture(filename string) error
+	// Feeds the messages in a capture file through the parser and into
+	// the device list, as if they had just been received
+	ReplayCapture(filename string) error
 	// After discovery is complete searches for devices implementing
 	// the services specified in query.
 	QueryServices(query ServiceQueryTerms) ServiceMap
 	// Return the list of devices that were found during discovery
 	Devices() DeviceMap
+	// Returns a channel that receives each device as it is dropped
+	// from the device list, either because its advertisement was not
+	// renewed within the advertised max-age or because the device
+	// announced that it was leaving the network.
+	ExpiryChannel() chan Device
 	// Shuts down asynchronous subscriptions to device state
 	Close() error
 }
@@ -322,13 +566,19 @@ type Manager interface {
 type ssdpDefaultManager struct {
 	responseQueue ssdpResponseQueue
 	notifyQueue   ssdpNotifyQueue
-	unicast       ssdpConnection
-	multicast     ssdpConnection
+	sockets       []*ssdpSocket
 	rootDeviceMap ssdpRootDeviceMap
 	deviceMap     DeviceMap
 	serviceMap    ServiceMap
+	search        *ssdpSearchState
+	expiryChan    chan Device
 	readyChan     chan int
 	closeChan     chan int
+	stopChan      chan int
+	running       bool
+	capturing     bool
+	capture       []CaptureEntry
+	lock          sync.Mutex
 }
 
 // Returns an empty manager ready for SSDP discovery
@@ -336,22 +586,28 @@ func MakeManager() Manager {
 	mgr := &ssdpDefaultManager{}
 	mgr.responseQueue = make(ssdpResponseQueue)
 	mgr.notifyQueue = make(ssdpNotifyQueue)
-	mgr.unicast = ssdpConnection{}
-	mgr.multicast = ssdpConnection{}
 	mgr.rootDeviceMap = make(ssdpRootDeviceMap)
 	mgr.deviceMap = make(DeviceMap)
 	mgr.serviceMap = make(ServiceMap)
+	mgr.expiryChan = make(chan Device, ssdpExpiryQueueLength)
 	mgr.readyChan = make(chan int)
 	mgr.closeChan = make(chan int)
+	mgr.stopChan = make(chan int)
 	return mgr
 }
 
 func (this *ssdpDefaultManager) Discover(ifiname, port string, subscribe bool) (err error) {
-	this.ssdpDiscoverImpl(ifiname, port, subscribe)
-	return
+	return this.DiscoverWithOptions(ifiname, port, subscribe, DefaultDiscoveryOptions())
+}
+
+func (this *ssdpDefaultManager) DiscoverWithOptions(ifiname, port string, subscribe bool, options *DiscoveryOptions) (err error) {
+	opts := options.normalize()
+	return this.ssdpDiscoverImpl(ifiname, port, subscribe, &opts)
 }
 
 func (this *ssdpDefaultManager) QueryServices(query ServiceQueryTerms) (results ServiceMap) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
 	results = make(ServiceMap)
 	for name, minver := range query {
 		results[name] = make(DeviceMap)
@@ -369,30 +625,62 @@ func (this *ssdpDefaultManager) QueryServices(query ServiceQueryTerms) (results
 	return
 }
 
-func (this *ssdpDefaultManager) Devices() DeviceMap {
-	return this.deviceMap
+func (this *ssdpDefaultManager) Devices() (devices DeviceMap) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	devices = make(DeviceMap)
+	for uuid, de := range this.deviceMap {
+		devices[uuid] = de
+	}
+	return
+}
+
+func (this *ssdpDefaultManager) ExpiryChannel() chan Device {
+	return this.expiryChan
 }
 
 func (this *ssdpDefaultManager) Close() (err error) {
-	if nil != this.unicast.conn {
-		this.unicast.conn.Close()
-		<-this.closeChan
+	for _, sock := range this.sockets {
+		if nil != sock.unicast.conn {
+			sock.unicast.conn.Close()
+			<-this.closeChan
+		}
+		for _, mc := range sock.multicast {
+			mc.conn.Close()
+			<-this.closeChan
+		}
 	}
-	if nil != this.multicast.conn {
-		this.multicast.conn.Close()
-		<-this.closeChan
+	this.sockets = nil
+	this.lock.Lock()
+	running := this.running
+	this.running = false
+	this.lock.Unlock()
+	if running {
+		this.stopChan <- 1
 	}
 	return
 }
 
+// Starts ssdpUpdateLoop() unless it is already running
+func (this *ssdpDefaultManager) ssdpStartUpdateLoop() {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if !this.running {
+		this.running = true
+		go this.ssdpUpdateLoop()
+	}
+}
+
 func ssdpNewDevice(res *ssdpResource) (de *ssdpDevice) {
 	de = new(ssdpDevice)
 	de.ssdpServerDescription = res.ssdpServerDescription
 	de.uuid = res.uuid
 	de.location = res.location
-	de.name = res.name
-	de.version = res.version
-	de.uri = res.uri
+	if ssdpTypeDevice == res.ssdptype {
+		de.name = res.name
+		de.version = res.version
+		de.uri = res.uri
+	}
 	de.services = make(ssdpServiceSet)
 	return
 }
@@ -420,9 +708,50 @@ func ssdpNewResource(uuid UUID) (res *ssdpResource) {
 	res = new(ssdpResource)
 	res.ssdptype = ssdpTypeUnknown
 	res.uuid = uuid
+	res.seen = time.Now()
+	res.maxAge = ssdpDefaultMaxAge
+	return
+}
+
+// Create a resource for @uuid carrying the fields common to every
+// search response and advertisement.
+func ssdpNewResponseResource(uuid UUID, ssdpsm *ssdpResponseMessage) (res *ssdpResource) {
+	res = ssdpNewResource(uuid)
+	res.ssdpServerDescription = ssdpsm.ssdpServerDescription
+	res.location = ssdpsm.location
+	res.ifiname = ssdpsm.ifiname
+	res.localAddr = ssdpsm.localAddr
+	res.maxAge = ssdpParseMaxAge(ssdpsm.cache_control)
+	res.retire = "ssdp:byebye" == ssdpsm.nts
 	return
 }
 
+// Extract the max-age directive from a CACHE-CONTROL header, falling
+// back to the UPnP default when the header is absent or malformed.
+func ssdpParseMaxAge(cacheControl string) time.Duration {
+	if m := ssdpMaxAgeRegex.FindStringSubmatch(cacheControl); 0 < len(m) {
+		if secs, err := strconv.ParseInt(m[1], 10, 32); nil == err {
+			return time.Duration(secs) * time.Second
+		}
+	}
+	if 0 < len(cacheControl) {
+		log.Printf("Invalid cache control `%s'", cacheControl)
+	}
+	return ssdpDefaultMaxAge
+}
+
+func ssdpParseServerString(desc *ssdpServerDescription, value string) {
+	if m := ssdpServerStringRegexp.FindStringSubmatch(value); 0 < len(m) {
+		desc.os = m[1]
+		desc.os_version = m[3]
+		desc.upnp_version = m[5]
+		desc.product = m[6]
+		desc.productVersion = m[8]
+	} else {
+		log.Printf("Invalid server description `%s'", value)
+	}
+}
+
 func ssdpNewService(res *ssdpResource) (sv *ssdpService) {
 	sv = new(ssdpService)
 	sv.ssdpServerDescription = res.ssdpServerDescription
@@ -434,7 +763,7 @@ func ssdpNewService(res *ssdpResource) (sv *ssdpService) {
 	return
 }
 
-func (this *ssdpDefaultManager) ssdpParseStartLineFields(raw *ssdpRawMessage, fields []string) {
+func ssdpParseStartLineFields(raw *ssdpRawMessage, fields []string) {
 	if "M-SEARCH" == fields[0] {
 		raw.msgtype = ssdpSearch
 	} else if "NOTIFY" == fields[0] {
@@ -447,16 +776,16 @@ func (this *ssdpDefaultManager) ssdpParseStartLineFields(raw *ssdpRawMessage, fi
 	}
 }
 
-func (this *ssdpDefaultManager) ssdpParseStartLine(raw *ssdpRawMessage, line []byte) {
+func ssdpParseStartLine(raw *ssdpRawMessage, line []byte) {
 	fields := strings.Fields(string(line))
 	if 3 != len(fields) {
 		panic("Invalid start line")
 	} else {
-		this.ssdpParseStartLineFields(raw, fields)
+		ssdpParseStartLineFields(raw, fields)
 	}
 }
 
-func (this *ssdpDefaultManager) ssdpParseHeaderLine(raw *ssdpRawMessage, line []byte) {
+func ssdpParseHeaderLine(raw *ssdpRawMessage, line []byte) {
 	i := strings.Index(string(line), ":")
 	if -1 == i {
 		panic("Invalid header")
@@ -470,15 +799,15 @@ func (this *ssdpDefaultManager) ssdpParseHeaderLine(raw *ssdpRawMessage, line []
 	}
 }
 
-func (this *ssdpDefaultManager) ssdpParseInputLine(raw *ssdpRawMessage, line []byte, lineno int) {
+func ssdpParseInputLine(raw *ssdpRawMessage, line []byte, lineno int) {
 	if 1 < lineno {
-		this.ssdpParseHeaderLine(raw, line)
+		ssdpParseHeaderLine(raw, line)
 	} else {
-		this.ssdpParseStartLine(raw, line)
+		ssdpParseStartLine(raw, line)
 	}
 }
 
-func (this *ssdpDefaultManager) ssdpParseInput(msg []byte) (raw *ssdpRawMessage) {
+func ssdpParseInput(msg []byte) (raw *ssdpRawMessage) {
 	raw = ssdpNewRawMessage()
 	bin := bufio.NewReader(bytes.NewReader(msg))
 	var line []byte
@@ -491,7 +820,7 @@ func (this *ssdpDefaultManager) ssdpParseInput(msg []byte) (raw *ssdpRawMessage)
 				if 1 < lineno && 0 == len(line) {
 					break
 				}
-				this.ssdpParseInputLine(raw, line, lineno)
+				ssdpParseInputLine(raw, line, lineno)
 				line = nil
 			}
 		} else if io.EOF == err {
@@ -511,6 +840,7 @@ func (this *ssdpDefaultManager) ssdpHandleNotify(raw *ssdpRawMessage) *ssdpNotif
 			msg.location = Location(value)
 		case "Server":
 			msg.server = value
+			ssdpParseServerString(&msg.ssdpServerDescription, value)
 		case "Host":
 			msg.host = value
 		case "Usn":
@@ -547,16 +877,7 @@ func (this *ssdpDefaultManager) ssdpHandleResponse(raw *ssdpRawMessage) *ssdpRes
 		case "St":
 			msg.st = value
 		case "Server":
-			m := ssdpServerStringRegexp.FindStringSubmatch(value)
-			if 0 < len(m) {
-				msg.os = m[1]
-				msg.os_version = m[3]
-				msg.upnp_version = m[5]
-				msg.product = m[6]
-				msg.productVersion = m[8]
-			} else {
-				log.Printf("Invalid server description `%s'", value)
-			}
+			ssdpParseServerString(&msg.ssdpServerDescription, value)
 		case "Opt":
 			msg.opt = value
 		case "Usn":
@@ -599,17 +920,38 @@ func (this *ssdpDefaultManager) ssdpHandleResponse(raw *ssdpRawMessage) *ssdpRes
 	return msg
 }
 
-func (this *ssdpDefaultManager) ssdpHandleMessage(raw *ssdpRawMessage) {
+func (this *ssdpDefaultManager) ssdpHandleMessage(raw *ssdpRawMessage, sock *ssdpSocket) {
 	switch raw.msgtype {
 	case ssdpSearch: /*ignore*/
 	case ssdpResponse:
-		this.responseQueue <- this.ssdpHandleResponse(raw)
+		msg := this.ssdpHandleResponse(raw)
+		msg.ifiname = sock.ifi.Name
+		msg.localAddr = sock.unicast.addr.IP
+		this.responseQueue <- msg
 	case ssdpNotify:
-		this.notifyQueue <- this.ssdpHandleNotify(raw)
+		msg := this.ssdpHandleNotify(raw)
+		msg.ifiname = sock.ifi.Name
+		msg.localAddr = sock.unicast.addr.IP
+		this.notifyQueue <- msg
 	}
 }
 
-func (this *ssdpDefaultManager) ssdpDiscoverLoop(conn net.Conn) {
+// Record and handle one datagram; a message that does not parse is
+// logged and dropped without disturbing the listener.
+func (this *ssdpDefaultManager) ssdpHandlePacket(packet []byte, addr *net.UDPAddr, sock *ssdpSocket) {
+	var raw *ssdpRawMessage
+	defer func() {
+		if r := recover(); nil != r {
+			log.Printf("Ignoring malformed message from %s: %v", addr, r)
+		}
+		this.ssdpRecord(packet, addr, sock, raw)
+	}()
+	if raw = ssdpParseInput(packet); nil != raw {
+		this.ssdpHandleMessage(raw, sock)
+	}
+}
+
+func (this *ssdpDefaultManager) ssdpDiscoverLoop(conn *net.UDPConn, sock *ssdpSocket) {
 	this.readyChan <- 1
 	msg := make([]byte, 65536) /*max size of a single UDP packet*/
 	defer func() {
@@ -617,70 +959,64 @@ func (this *ssdpDefaultManager) ssdpDiscoverLoop(conn net.Conn) {
 		this.closeChan <- 1
 	}()
 	for {
-		if n, err := conn.Read(msg); nil != err {
+		if n, addr, err := conn.ReadFromUDP(msg); nil != err {
 			panic(err)
-		} else if raw := this.ssdpParseInput(msg[:n]); nil != raw {
-			this.ssdpHandleMessage(raw)
+		} else {
+			this.ssdpHandlePacket(msg[:n], addr, sock)
 		}
 	}
 }
 
-func (this *ssdpDefaultManager) ssdpUnicastDiscoverImpl(ifi *net.Interface, port string) (err error) {
-	addrs, err := ifi.Addrs()
+func (this *ssdpDefaultManager) ssdpUnicastDiscoverImpl(sock *ssdpSocket, port string) (err error) {
+	lip, err := InterfaceAddrFamily(&sock.ifi, sock.family)
 	if nil != err {
 		return
-	} else if 0 == len(addrs) {
-		err = errors.New(fmt.Sprintf("No addresses found for interface %s", ifi.Name))
-		return
 	}
-	var lip net.IP
-	for _, addr := range addrs {
-		if nil != addr.(*net.IPNet).IP.DefaultMask() {
-			lip = addr.(*net.IPNet).IP
-			break;
-		}
-	}
-	laddr, err := net.ResolveUDPAddr(ssdpBroadcastVersion, net.JoinHostPort(lip.String(), port))
+	laddr, err := net.ResolveUDPAddr(sock.family, net.JoinHostPort(lip.String(), port))
 	if nil != err {
 		return
 	}
-	uc, err := net.ListenUDP(ssdpBroadcastVersion, laddr)
+	uc, err := net.ListenUDP(sock.family, laddr)
 	if nil != err {
 		return
 	}
-	this.unicast.addr = laddr
-	this.unicast.conn = uc
-	go this.ssdpDiscoverLoop(uc)
+	sock.unicast.addr = laddr
+	sock.unicast.conn = uc
+	go this.ssdpDiscoverLoop(uc, sock)
 	<-this.readyChan
 	return
 }
 
-func (this *ssdpDefaultManager) ssdpMulticastDiscoverImpl(ifi *net.Interface, subscribe bool) (err error) {
-	maddr, err := net.ResolveUDPAddr(ssdpBroadcastVersion, ssdpBroadcastGroup)
-	if nil != err {
-		return
-	}
-	this.multicast.addr = maddr
-	var mc *net.UDPConn
-	if subscribe {
-		mc, err = net.ListenMulticastUDP(ssdpBroadcastVersion, ifi, maddr)
-		if nil != err {
+func (this *ssdpDefaultManager) ssdpMulticastDiscoverImpl(sock *ssdpSocket, subscribe bool) (err error) {
+	for _, group := range ssdpBroadcastGroups(sock.family) {
+		var maddr *net.UDPAddr
+		if maddr, err = net.ResolveUDPAddr(sock.family, group); nil != err {
 			return
 		}
-		this.multicast.conn = mc
-		go this.ssdpDiscoverLoop(mc)
-		<-this.readyChan
+		if Family_IPv6 == sock.family {
+			maddr.Zone = sock.ifi.Name
+		}
+		sock.groups = append(sock.groups, ssdpGroup{group, maddr})
+		if subscribe {
+			var mc *net.UDPConn
+			if mc, err = net.ListenMulticastUDP(sock.family, &sock.ifi, maddr); nil != err {
+				return
+			}
+			sock.multicast = append(sock.multicast, ssdpConnection{mc, maddr})
+			go this.ssdpDiscoverLoop(mc, sock)
+			<-this.readyChan
+		}
 	}
 	return
 }
 
-func (this *ssdpDefaultManager) ssdpQueryMessage(timeout int) (msg *bytes.Buffer) {
+func (this *ssdpDefaultManager) ssdpQueryMessage(timeout int, st, host string) (msg *bytes.Buffer) {
 	msg = new(bytes.Buffer)
 	msg.WriteString("M-SEARCH * HTTP/1.1\r\n")
-	msg.WriteString("HosT: 239.255.255.250:1900\r\n")
+	msg.WriteString(fmt.Sprintf("HosT: %s\r\n", host))
 	msg.WriteString("MAN: \"ssdp:discover\"\r\n")
 	msg.WriteString(fmt.Sprintf("MX: %d\r\n", timeout))
-	msg.WriteString("ST: ssdp:all\r\n")
+	msg.WriteString(fmt.Sprintf("ST: %s\r\n", st))
 	msg.WriteString("USER-AGENT: unix/5.1 UPnP/1.1 crash/1.0\r\n")
 	msg.WriteString("\r\n")
 	return
@@ -692,6 +1028,7 @@ func (this *ssdpDefaultManager) ssdpRequiressdpRootDevice(res *ssdpResource) (rd
 		rd = ssdpNewssdpRootDevice(res)
 		this.rootDeviceMap[rd.location] = rd
 	}
+	rd.ssdpTouch(res)
 	return
 }
 
@@ -701,7 +1038,14 @@ func (this *ssdpDefaultManager) ssdpRequireDevice(res *ssdpResource) (de *ssdpDe
 		this.deviceMap[res.uuid] = de
 	} else {
 		de = raw.(*ssdpDevice)
+		if "" == de.name && ssdpTypeDevice == res.ssdptype {
+			/*named by the first device-type advertisement*/
+			de.name = res.name
+			de.version = res.version
+			de.uri = res.uri
+		}
 	}
+	de.ssdpTouch(res)
 	return
 }
 
@@ -725,24 +1069,37 @@ func (this *ssdpDefaultManager) ssdpGetServiceKey(sv *ssdpService) (key ServiceK
 	return
 }
 
-func (this *ssdpDefaultManager) ssdpRequireService(de *ssdpDevice, sv *ssdpService) {
+func (this *ssdpDefaultManager) ssdpRequireService(de *ssdpDevice, sv *ssdpService, res *ssdpResource) {
 	key := this.ssdpGetServiceKey(sv)
-	if _, has := de.services[key]; !has {
+	if old, has := de.services[key]; !has {
 		de.services[key] = sv
 		if _, has := this.serviceMap[key]; !has {
 			this.serviceMap[key] = make(DeviceMap)
 		}
 		this.serviceMap[key][de.UUID()] = de
+	} else {
+		sv = old.(*ssdpService)
 	}
+	sv.ssdpTouch(res)
 }
 
 func (this *ssdpDefaultManager) ssdpNotifyService(res *ssdpResource) {
 	de := this.ssdpRequireDevice(res)
 	sv := ssdpNewService(res)
-	this.ssdpRequireService(de, sv)
+	this.ssdpRequireService(de, sv, res)
+}
+
+func (this *ssdpDefaultManager) ssdpNotifyUUID(res *ssdpResource) {
+	if raw, has := this.deviceMap[res.uuid]; has {
+		raw.(*ssdpDevice).ssdpTouch(res)
+	}
 }
 
 func (this *ssdpDefaultManager) ssdpNotifyResource(res *ssdpResource) {
+	if res.retire {
+		this.ssdpRetireResource(res)
+		return
+	}
 	switch res.ssdptype {
 	case ssdpTypessdpRootDevice:
 		this.ssdpNotifyssdpRootDevice(res)
@@ -753,19 +1110,83 @@ func (this *ssdpDefaultManager) ssdpNotifyResource(res *ssdpResource) {
 	case ssdpTypeHNAP:
 		/*TODO*/
 	case ssdpTypeUUID:
-		/*TODO ... not sure what to do*/
+		this.ssdpNotifyUUID(res)
 	default:
 		log.Fatalf("Unhandled ssdptype %d", res.ssdptype)
 	}
 }
 
+func (this *ssdpDefaultManager) ssdpRemoveService(de *ssdpDevice, key ServiceKey) {
+	delete(de.services, key)
+	if dlist, has := this.serviceMap[key]; has {
+		delete(dlist, de.UUID())
+		if 0 == len(dlist) {
+			delete(this.serviceMap, key)
+		}
+	}
+}
+
+func (this *ssdpDefaultManager) ssdpRemoveDevice(de *ssdpDevice) {
+	for key, _ := range de.services {
+		this.ssdpRemoveService(de, key)
+	}
+	for location, rd := range this.rootDeviceMap {
+		delete(rd.Devices, de.UUID())
+		if rd.uuid == de.uuid {
+			delete(this.rootDeviceMap, location)
+		}
+	}
+	delete(this.deviceMap, de.UUID())
+	select {
+	case this.expiryChan <- de:
+	default:
+		log.Printf("Dropped expiry notification for %s", de.UUID())
+	}
+}
+
+// Handle an ssdp:byebye announcement.  A device leaving the network takes
+// its services with it; a service leaving only removes that service.
+func (this *ssdpDefaultManager) ssdpRetireResource(res *ssdpResource) {
+	raw, has := this.deviceMap[res.uuid]
+	if !has {
+		return
+	}
+	de := raw.(*ssdpDevice)
+	switch res.ssdptype {
+	case ssdpTypessdpRootDevice, ssdpTypeDevice, ssdpTypeUUID:
+		this.ssdpRemoveDevice(de)
+	case ssdpTypeService:
+		this.ssdpRemoveService(de, this.ssdpGetServiceKey(ssdpNewService(res)))
+	}
+}
+
+// Drop every resource whose advertisement was not renewed in time.
+func (this *ssdpDefaultManager) ssdpSweep(now time.Time) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	for _, raw := range this.deviceMap {
+		de := raw.(*ssdpDevice)
+		if de.ssdpExpired(now) {
+			this.ssdpRemoveDevice(de)
+			continue
+		}
+		for key, sv := range de.services {
+			if sv.(*ssdpService).ssdpExpired(now) {
+				this.ssdpRemoveService(de, key)
+			}
+		}
+	}
+	for location, rd := range this.rootDeviceMap {
+		if rd.ssdpExpired(now) {
+			delete(this.rootDeviceMap, location)
+		}
+	}
+}
+
 func (this *ssdpDefaultManager) ssdpIncludessdpRootDevice(ssdpsm *ssdpResponseMessage) {
 	if n := ssdpRootDeviceUUIDRegex.FindStringSubmatch(ssdpsm.usn); 0 < len(n) {
 		uuid := UUID(n[1])
-		res := ssdpNewResource(uuid)
-		res.ssdpServerDescription = ssdpsm.ssdpServerDescription
-		res.uuid = uuid
-		res.location = ssdpsm.location
+		res := ssdpNewResponseResource(uuid, ssdpsm)
 		res.ssdptype = ssdpTypessdpRootDevice
 		this.ssdpNotifyResource(res)
 	} else {
@@ -776,13 +1197,11 @@ func (this *ssdpDefaultManager) ssdpIncludessdpRootDevice(ssdpsm *ssdpResponseMe
 func (this *ssdpDefaultManager) ssdpIncludeService(ssdpsm *ssdpResponseMessage) {
 	if n := ssdpUPnPServiceUUIDRegex.FindStringSubmatch(ssdpsm.usn); 0 < len(n) {
 		uuid := UUID(n[1])
-		res := ssdpNewResource(uuid)
-		res.ssdpServerDescription = ssdpsm.ssdpServerDescription
-		res.location = ssdpsm.location
+		res := ssdpNewResponseResource(uuid, ssdpsm)
 		res.ssdptype = ssdpTypeService
 		res.name = n[2]
 		var err error
-		if res.version, err = strconv.ParseInt(n[4], 10, 4); nil != err {
+		if res.version, err = strconv.ParseInt(n[4], 10, 64); nil != err {
 			log.Printf("Error in parsing service version `%s'", n[4])
 		}
 		this.ssdpNotifyResource(res)
@@ -794,13 +1213,11 @@ func (this *ssdpDefaultManager) ssdpIncludeService(ssdpsm *ssdpResponseMessage)
 func (this *ssdpDefaultManager) ssdpIncludeDevice(ssdpsm *ssdpResponseMessage) {
 	if n := ssdpUPnPDeviceUUIDRegex.FindStringSubmatch(ssdpsm.usn); 0 < len(n) {
 		uuid := UUID(n[1])
-		res := ssdpNewResource(uuid)
-		res.ssdpServerDescription = ssdpsm.ssdpServerDescription
-		res.location = ssdpsm.location
+		res := ssdpNewResponseResource(uuid, ssdpsm)
 		res.ssdptype = ssdpTypeDevice
 		res.name = n[2]
 		var err error
-		if res.version, err = strconv.ParseInt(n[4], 10, 4); nil != err {
+		if res.version, err = strconv.ParseInt(n[4], 10, 64); nil != err {
 			log.Printf("Error in parsing device version `%s'", n[4])
 		}
 		this.ssdpNotifyResource(res)
@@ -812,9 +1229,7 @@ func (this *ssdpDefaultManager) ssdpIncludeDevice(ssdpsm *ssdpResponseMessage) {
 func (this *ssdpDefaultManager) ssdpIncludeUUID(ssdpsm *ssdpResponseMessage) {
 	if n := ssdpUPnPBareUUIDRegex.FindStringSubmatch(ssdpsm.usn); 0 < len(n) {
 		uuid := UUID(n[1])
-		res := ssdpNewResource(uuid)
-		res.ssdpServerDescription = ssdpsm.ssdpServerDescription
-		res.location = ssdpsm.location
+		res := ssdpNewResponseResource(uuid, ssdpsm)
 		res.ssdptype = ssdpTypeUUID
 		this.ssdpNotifyResource(res)
 	} else {
@@ -825,9 +1240,7 @@ func (this *ssdpDefaultManager) ssdpIncludeUUID(ssdpsm *ssdpResponseMessage) {
 func (this *ssdpDefaultManager) ssdpIncludeHNAP(ssdpsm *ssdpResponseMessage, name string) {
 	if n := ssdpUPnPBareUUIDRegex.FindStringSubmatch(ssdpsm.usn); 0 < len(n) {
 		uuid := UUID(n[1])
-		res := ssdpNewResource(uuid)
-		res.ssdpServerDescription = ssdpsm.ssdpServerDescription
-		res.location = ssdpsm.location
+		res := ssdpNewResponseResource(uuid, ssdpsm)
 		res.ssdptype = ssdpTypeHNAP
 		res.name = name
 		this.ssdpNotifyResource(res)
@@ -839,15 +1252,13 @@ func (this *ssdpDefaultManager) ssdpIncludeHNAP(ssdpsm *ssdpResponseMessage, nam
 func (this *ssdpDefaultManager) ssdpIncludeOtherService(ssdpsm *ssdpResponseMessage) {
 	if n := ssdpOtherServiceUUIDRegex.FindStringSubmatch(ssdpsm.usn); 0 < len(n) {
 		uuid := UUID(n[1])
-		res := ssdpNewResource(uuid)
-		res.ssdpServerDescription = ssdpsm.ssdpServerDescription
-		res.location = ssdpsm.location
+		res := ssdpNewResponseResource(uuid, ssdpsm)
 		res.ssdptype = ssdpTypeService
 		res.uri = n[2]
 		res.name = n[3]
 		var err error
-		if res.version, err = strconv.ParseInt(n[5], 10, 4); nil != err {
-			log.Printf("Error in parsing service version `%s'", n[4])
+		if res.version, err = strconv.ParseInt(n[5], 10, 64); nil != err {
+			log.Printf("Error in parsing service version `%s'", n[5])
 		}
 		this.ssdpNotifyResource(res)
 	} else {
@@ -858,15 +1269,13 @@ func (this *ssdpDefaultManager) ssdpIncludeOtherService(ssdpsm *ssdpResponseMess
 func (this *ssdpDefaultManager) ssdpIncludeOtherDevice(ssdpsm *ssdpResponseMessage) {
 	if n := ssdpOtherDeviceUUIDRegex.FindStringSubmatch(ssdpsm.usn); 0 < len(n) {
 		uuid := UUID(n[1])
-		res := ssdpNewResource(uuid)
-		res.ssdpServerDescription = ssdpsm.ssdpServerDescription
-		res.location = ssdpsm.location
+		res := ssdpNewResponseResource(uuid, ssdpsm)
 		res.ssdptype = ssdpTypeDevice
 		res.uri = n[2]
 		res.name = n[3]
 		var err error
-		if res.version, err = strconv.ParseInt(n[5], 10, 4); nil != err {
-			log.Printf("Error in parsing device version `%s'", n[4])
+		if res.version, err = strconv.ParseInt(n[5], 10, 64); nil != err {
+			log.Printf("Error in parsing device version `%s'", n[5])
 		}
 		this.ssdpNotifyResource(res)
 	} else {
@@ -875,6 +1284,8 @@ func (this *ssdpDefaultManager) ssdpIncludeOtherDevice(ssdpsm *ssdpResponseMessa
 }
 
 func (this *ssdpDefaultManager) ssdpIncludeResponse(msg *ssdpResponseMessage) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
 	if "upnp:rootdevice" == msg.st {
 		this.ssdpIncludessdpRootDevice(msg)
 	} else if m := ssdpUPnPServiceRegex.FindStringSubmatch(msg.st); 0 < len(m) {
@@ -891,52 +1302,119 @@ func (this *ssdpDefaultManager) ssdpIncludeResponse(msg *ssdpResponseMessage) {
 		this.ssdpIncludeOtherDevice(msg)
 	} else {
 		log.Printf("Unsupported search term [ST] `%s'", msg.st)
+		return
+	}
+	if nil != this.search && "ssdp:byebye" != msg.nts {
+		this.search.ssdpCount(msg.st, msg.usn)
 	}
 }
 
+// A NOTIFY carries the same information as a search response, with the
+// notification type (NT) standing in for the search target (ST).
 func (this *ssdpDefaultManager) ssdpIncludeNotification(msg *ssdpNotifyMessage) {
-	/*TODO*/
+	switch msg.nts {
+	case "ssdp:alive", "ssdp:byebye":
+		this.ssdpIncludeResponse(&ssdpResponseMessage{
+			ssdpServerDescription: msg.ssdpServerDescription,
+			cache_control:         msg.cache_control,
+			location:              msg.location,
+			nts:                   msg.nts,
+			st:                    msg.nt,
+			usn:                   msg.usn,
+			ifiname:               msg.ifiname,
+			localAddr:             msg.localAddr,
+		})
+	default:
+		log.Printf("Unsupported notification subtype [NTS] `%s'", msg.nts)
+	}
 }
 
-func (this *ssdpDefaultManager) ssdpSendQuery(timeout int) (err error) {
-	msg := this.ssdpQueryMessage(timeout)
-	if _, err = this.unicast.conn.WriteTo(msg.Bytes(), this.multicast.addr); nil != err {
-		return
-	} else {
-		timeout := time.NewTimer(time.Duration(timeout) * time.Second)
-		done := false
-		for !done {
-			select {
-			case m := <-this.responseQueue:
-				this.ssdpIncludeResponse(m)
-			case raw := <-this.notifyQueue:
-				this.ssdpIncludeNotification(raw)
-			case <-timeout.C:
-				done = true
+// Apply responses and notifications to the device database as they
+// arrive, and periodically sweep out expired resources.
+func (this *ssdpDefaultManager) ssdpUpdateLoop() {
+	sweep := time.NewTicker(ssdpSweepInterval)
+	defer sweep.Stop()
+	for {
+		select {
+		case m := <-this.responseQueue:
+			this.ssdpIncludeResponse(m)
+		case raw := <-this.notifyQueue:
+			this.ssdpIncludeNotification(raw)
+		case now := <-sweep.C:
+			this.ssdpSweep(now)
+		case <-this.stopChan:
+			return
+		}
+	}
+}
+
+func (this *ssdpDefaultManager) ssdpSendQuery(timeout int, st string) (err error) {
+	sent := false
+	for _, sock := range this.sockets {
+		for _, group := range sock.groups {
+			msg := this.ssdpQueryMessage(timeout, st, group.host)
+			if _, werr := sock.unicast.conn.WriteTo(msg.Bytes(), group.addr); nil != werr {
+				log.Printf("Search on %s via %s failed: %v", sock.ifi.Name, group.host, werr)
+			} else {
+				sent = true
 			}
 		}
 	}
+	if !sent {
+		err = errors.New("Could not send search on any interface")
+	}
 	return
 }
 
-func (this *ssdpDefaultManager) ssdpQueryLoop() (err error) {
-	for i := 0; i < 2; i++ {
-		if err = this.ssdpSendQuery(3 /*timeout seconds*/); nil != err {
+func (this *ssdpDefaultManager) ssdpQueryLoop(options *DiscoveryOptions) (err error) {
+	search := ssdpNewSearch(options)
+	this.lock.Lock()
+	this.search = search
+	this.lock.Unlock()
+	defer func() {
+		this.lock.Lock()
+		this.search = nil
+		this.lock.Unlock()
+	}()
+	interval := options.Duration / time.Duration(options.Retransmits)
+	for i := 0; i < options.Retransmits; i++ {
+		for _, st := range options.SearchTargets {
+			if err = this.ssdpSendQuery(options.MX, st); nil != err {
+				return
+			}
+		}
+		select {
+		case <-time.After(interval):
+		case <-search.done:
 			return
 		}
 	}
 	return
 }
 
-func (this *ssdpDefaultManager) ssdpDiscoverImpl(ifiname, port string, subscribe bool) {
-	ifi, err := net.InterfaceByName(ifiname)
+func (this *ssdpDefaultManager) ssdpDiscoverImpl(ifiname, port string, subscribe bool, options *DiscoveryOptions) (err error) {
+	this.ssdpStartUpdateLoop()
+	ifis, err := Interfaces(ifiname)
 	if nil != err {
-		panic(err)
-	} else if err = this.ssdpUnicastDiscoverImpl(ifi, port); nil != err {
-		panic(err)
-	} else if err = this.ssdpMulticastDiscoverImpl(ifi, subscribe); nil != err {
-		panic(err)
-	} else if err = this.ssdpQueryLoop(); nil != err {
-		panic(err)
+		return
+	}
+	for _, ifi := range ifis {
+		for _, family := range options.Families {
+			sock := &ssdpSocket{ifi: ifi, family: family}
+			if _, err := InterfaceAddrFamily(&ifi, family); nil != err {
+				log.Printf("Skipping discovery: %v", err)
+				continue
+			} else if err = this.ssdpUnicastDiscoverImpl(sock, port); nil != err {
+				return err
+			}
+			this.sockets = append(this.sockets, sock)
+			if err = this.ssdpMulticastDiscoverImpl(sock, subscribe); nil != err {
+				return err
+			}
+		}
+	}
+	if 0 == len(this.sockets) {
+		return errors.New("No interface has an address in the requested families")
 	}
+	return this.ssdpQueryLoop(options)
 }
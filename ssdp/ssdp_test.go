@@ -0,0 +1,410 @@
+//
+// go-sonos
+// ========
+//
+// Copyright (c) 2012, Ian T. Richards <ianr@panix.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//   * Redistributions of source code must retain the above copyright notice,
+//     this list of conditions and the following disclaimer.
+//   * Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+// TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package ssdp
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+//
+// The fixtures in testdata are capture files (see SaveCapture()) holding
+// synthetic search responses and notifications, written by hand after
+// the formats a Sonos player, a Reciva radio, a MiniUPnPd router and a
+// Chromecast use.  They are not captures of real traffic, so they only
+// check the parser against what their author expected: the corpus of
+// real-world packets is not done yet.  To add it, record each kind of
+// device with Sniff() and SaveCapture() on a network where it is
+// present, put the capture here as a .jsonl file, and run with -update.
+//
+// Each fixture is replayed into a fresh manager and the resulting device
+// list compared with the matching .golden file; run with -update to
+// rewrite the golden files.
+//
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// Parse @msg, returning the value of any panic instead of propagating it
+func testParse(msg []byte) (raw *ssdpRawMessage, failure interface{}) {
+	defer func() {
+		failure = recover()
+	}()
+	raw = ssdpParseInput(msg)
+	return
+}
+
+func TestParseInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		msgtype ssdpMessageType
+		header  map[string]string
+		fails   bool
+	}{
+		{"search", "M-SEARCH * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\nMAN: \"ssdp:discover\"\r\nMX: 3\r\nST: ssdp:all\r\n\r\n",
+			ssdpSearch, map[string]string{"Host": "239.255.255.250:1900", "Man": "\"ssdp:discover\"", "Mx": "3", "St": "ssdp:all"}, false},
+		{"notify", "NOTIFY * HTTP/1.1\r\nNT: upnp:rootdevice\r\nNTS: ssdp:alive\r\n\r\n",
+			ssdpNotify, map[string]string{"Nt": "upnp:rootdevice", "Nts": "ssdp:alive"}, false},
+		{"response", "HTTP/1.1 200 OK\r\nST: upnp:rootdevice\r\nEXT:\r\n\r\n",
+			ssdpResponse, map[string]string{"St": "upnp:rootdevice", "Ext": ""}, false},
+		{"bare newlines", "HTTP/1.1 200 OK\nST: upnp:rootdevice\n\n",
+			ssdpResponse, map[string]string{"St": "upnp:rootdevice"}, false},
+		{"header whitespace", "HTTP/1.1 200 OK\r\n  cache-control :  max-age = 1800 \r\n\r\n",
+			ssdpResponse, map[string]string{"Cache-Control": "max-age = 1800"}, false},
+		{"trailing body", "HTTP/1.1 200 OK\r\nST: upnp:rootdevice\r\n\r\nbody",
+			ssdpResponse, map[string]string{"St": "upnp:rootdevice"}, false},
+		{"empty", "", ssdpInvalid, nil, true},
+		{"unterminated", "HTTP/1.1 200 OK\r\nST: upnp:rootdevice\r\n", ssdpInvalid, nil, true},
+		{"short start line", "HTTP/1.1 200\r\n\r\n", ssdpInvalid, nil, true},
+		{"unknown method", "GET / HTTP/1.1\r\n\r\n", ssdpInvalid, nil, true},
+		{"header without colon", "HTTP/1.1 200 OK\r\nEXT\r\n\r\n", ssdpInvalid, nil, true},
+		{"repeated header", "HTTP/1.1 200 OK\r\nST: a\r\nst: b\r\n\r\n", ssdpInvalid, nil, true},
+	}
+	for _, test := range tests {
+		raw, failure := testParse([]byte(test.input))
+		if test.fails {
+			if nil == failure {
+				t.Errorf("%s: parsed invalid input", test.name)
+			}
+			continue
+		} else if nil != failure {
+			t.Errorf("%s: %v", test.name, failure)
+			continue
+		}
+		if test.msgtype != raw.msgtype {
+			t.Errorf("%s: message type %d, expected %d", test.name, raw.msgtype, test.msgtype)
+		}
+		if len(test.header) != len(raw.header) {
+			t.Errorf("%s: headers %v, expected %v", test.name, raw.header, test.header)
+		}
+		for key, value := range test.header {
+			if value != raw.header[key] {
+				t.Errorf("%s: %s is `%s', expected `%s'", test.name, key, raw.header[key], value)
+			}
+		}
+	}
+}
+
+func TestDiscoveryOptionsNormalize(t *testing.T) {
+	defaults := DefaultDiscoveryOptions()
+	opts := (&DiscoveryOptions{MinDevices: 3}).normalize()
+	if defaults.Duration != opts.Duration {
+		t.Errorf("zero duration normalized to %v, expected %v", opts.Duration, defaults.Duration)
+	} else if 3 != opts.MinDevices || 1 != opts.MX || 1 != opts.Retransmits {
+		t.Errorf("normalized to %+v", opts)
+	}
+	if opts = (&DiscoveryOptions{Duration: -time.Second}).normalize(); defaults.Duration != opts.Duration {
+		t.Errorf("negative duration normalized to %v", opts.Duration)
+	}
+	var none *DiscoveryOptions
+	if opts = none.normalize(); defaults.Duration != opts.Duration || defaults.MX != opts.MX {
+		t.Errorf("nil options normalized to %+v", opts)
+	}
+}
+
+func TestOnLink(t *testing.T) {
+	_, v4, _ := net.ParseCIDR("192.168.1.10/24")
+	_, v6, _ := net.ParseCIDR("2001:db8::1/64")
+	addrs := []net.Addr{v4, v6}
+	for _, test := range []struct {
+		addr   *net.UDPAddr
+		onLink bool
+	}{
+		{&net.UDPAddr{IP: net.ParseIP("192.168.1.77")}, true},
+		{&net.UDPAddr{IP: net.ParseIP("192.168.2.77")}, false},
+		{&net.UDPAddr{IP: net.ParseIP("2001:db8::77")}, true},
+		{&net.UDPAddr{IP: net.ParseIP("2001:db9::77")}, false},
+		{&net.UDPAddr{IP: net.ParseIP("fe80::1"), Zone: "eth0"}, true},
+		{&net.UDPAddr{IP: net.ParseIP("fe80::1"), Zone: "wlan0"}, false},
+		{nil, false},
+	} {
+		if onLink := ssdpOnLink("eth0", addrs, test.addr); test.onLink != onLink {
+			t.Errorf("ssdpOnLink(%v) = %v, expected %v", test.addr, onLink, test.onLink)
+		}
+	}
+}
+
+func TestAdvertiseRestart(t *testing.T) {
+	adv := MakeAdvertiser(&Advertisement{
+		EmbeddedDevice: EmbeddedDevice{UUID: "test-advertiser", DeviceType: "urn:schemas-upnp-org:device:MediaServer:1"},
+		Location:       "http://:8200/description.xml",
+	})
+	if err := adv.Advertise("lo"); nil != err {
+		t.Skipf("Cannot advertise on the loopback interface: %v", err)
+	}
+	if err := adv.Advertise("lo"); nil == err {
+		t.Error("Advertised twice without closing")
+	}
+	if err := adv.Close(); nil != err {
+		t.Fatal(err)
+	}
+	if err := adv.Advertise("lo"); nil != err {
+		t.Fatalf("Advertising again after Close(): %v", err)
+	}
+	sockets := adv.(*ssdpDefaultAdvertiser).sockets
+	if 0 == len(sockets) {
+		t.Error("No sockets after advertising again")
+	}
+	if err := adv.Close(); nil != err {
+		t.Fatal(err)
+	}
+	if err := adv.Close(); nil != err {
+		t.Fatal(err)
+	}
+}
+
+func TestProbeStartsUpdateLoop(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<root xmlns="urn:schemas-upnp-org:device-1-0"><device>`+
+			`<deviceType>urn:schemas-upnp-org:device:ZonePlayer:1</deviceType>`+
+			`<UDN>uuid:RINCON_000E58741A8401400</UDN></device></root>`)
+	}))
+	defer server.Close()
+	mgr := MakeManager().(*ssdpDefaultManager)
+	if err := mgr.Probe([]string{server.Listener.Addr().String()}, &ProbeOptions{Path: "/"}); nil != err {
+		t.Fatal(err)
+	}
+	mgr.lock.Lock()
+	running := mgr.running
+	mgr.lock.Unlock()
+	if !running {
+		t.Error("Probe() did not start the update loop")
+	}
+	if devices := mgr.Devices(); 1 != len(devices) {
+		t.Errorf("Probe() found %d devices", len(devices))
+	}
+	mgr.Close()
+}
+
+func TestHandleMessages(t *testing.T) {
+	mgr := MakeManager().(*ssdpDefaultManager)
+	raw := ssdpParseInput([]byte("HTTP/1.1 200 OK\r\n" +
+		"CACHE-CONTROL: max-age = 1800\r\n" +
+		"LOCATION: http://192.168.1.44:1400/xml/device_description.xml\r\n" +
+		"SERVER: Linux UPnP/1.0 Sonos/28.1-83040 (ZPS5)\r\n" +
+		"ST: urn:schemas-upnp-org:service:MusicServices:1\r\n" +
+		"USN: uuid:RINCON_000E58741A8401400::urn:schemas-upnp-org:service:MusicServices:1\r\n" +
+		"X-RINCON-HOUSEHOLD: Sonos_hf8V3vH7xMaBTtPnANPkXo5fQY\r\n\r\n"))
+	resp := mgr.ssdpHandleResponse(raw)
+	if "urn:schemas-upnp-org:service:MusicServices:1" != resp.st {
+		t.Errorf("st is `%s'", resp.st)
+	} else if "http://192.168.1.44:1400/xml/device_description.xml" != resp.location {
+		t.Errorf("location is `%s'", resp.location)
+	} else if "Sonos_hf8V3vH7xMaBTtPnANPkXo5fQY" != resp.x_rincon_household {
+		t.Errorf("household is `%s'", resp.x_rincon_household)
+	} else if "Linux" != resp.os || "Sonos" != resp.product || "28.1-83040 (ZPS5)" != resp.productVersion {
+		t.Errorf("server description is %+v", resp.ssdpServerDescription)
+	} else if 1800 != int(ssdpParseMaxAge(resp.cache_control).Seconds()) {
+		t.Errorf("max-age of `%s' is %v", resp.cache_control, ssdpParseMaxAge(resp.cache_control))
+	}
+	raw = ssdpParseInput([]byte("NOTIFY * HTTP/1.1\r\n" +
+		"HOST: 239.255.255.250:1900\r\n" +
+		"NT: upnp:rootdevice\r\n" +
+		"NTS: ssdp:byebye\r\n" +
+		"USN: uuid:RINCON_000E58741A8401400::upnp:rootdevice\r\n\r\n"))
+	notify := mgr.ssdpHandleNotify(raw)
+	if "upnp:rootdevice" != notify.nt || "ssdp:byebye" != notify.nts {
+		t.Errorf("notification is %+v", notify)
+	} else if "239.255.255.250:1900" != notify.host {
+		t.Errorf("host is `%s'", notify.host)
+	}
+}
+
+func TestIncludeResponse(t *testing.T) {
+	tests := []struct {
+		st      string
+		usn     string
+		uuid    UUID
+		name    string
+		service ServiceKey
+		version int64
+	}{
+		{"upnp:rootdevice", "uuid:RINCON_1::upnp:rootdevice", "RINCON_1", "", "", 0},
+		{"urn:schemas-upnp-org:device:ZonePlayer:1", "uuid:RINCON_1::urn:schemas-upnp-org:device:ZonePlayer:1", "RINCON_1", "ZonePlayer", "", 0},
+		{"urn:schemas-upnp-org:service:AVTransport:1", "uuid:RINCON_1_MR::urn:schemas-upnp-org:service:AVTransport:1", "RINCON_1_MR", "", "schemas-upnp-org-AVTransport", 1},
+		{"urn:reciva-com:service:RecivaRadio:0.0", "uuid:a0c2::urn:reciva-com:service:RecivaRadio:0.0", "a0c2", "", "reciva-com-RecivaRadio", 0},
+		{"urn:dial-multiscreen-org:device:dial:1", "uuid:3e1c::urn:dial-multiscreen-org:device:dial:1", "3e1c", "dial", "", 0},
+		{"urn:dial-multiscreen-org:service:dial:1", "uuid:3e1c::urn:dial-multiscreen-org:service:dial:1", "3e1c", "", "dial-multiscreen-org-dial", 1},
+		{"hnap:*", "uuid:824f", "", "", "", 0},
+		{"uuid:RINCON_2", "uuid:RINCON_2", "", "", "", 0},
+		{"upnp:rootdevice", "not-a-usn", "", "", "", 0},
+		{"x-unknown:target", "uuid:RINCON_3", "", "", "", 0},
+	}
+	for _, test := range tests {
+		mgr := MakeManager().(*ssdpDefaultManager)
+		mgr.ssdpIncludeResponse(&ssdpResponseMessage{st: test.st, usn: test.usn, location: "http://host/desc.xml"})
+		devices := mgr.Devices()
+		if "" == test.uuid {
+			if 0 != len(devices) {
+				t.Errorf("%s: unexpected devices %v", test.st, devices)
+			}
+			continue
+		}
+		de, has := devices[test.uuid]
+		if !has {
+			t.Errorf("%s: no device %s in %v", test.st, test.uuid, devices)
+			continue
+		} else if test.name != de.Name() {
+			t.Errorf("%s: device name `%s', expected `%s'", test.st, de.Name(), test.name)
+		}
+		if "" != test.service {
+			if svc, has := de.Service(test.service); !has {
+				t.Errorf("%s: no service %s in %v", test.st, test.service, de.Services())
+			} else if test.version != svc.Version() {
+				t.Errorf("%s: version %d, expected %d", test.st, svc.Version(), test.version)
+			}
+		}
+	}
+}
+
+// Describe the device list of @mgr in a stable, line-oriented form
+func testRenderDevices(mgr Manager) []byte {
+	buf := new(bytes.Buffer)
+	devices := mgr.Devices()
+	var uuids []string
+	for uuid, _ := range devices {
+		uuids = append(uuids, string(uuid))
+	}
+	sort.Strings(uuids)
+	for _, uuid := range uuids {
+		de := devices[UUID(uuid)]
+		fmt.Fprintf(buf, "device %s\n", uuid)
+		fmt.Fprintf(buf, "\tname %s\n", de.Name())
+		fmt.Fprintf(buf, "\tproduct %s %s\n", de.Product(), de.ProductVersion())
+		fmt.Fprintf(buf, "\tlocation %s\n", de.Location())
+		var keys []string
+		for _, key := range de.Services() {
+			keys = append(keys, string(key))
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			svc, _ := de.Service(ServiceKey(key))
+			fmt.Fprintf(buf, "\tservice %s %d\n", key, svc.Version())
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestCaptureGolden(t *testing.T) {
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "*.jsonl"))
+	if nil != err || 0 == len(fixtures) {
+		t.Fatalf("No fixtures found (%v)", err)
+	}
+	for _, fixture := range fixtures {
+		mgr := MakeManager()
+		if err := mgr.ReplayCapture(fixture); nil != err {
+			t.Errorf("%s: %v", fixture, err)
+			continue
+		}
+		actual := testRenderDevices(mgr)
+		golden := strings.TrimSuffix(fixture, ".jsonl") + ".golden"
+		if *updateGolden {
+			if err := os.WriteFile(golden, actual, 0644); nil != err {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if expected, err := os.ReadFile(golden); nil != err {
+			t.Errorf("%s: %v", golden, err)
+		} else if !bytes.Equal(expected, actual) {
+			t.Errorf("%s: device list differs from %s:\n%s", fixture, golden, actual)
+		}
+	}
+}
+
+// Add the raw message of every fixture to the seed corpus of @f
+func testSeedCorpus(f *testing.F) {
+	fixtures, _ := filepath.Glob(filepath.Join("testdata", "*.jsonl"))
+	for _, fixture := range fixtures {
+		if entries, err := ReadCapture(fixture); nil == err {
+			for _, entry := range entries {
+				f.Add([]byte(entry.Raw))
+			}
+		}
+	}
+}
+
+// The parser reports bad input by panicking with a message; any runtime
+// error is a bug.
+func testCheckFailure(t *testing.T, failure interface{}) {
+	if err, ok := failure.(runtime.Error); ok {
+		t.Fatalf("runtime error: %v", err)
+	}
+}
+
+func FuzzParseInput(f *testing.F) {
+	testSeedCorpus(f)
+	f.Fuzz(func(t *testing.T, msg []byte) {
+		raw, failure := testParse(msg)
+		testCheckFailure(t, failure)
+		if nil == failure && nil == raw {
+			t.Fatal("no message and no failure")
+		}
+	})
+}
+
+// Only the parser panics on bad input, so once a message parses it is
+// handled and included with no recover in between.
+func FuzzIncludeMessage(f *testing.F) {
+	testSeedCorpus(f)
+	output := log.Writer()
+	log.SetOutput(io.Discard)
+	f.Cleanup(func() {
+		log.SetOutput(output)
+	})
+	f.Fuzz(func(t *testing.T, msg []byte) {
+		raw, failure := testParse(msg)
+		if testCheckFailure(t, failure); nil != failure {
+			return
+		}
+		mgr := MakeManager().(*ssdpDefaultManager)
+		switch raw.msgtype {
+		case ssdpResponse:
+			mgr.ssdpIncludeResponse(mgr.ssdpHandleResponse(raw))
+		case ssdpNotify:
+			mgr.ssdpIncludeNotification(mgr.ssdpHandleNotify(raw))
+		}
+		testRenderDevices(mgr)
+	})
+}
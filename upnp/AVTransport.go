@@ -34,6 +34,7 @@ import (
 	"encoding/xml"
 	_ "log"
 	"strings"
+	"time"
 )
 
 var (
@@ -45,8 +46,12 @@ type avTransport_Value_XML struct {
 	Val     string `xml:"val,attr"`
 }
 
+// Declares the fields of avTransport_Value_XML itself rather than
+// embedding it: encoding/xml cannot unmarshal into an embedded unexported
+// struct on current Go releases.
 type avTransport_InstanceID_XML struct {
-	avTransport_Value_XML
+	XMLName xml.Name
+	Val     string `xml:"val,attr"`
 	TransportState,
 	CurrentPlayMode,
 	CurrentCrossfadeMode,
@@ -489,6 +494,7 @@ const (
 	State_PLAYING         = "PLAYING"
 	State_PAUSED_PLAYBACK = "PAUSED_PLAYBACK"
 	State_STOPPED         = "STOPPED"
+	State_TRANSITIONING   = "TRANSITIONING"
 )
 
 //
@@ -726,7 +732,7 @@ const (
 //
 // For TRACK_NR the integer track number relative to the start of the queue
 // is supplied to @target.  For REL_TIME a duration in the format HH:MM:SS
-// is given as @target.  SECTION is not tested.
+// is given as @target (see FormatTime() and SeekTime()).  SECTION is not tested.
 //
 func (this *AVTransport) Seek(instanceId uint32, unit, target string) error {
 	type Response struct {
@@ -744,6 +750,14 @@ func (this *AVTransport) Seek(instanceId uint32, unit, target string) error {
 	return doc.Error()
 }
 
+//
+// Seek to @offset within the current track, a convenience for
+// Seek(@instanceId, SeekMode_REL_TIME, FormatTime(@offset)).
+//
+func (this *AVTransport) SeekTime(instanceId uint32, offset time.Duration) error {
+	return this.Seek(instanceId, SeekMode_REL_TIME, FormatTime(offset))
+}
+
 //
 // Skip ahead to the next track in the queue (Q:).  For Sonos @instanceId
 // should always be 0.  This method returns an error 711 if the current
@@ -1097,6 +1111,32 @@ func (this *AVTransport) GetRemainingSleepTimerDuration(instanceId uint32) (rema
 	return
 }
 
+//
+// Start a sleep timer that stops playback after @d, replacing any timer
+// already running.  A @d of zero or less cancels the sleep timer.
+//
+func (this *AVTransport) SetSleepTimer(instanceId uint32, d time.Duration) error {
+	if 0 >= d {
+		return this.ConfigureSleepTimer(instanceId, "")
+	}
+	return this.ConfigureSleepTimer(instanceId, FormatTime(d))
+}
+
+//
+// Returns the time left on the sleep timer, or zero if no sleep timer
+// is running, along with the timer generation.
+//
+func (this *AVTransport) SleepTimerRemaining(instanceId uint32) (remaining time.Duration,
+	generation uint32, err error) {
+	var s string
+	if s, generation, err = this.GetRemainingSleepTimerDuration(instanceId); nil != err {
+		return
+	} else if "" != s {
+		remaining, err = ParseTime(s)
+	}
+	return
+}
+
 type RunAlarmRequest struct {
 	AlarmID            uint32
 	LoggedStartTime    string
@@ -1108,6 +1148,11 @@ type RunAlarmRequest struct {
 	IncludeLinkedZones bool
 }
 
+// Sets the Duration of the alarm to @d
+func (this *RunAlarmRequest) SetDuration(d time.Duration) {
+	this.Duration = FormatTime(d)
+}
+
 func (this *AVTransport) RunAlarm(instanceId uint32, req *RunAlarmRequest) (err error) {
 	type Response struct {
 		XMLName xml.Name
@@ -1196,6 +1241,11 @@ func (this *AVTransport) SnoozeAlarm(instanceId uint32, duration string) (err er
 	return
 }
 
+// Snooze the running alarm for @d, see SnoozeAlarm()
+func (this *AVTransport) SnoozeAlarmFor(instanceId uint32, d time.Duration) error {
+	return this.SnoozeAlarm(instanceId, FormatTime(d))
+}
+
 func (this *AVTransport) DelegateGroupCoordinationTo(instanceId uint32, newCoordinator string, rejoinGroup bool) error {
 	type Response struct {
 		XMLName xml.Name
@@ -33,6 +33,7 @@ package upnp
 import (
 	"encoding/xml"
 	_ "log"
+	"time"
 )
 
 var (
@@ -301,6 +302,16 @@ type CreateAlarmRequest struct {
 	IncludeLinkedZones bool
 }
 
+// Sets the StartLocalTime of the alarm to @d past local midnight
+func (this *CreateAlarmRequest) SetStartLocalTime(d time.Duration) {
+	this.StartLocalTime = FormatTime(d % (24 * time.Hour))
+}
+
+// Sets how long the alarm plays for to @d
+func (this *CreateAlarmRequest) SetDuration(d time.Duration) {
+	this.Duration = FormatTime(d)
+}
+
 func (this *AlarmClock) CreateAlarm(req *CreateAlarmRequest) (assignedId uint32, err error) {
 	type Response struct {
 		XMLName    xml.Name
@@ -32,8 +32,12 @@ package upnp
 
 import (
 	"encoding/xml"
+	"errors"
+	"fmt"
 	"github.com/ianr0bkny/go-sonos/didl"
 	_ "log"
+	"strconv"
+	"strings"
 )
 
 var (
@@ -229,6 +233,10 @@ func (this *ContentDirectory) Browse(req *BrowseRequest) (browseResult *BrowseRe
 	return
 }
 
+//
+// Returns the index within @objectId of the first child whose title
+// sorts at or after @prefix, e.g. the first artist beginning "M".
+//
 func (this *ContentDirectory) FindPrefix(objectId, prefix string) (startingIndex, updateId uint32, err error) {
 	type Response struct {
 		XMLName       xml.Name
@@ -238,8 +246,7 @@ func (this *ContentDirectory) FindPrefix(objectId, prefix string) (startingIndex
 	}
 	args := []Arg{
 		{"ObjectID", objectId},
-		{"StartingIndex", startingIndex},
-		{"UpdateID", updateId},
+		{"Prefix", prefix},
 	}
 	response := this.Svc.Call("FindPrefix", args)
 	doc := Response{}
@@ -273,6 +280,108 @@ func (this *ContentDirectory) GetAllPrefixLocations(objectId string) (prefixLoca
 	return
 }
 
+// The children of a container beginning with one prefix
+type PrefixEntry struct {
+	// The prefix, usually a single letter (e.g. "M")
+	Prefix string
+	// The index of the first child with the prefix, as for StartingIndex
+	StartingIndex uint32
+	Count         uint32
+}
+
+//
+// An alphabetical index of a sorted container, such as A:ARTIST, built
+// from GetAllPrefixLocations().  Browsing from the StartingIndex of an
+// entry jumps straight to the children beginning with its prefix.
+//
+type PrefixIndex struct {
+	ObjectID string
+	// The UpdateID of the container the index was built from
+	UpdateID uint32
+	// The number of children of the container
+	TotalMatches uint32
+	// In the order of the container
+	Entries []PrefixEntry
+}
+
+//
+// Parses the PrefixAndIndexCSV of GetAllPrefixLocations(), pairs of a
+// prefix and the index at which it starts (e.g. "A,0,B,23,C,57"), into
+// entries.  Each Count runs to the start of the next entry, and that of
+// the last entry to @total.
+//
+func ParsePrefixLocations(csv string, total uint32) (entries []PrefixEntry, err error) {
+	if "" == csv {
+		return
+	}
+	fields := strings.Split(csv, ",")
+	if 0 != len(fields)%2 {
+		return nil, errors.New(fmt.Sprintf("Malformed prefix locations `%s'", csv))
+	}
+	for i := 0; i < len(fields); i += 2 {
+		var index uint64
+		if index, err = strconv.ParseUint(fields[i+1], 10, 32); nil != err {
+			return nil, errors.New(fmt.Sprintf("Malformed prefix locations `%s'", csv))
+		}
+		entries = append(entries, PrefixEntry{Prefix: fields[i], StartingIndex: uint32(index)})
+	}
+	for i := range entries {
+		end := total
+		if i+1 < len(entries) {
+			end = entries[i+1].StartingIndex
+		}
+		if end > entries[i].StartingIndex {
+			entries[i].Count = end - entries[i].StartingIndex
+		}
+	}
+	return
+}
+
+// Builds the prefix index of @objectId; see PrefixIndex
+func (this *ContentDirectory) GetPrefixIndex(objectId string) (index *PrefixIndex, err error) {
+	var locations *PrefixLocations
+	if locations, err = this.GetAllPrefixLocations(objectId); nil != err {
+		return
+	}
+	// Only TotalMatches is wanted, to count the children of the last prefix
+	var result *BrowseResult
+	req := &BrowseRequest{
+		ObjectID:      objectId,
+		BrowseFlag:    BrowseFlag_BrowseDirectChildren,
+		Filter:        BrowseFilter_All,
+		StartingIndex: 0,
+		RequestCount:  1,
+		SortCriteria:  BrowseSortCriteria_None,
+	}
+	if result, err = this.Browse(req); nil != err {
+		return
+	}
+	index = &PrefixIndex{
+		ObjectID:     objectId,
+		UpdateID:     locations.UpdateID,
+		TotalMatches: uint32(result.TotalMatches),
+	}
+	index.Entries, err = ParsePrefixLocations(locations.PrefixAndIndexCSV, index.TotalMatches)
+	return
+}
+
+//
+// Returns the entry for @prefix, compared ignoring case.  When no entry
+// has that prefix, the entry of the longest prefix of @prefix is tried
+// (e.g. "M" for "Mo").
+//
+func (this *PrefixIndex) Lookup(prefix string) (entry PrefixEntry, has bool) {
+	runes := []rune(prefix)
+	for n := len(runes); 0 < n; n-- {
+		for _, entry = range this.Entries {
+			if strings.EqualFold(entry.Prefix, string(runes[:n])) {
+				return entry, true
+			}
+		}
+	}
+	return PrefixEntry{}, false
+}
+
 func (this *ContentDirectory) CreateObject(container, elements string) (objectId, result string, err error) {
 	type Response struct {
 		XMLName  xml.Name
@@ -0,0 +1,96 @@
+//
+// go-sonos
+// ========
+//
+// Copyright (c) 2012, Ian T. Richards <ianr@panix.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//   * Redistributions of source code must retain the above copyright notice,
+//     this list of conditions and the following disclaimer.
+//   * Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+// TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package upnp
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParsePrefixLocations(t *testing.T) {
+	tests := []struct {
+		csv     string
+		total   uint32
+		entries string
+		ok      bool
+	}{
+		{"", 10, "[]", true},
+		{"A,0,B,23,C,57", 80, "[{A 0 23} {B 23 34} {C 57 23}]", true},
+		{"A,0", 0, "[{A 0 0}]", true},
+		// The last entry runs to the total, which may be short of it
+		{"A,0,B,23", 23, "[{A 0 23} {B 23 0}]", true},
+		{"A,0,B,23", 10, "[{A 0 23} {B 23 0}]", true},
+		{"A,10,B,5", 20, "[{A 10 0} {B 5 15}]", true},
+		{"A", 10, "", false},
+		{"A,0,B", 10, "", false},
+		{"A,0,", 10, "", false},
+		{"A,x", 10, "", false},
+		{"A,-1", 10, "", false},
+		{"A,4294967296", 10, "", false},
+		{"A, 0", 10, "", false},
+	}
+	for _, test := range tests {
+		entries, err := ParsePrefixLocations(test.csv, test.total)
+		if test.ok != (nil == err) {
+			t.Errorf("ParsePrefixLocations(%q): error %v", test.csv, err)
+		} else if test.ok && test.entries != fmt.Sprint(entries) {
+			t.Errorf("ParsePrefixLocations(%q, %d) = %v, expected %s", test.csv, test.total, entries, test.entries)
+		}
+	}
+}
+
+func TestPrefixIndexLookup(t *testing.T) {
+	index := &PrefixIndex{Entries: []PrefixEntry{
+		{"A", 0, 10}, {"M", 10, 5}, {"MO", 15, 3}, {"Ä", 18, 2}, {"Z", 20, 1},
+	}}
+	tests := []struct {
+		prefix string
+		entry  string
+		has    bool
+	}{
+		{"A", "A", true},
+		{"a", "A", true},
+		{"Abba", "A", true},
+		{"m", "M", true},
+		{"Mo", "MO", true},
+		{"mozart", "MO", true},
+		{"Madonna", "M", true},
+		{"ärzte", "Ä", true},
+		{"Ärzte", "Ä", true},
+		{"B", "", false},
+		{"", "", false},
+	}
+	for _, test := range tests {
+		entry, has := index.Lookup(test.prefix)
+		if test.has != has || test.entry != entry.Prefix {
+			t.Errorf("Lookup(%q) = %v, %v", test.prefix, entry, has)
+		}
+	}
+}
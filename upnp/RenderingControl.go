@@ -33,6 +33,7 @@ package upnp
 import (
 	"encoding/xml"
 	_ "log"
+	"time"
 )
 
 var (
@@ -45,8 +46,12 @@ type renderingControl_Value_XML struct {
 	Val     string `xml:"val,attr"`
 }
 
+// The fields of renderingControl_Value_XML are declared rather than
+// embedded, as for avTransport_InstanceID_XML.
 type renderingControl_InstanceID_XML struct {
-	renderingControl_Value_XML
+	XMLName xml.Name
+	Channel string `xml:"channel,attr"`
+	Val     string `xml:"val,attr"`
 	Volume,
 	Mute,
 	Bass,
@@ -531,7 +536,11 @@ type RampRequest struct {
 	ProgramURI       string
 }
 
-func (this *RenderingControl) RampToVolume(instanceId uint32, channel, req RampRequest) (rampTime uint32, err error) {
+//
+// Ramp the volume of @channel to @req.DesiredVolume, returning how long
+// the player will take to get there.
+//
+func (this *RenderingControl) RampToVolume(instanceId uint32, channel string, req RampRequest) (rampTime time.Duration, err error) {
 	type Response struct {
 		XMLName  xml.Name
 		RampTime uint32
@@ -548,7 +557,7 @@ func (this *RenderingControl) RampToVolume(instanceId uint32, channel, req RampR
 	response := this.Svc.Call("RampToVolume", args)
 	doc := Response{}
 	xml.Unmarshal([]byte(response), &doc)
-	rampTime = doc.RampTime
+	rampTime = time.Duration(doc.RampTime) * time.Second
 	err = doc.Error()
 	return
 }
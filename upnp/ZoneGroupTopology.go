@@ -246,6 +246,12 @@ type ZoneGroupMember struct {
 	SoftwareVersion      string `xml:"SoftwareVersion,attr"`
 	MinCompatibleVersion string `xml:"MinCompatibleVersion,attr"`
 	BootSeq              string `xml:"BootSeq,attr"`
+	// Bonded players as "UUID:channels;..." (e.g. RINCON_A:LF,LF;RINCON_B:RF,RF)
+	ChannelMapSet string `xml:"ChannelMapSet,attr"`
+	// The same, for a home theater and its satellites (e.g. RINCON_C:SW)
+	HTSatChanMapSet string `xml:"HTSatChanMapSet,attr"`
+	// The sub and surrounds bonded to a home theater player
+	Satellite []ZoneGroupMember
 }
 
 type ZoneGroup struct {
@@ -269,7 +275,29 @@ func (this *ZoneGroupTopology) GetZoneGroupState() (*ZoneGroups, error) {
 	response := this.Svc.CallVa("GetZoneGroupState")
 	doc := Response{}
 	xml.Unmarshal([]byte(response), &doc)
+	state, _ := ParseZoneGroupState(doc.ZoneGroupState)
+	return state, doc.Error()
+}
+
+//
+// Parses the ZoneGroupState document returned by GetZoneGroupState and
+// carried by ZoneGroupTopology events.  Older firmware sends a bare
+// <ZoneGroups> element; newer firmware wraps it in <ZoneGroupState>.
+//
+func ParseZoneGroupState(value string) (*ZoneGroups, error) {
 	state := ZoneGroups{}
-	xml.Unmarshal([]byte(doc.ZoneGroupState), &state)
-	return &state, doc.Error()
+	if err := xml.Unmarshal([]byte(value), &state); nil != err {
+		return &state, err
+	}
+	if "ZoneGroupState" == state.XMLName.Local {
+		doc := struct {
+			XMLName    xml.Name
+			ZoneGroups ZoneGroups
+		}{}
+		if err := xml.Unmarshal([]byte(value), &doc); nil != err {
+			return &state, err
+		}
+		state = doc.ZoneGroups
+	}
+	return &state, nil
 }
@@ -0,0 +1,199 @@
+//
+// go-sonos
+// ========
+//
+// Copyright (c) 2012, Ian T. Richards <ianr@panix.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//   * Redistributions of source code must retain the above copyright notice,
+//     this list of conditions and the following disclaimer.
+//   * Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+// TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package upnp
+
+import (
+	"context"
+	"fmt"
+	"github.com/ianr0bkny/go-sonos/didl"
+)
+
+//
+// The number of objects asked for in each Browse call when a request
+// gives a RequestCount of zero.  Sonos returns at most 100 objects per
+// call whatever is asked for, so larger pages only waste requests.
+//
+const BrowsePageSize_Default = 100
+
+//
+// Returned when the UpdateID of the container being browsed changes
+// between pages, meaning that objects may have been added, removed or
+// moved and the pages already read may be inconsistent with those to
+// come.  Restarting the browse gives a consistent result.
+//
+type BrowseChangedError struct {
+	ObjectID string
+	// The UpdateID of the first page, and that of the page that differed
+	From, To int32
+}
+
+func (this *BrowseChangedError) Error() string {
+	return fmt.Sprintf("`%s' changed during browse (UpdateID %d -> %d)", this.ObjectID, this.From, this.To)
+}
+
+//
+// Pages through the result of a Browse request; see BrowseIter().
+//
+// A typical loop is:
+//
+//	iter := cd.BrowseIter(ctx, req)
+//	for iter.Next() {
+//		for _, item := range iter.Page().Doc.Item {
+//			...
+//		}
+//	}
+//	if err := iter.Err(); nil != err {
+//		...
+//	}
+//
+type BrowseIter struct {
+	cd   *ContentDirectory
+	ctx  context.Context
+	req  BrowseRequest
+	page *BrowseResult
+	// The index of the first object of the next page
+	next uint32
+	// TotalMatches, once the first page has been read
+	total    uint32
+	started  bool
+	updateId int32
+	err      error
+}
+
+//
+// Starts paging through the objects given by @req, beginning at
+// @req.StartingIndex.  @req.RequestCount sets the page size, with zero
+// meaning BrowsePageSize_Default, and the filter and sort criteria of
+// @req are sent with every page.  Cancelling @ctx ends the iteration
+// before the next page is requested; @ctx may be nil.
+//
+// No request is made until Next() is first called.
+//
+func (this *ContentDirectory) BrowseIter(ctx context.Context, req *BrowseRequest) *BrowseIter {
+	if nil == ctx {
+		ctx = context.Background()
+	}
+	iter := &BrowseIter{
+		cd:   this,
+		ctx:  ctx,
+		req:  *req,
+		next: req.StartingIndex,
+	}
+	if 0 == iter.req.RequestCount {
+		iter.req.RequestCount = BrowsePageSize_Default
+	}
+	return iter
+}
+
+//
+// Reads the next page, returning false when there are no more objects,
+// when the browse fails, when the context is cancelled, or when the
+// UpdateID changes (see BrowseChangedError); Err() then tells which.
+//
+func (this *BrowseIter) Next() bool {
+	if nil != this.err || (this.started && this.next >= this.total) {
+		this.page = nil
+		return false
+	}
+	if err := this.ctx.Err(); nil != err {
+		this.page, this.err = nil, err
+		return false
+	}
+	req := this.req
+	req.StartingIndex = this.next
+	result, err := this.cd.Browse(&req)
+	if nil != err {
+		this.page, this.err = nil, err
+		return false
+	}
+	if !this.started {
+		this.started = true
+		this.updateId = result.UpdateID
+	} else if result.UpdateID != this.updateId {
+		this.page = nil
+		this.err = &BrowseChangedError{ObjectID: req.ObjectID, From: this.updateId, To: result.UpdateID}
+		return false
+	}
+	if 0 < result.TotalMatches {
+		this.total = uint32(result.TotalMatches)
+	}
+	if 0 >= result.NumberReturned {
+		// Guards against looping on a server that reports more
+		// matches than it will return
+		this.page, this.total = nil, this.next
+		return false
+	}
+	this.next += uint32(result.NumberReturned)
+	this.page = result
+	return true
+}
+
+// The page read by the last successful call to Next()
+func (this *BrowseIter) Page() *BrowseResult {
+	return this.page
+}
+
+// The reason iteration stopped early, or nil
+func (this *BrowseIter) Err() error {
+	return this.err
+}
+
+// The TotalMatches reported by the first page, or zero before it is read
+func (this *BrowseIter) TotalMatches() uint32 {
+	return this.total
+}
+
+// The UpdateID reported by the first page, or zero before it is read
+func (this *BrowseIter) UpdateID() int32 {
+	return this.updateId
+}
+
+//
+// Reads every page of @req (see BrowseIter()) into one result, whose
+// NumberReturned counts the objects read.  When the browse stops early,
+// what was read so far is returned along with the error.
+//
+func (this *ContentDirectory) BrowseAll(ctx context.Context, req *BrowseRequest) (browseResult *BrowseResult, err error) {
+	browseResult = &BrowseResult{Doc: &didl.Lite{}}
+	iter := this.BrowseIter(ctx, req)
+	for iter.Next() {
+		page := iter.Page()
+		browseResult.NumberReturned += page.NumberReturned
+		if nil != page.Doc {
+			browseResult.Doc.Container = append(browseResult.Doc.Container, page.Doc.Container...)
+			browseResult.Doc.Item = append(browseResult.Doc.Item, page.Doc.Item...)
+		}
+	}
+	browseResult.TotalMatches = int32(iter.TotalMatches())
+	browseResult.UpdateID = iter.UpdateID()
+	err = iter.Err()
+	return
+}
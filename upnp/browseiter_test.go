@@ -0,0 +1,210 @@
+//
+// go-sonos
+// ========
+//
+// Copyright (c) 2012, Ian T. Richards <ianr@panix.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//   * Redistributions of source code must retain the above copyright notice,
+//     this list of conditions and the following disclaimer.
+//   * Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+// TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package upnp
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// A page of a scripted Browse response
+type testPage struct {
+	ids      []string
+	total    int32
+	updateId int32
+}
+
+//
+// A ContentDirectory whose Browse calls are answered by @script, given
+// the StartingIndex and RequestedCount of each call, which are also
+// appended to the returned slice in the order they were made.
+//
+func testContentDirectory(t *testing.T, script func(start, count int) testPage) (cd *ContentDirectory, calls *[][2]int) {
+	calls = new([][2]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var args struct {
+			StartingIndex  int `xml:"Body>Browse>StartingIndex"`
+			RequestedCount int `xml:"Body>Browse>RequestedCount"`
+		}
+		if err := xml.Unmarshal(body, &args); nil != err {
+			t.Errorf("Malformed request: %v", err)
+		}
+		*calls = append(*calls, [2]int{args.StartingIndex, args.RequestedCount})
+		page := script(args.StartingIndex, args.RequestedCount)
+		didl := `<DIDL-Lite xmlns="urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/">`
+		for _, id := range page.ids {
+			didl += fmt.Sprintf(`<item id="%s"></item>`, id)
+		}
+		didl += `</DIDL-Lite>`
+		var result strings.Builder
+		xml.EscapeText(&result, []byte(didl))
+		fmt.Fprintf(w, `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>`+
+			`<u:BrowseResponse xmlns:u="urn:schemas-upnp-org:service:ContentDirectory:1">`+
+			`<Result>%s</Result><NumberReturned>%d</NumberReturned><TotalMatches>%d</TotalMatches><UpdateID>%d</UpdateID>`+
+			`</u:BrowseResponse></s:Body></s:Envelope>`, result.String(), len(page.ids), page.total, page.updateId)
+	}))
+	t.Cleanup(server.Close)
+	u, _ := url.Parse(server.URL)
+	svc := &Service{
+		serviceURI:     "schemas-upnp-org",
+		serviceType:    "ContentDirectory",
+		serviceVersion: "1",
+		controlURL:     u,
+		described:      true,
+		actionList:     []*upnpAction{{name: "Browse"}},
+	}
+	return &ContentDirectory{Svc: svc}, calls
+}
+
+// Pages of up to @count of the @total objects 0, 1, ..., all with @updateId
+func testPages(start, count int, total, updateId int32) testPage {
+	page := testPage{total: total, updateId: updateId}
+	for i := start; i < start+count && i < int(total); i++ {
+		page.ids = append(page.ids, fmt.Sprintf("%d", i))
+	}
+	return page
+}
+
+// The ids of every item on the pages read by @iter
+func testReadAll(iter *BrowseIter) (ids []string) {
+	for iter.Next() {
+		for _, item := range iter.Page().Doc.Item {
+			ids = append(ids, item.ID)
+		}
+	}
+	return
+}
+
+func TestBrowseIter(t *testing.T) {
+	cd, calls := testContentDirectory(t, func(start, count int) testPage {
+		return testPages(start, count, 7, 42)
+	})
+	iter := cd.BrowseIter(nil, &BrowseRequest{ObjectID: "A:ARTIST", StartingIndex: 1, RequestCount: 3})
+	ids := testReadAll(iter)
+	if err := iter.Err(); nil != err {
+		t.Fatal(err)
+	}
+	if "1 2 3 4 5 6" != strings.Join(ids, " ") {
+		t.Errorf("Read %v", ids)
+	}
+	if "[[1 3] [4 3]]" != fmt.Sprint(*calls) {
+		t.Errorf("Requested %v", *calls)
+	}
+	if 7 != iter.TotalMatches() || 42 != iter.UpdateID() {
+		t.Errorf("TotalMatches %d, UpdateID %d", iter.TotalMatches(), iter.UpdateID())
+	}
+	if iter.Next() || nil != iter.Page() {
+		t.Error("Next() after the last page")
+	}
+}
+
+func TestBrowseIterDefaultPageSize(t *testing.T) {
+	cd, calls := testContentDirectory(t, func(start, count int) testPage {
+		return testPages(start, count, 250, 1)
+	})
+	if ids := testReadAll(cd.BrowseIter(nil, &BrowseRequest{ObjectID: "A:TRACKS"})); 250 != len(ids) {
+		t.Errorf("Read %d objects", len(ids))
+	}
+	if "[[0 100] [100 100] [200 100]]" != fmt.Sprint(*calls) {
+		t.Errorf("Requested %v", *calls)
+	}
+}
+
+func TestBrowseIterChanged(t *testing.T) {
+	cd, calls := testContentDirectory(t, func(start, count int) testPage {
+		if 0 == start {
+			return testPages(start, count, 6, 42)
+		}
+		return testPages(start, count, 6, 43)
+	})
+	iter := cd.BrowseIter(nil, &BrowseRequest{ObjectID: "A:ARTIST", RequestCount: 2})
+	ids := testReadAll(iter)
+	changed := &BrowseChangedError{}
+	if !errors.As(iter.Err(), &changed) {
+		t.Fatalf("Err() is %v", iter.Err())
+	} else if "A:ARTIST" != changed.ObjectID || 42 != changed.From || 43 != changed.To {
+		t.Errorf("Err() is %+v", changed)
+	}
+	if "0 1" != strings.Join(ids, " ") || 2 != len(*calls) {
+		t.Errorf("Read %v in %v", ids, *calls)
+	}
+	if iter.Next() || 2 != len(*calls) {
+		t.Error("Next() after the change")
+	}
+	all, err := cd.BrowseAll(nil, &BrowseRequest{ObjectID: "A:ARTIST", RequestCount: 2})
+	if !errors.As(err, &changed) || 2 != all.NumberReturned || 2 != len(all.Doc.Item) {
+		t.Errorf("BrowseAll() returned %d objects and %v", all.NumberReturned, err)
+	}
+}
+
+func TestBrowseIterCancelled(t *testing.T) {
+	cd, calls := testContentDirectory(t, func(start, count int) testPage {
+		return testPages(start, count, 6, 42)
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	iter := cd.BrowseIter(ctx, &BrowseRequest{ObjectID: "A:ARTIST", RequestCount: 2})
+	if !iter.Next() {
+		t.Fatalf("First page not read: %v", iter.Err())
+	}
+	cancel()
+	if iter.Next() || nil != iter.Page() {
+		t.Error("Next() after cancellation")
+	} else if context.Canceled != iter.Err() {
+		t.Errorf("Err() is %v", iter.Err())
+	}
+	if 1 != len(*calls) {
+		t.Errorf("Requested %v", *calls)
+	}
+}
+
+func TestBrowseIterShortServer(t *testing.T) {
+	// Claims ten matches but returns only four
+	cd, calls := testContentDirectory(t, func(start, count int) testPage {
+		page := testPages(start, count, 4, 42)
+		page.total = 10
+		return page
+	})
+	iter := cd.BrowseIter(nil, &BrowseRequest{ObjectID: "A:ARTIST", RequestCount: 3})
+	if ids := testReadAll(iter); 4 != len(ids) || nil != iter.Err() {
+		t.Errorf("Read %v (%v)", ids, iter.Err())
+	}
+	if "[[0 3] [3 3] [4 3]]" != fmt.Sprint(*calls) {
+		t.Errorf("Requested %v", *calls)
+	}
+}
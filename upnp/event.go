@@ -34,10 +34,12 @@ import (
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"github.com/ianr0bkny/go-sonos/ssdp"
 	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -57,6 +59,11 @@ type EventFactory interface {
 }
 
 type Reactor interface {
+	// Start listening for events on @port, where @ifiname names the
+	// network device, a comma-separated list of devices, or
+	// ssdp.AllInterfaces.  The callback address given to each service
+	// is the local address on these devices from which the service is
+	// reachable.
 	Init(ifiname, port string)
 	Subscribe(svc *Service, factory EventFactory) error
 	Channel() chan Event
@@ -107,6 +114,7 @@ type Event interface {
 
 type upnpDefaultReactor struct {
 	ifiname     string
+	ifis        []net.Interface
 	port        string
 	initialized bool
 	server      *http.Server
@@ -126,11 +134,11 @@ func (this *upnpDefaultReactor) Init(ifiname, port string) {
 		panic("Attempt to reinitialize reactor")
 	}
 
-	ifi, err := net.InterfaceByName(ifiname)
+	ifis, err := ssdp.Interfaces(ifiname)
 	if err != nil {
 		panic(err)
 	}
-	addrs, err := ifi.Addrs()
+	lip, err := ssdp.LocalAddrFor(ifis, nil)
 	if err != nil {
 		panic(err)
 	}
@@ -138,7 +146,8 @@ func (this *upnpDefaultReactor) Init(ifiname, port string) {
 	this.initialized = true
 	this.port = port
 	this.ifiname = ifiname
-	this.localAddr = net.JoinHostPort(addrs[0].(*net.IPNet).IP.String(), port)
+	this.ifis = ifis
+	this.localAddr = net.JoinHostPort(lip.String(), port)
 	this.server = &http.Server{
 		Addr:           ":" + port,
 		Handler:        nil,
@@ -175,13 +184,33 @@ func (this *upnpDefaultReactor) Channel() chan Event {
 	return this.eventChan
 }
 
+// Choose the address the service at @svc should use to reach us, in
+// the same address family as the service's own address.  IPv6 addresses
+// are bracketed by JoinHostPort.
+func (this *upnpDefaultReactor) callbackAddr(svc *Service) string {
+	var remote net.IP
+	host := svc.eventSubURL.Hostname()
+	if i := strings.LastIndex(host, "%"); -1 != i {
+		host = host[:i] /*drop an IPv6 zone*/
+	}
+	if ip := net.ParseIP(host); nil != ip {
+		remote = ip
+	} else if ips, err := net.LookupIP(host); nil == err && 0 < len(ips) {
+		remote = ips[0]
+	}
+	if lip, err := ssdp.LocalAddrFor(this.ifis, remote); nil == err {
+		return net.JoinHostPort(lip.String(), this.port)
+	}
+	return this.localAddr
+}
+
 func (this *upnpDefaultReactor) subscribeImpl(rec *upnpEventRecord) (err error) {
 	client := &http.Client{}
 	req, err := http.NewRequest("SUBSCRIBE", rec.svc.eventSubURL.String(), nil)
 	if nil != err {
 		return
 	}
-	req.Header.Add("CALLBACK", fmt.Sprintf("<http://%s/eventSub>", this.localAddr))
+	req.Header.Add("CALLBACK", fmt.Sprintf("<http://%s/eventSub>", this.callbackAddr(rec.svc)))
 	req.Header.Add("HOST", rec.svc.eventSubURL.Host)
 	req.Header.Add("USER-AGENT", "unix/5.1 UPnP/1.1 sonos.go/1.0")
 	req.Header.Add("NT", "upnp:event")
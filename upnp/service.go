@@ -239,6 +239,11 @@ type Service struct {
 	actionList     []*upnpAction
 }
 
+// The UDN (uuid:...) of the device providing the service
+func (this *Service) UDN() string {
+	return this.udn
+}
+
 func (this *Service) Actions() (actions []string) {
 	for _, action := range this.actionList {
 		actions = append(actions, action.name)
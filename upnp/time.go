@@ -0,0 +1,143 @@
+//
+// go-sonos
+// ========
+//
+// Copyright (c) 2012, Ian T. Richards <ianr@panix.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//   * Redistributions of source code must retain the above copyright notice,
+//     this list of conditions and the following disclaimer.
+//   * Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+// TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package upnp
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// What players report for a time they cannot give, e.g. the RelTime of a stream
+const TimeNotImplemented = "NOT_IMPLEMENTED"
+
+//
+// Parses a UPnP time value of the form H+:MM:SS[.F+] or H+:MM:SS[.F0/F1]
+// (AVTransport:1 section 2.2.15), such as the TrackDuration and RelTime
+// of GetPositionInfo().  The hours may have any number of digits, and
+// single-digit minutes and seconds are accepted, as is a single leading
+// sign.  Values too long for a time.Duration are an error.
+//
+func ParseTime(in string) (d time.Duration, err error) {
+	in = strings.TrimSpace(in)
+	negative := strings.HasPrefix(in, "-")
+	if negative || strings.HasPrefix(in, "+") {
+		in = in[1:]
+	}
+	parts := strings.Split(in, ":")
+	if 3 != len(parts) {
+		return 0, errors.New(fmt.Sprintf("Malformed time value `%s'", in))
+	}
+	frac := ""
+	if i := strings.Index(parts[2], "."); 0 <= i {
+		parts[2], frac = parts[2][:i], parts[2][i:]
+	}
+	var hours, minutes, seconds uint64
+	if hours, err = strconv.ParseUint(parts[0], 10, 32); nil != err {
+		return 0, errors.New(fmt.Sprintf("Malformed time value `%s'", in))
+	} else if minutes, err = strconv.ParseUint(parts[1], 10, 8); nil != err || 59 < minutes {
+		return 0, errors.New(fmt.Sprintf("Malformed time value `%s'", in))
+	} else if seconds, err = strconv.ParseUint(parts[2], 10, 8); nil != err || 59 < seconds {
+		return 0, errors.New(fmt.Sprintf("Malformed time value `%s'", in))
+	}
+	d = time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second
+	if "" != frac {
+		var f time.Duration
+		if f, err = upnpParseFraction(frac); nil != err {
+			return 0, errors.New(fmt.Sprintf("Malformed time value `%s'", in))
+		}
+		d += f
+	}
+	// The longest time.Duration is a little over 2562047 hours
+	if math.MaxInt64/uint64(time.Hour) < hours || math.MaxInt64-time.Duration(hours)*time.Hour < d {
+		return 0, errors.New(fmt.Sprintf("Time value `%s' out of range", in))
+	}
+	d += time.Duration(hours) * time.Hour
+	if negative {
+		d = -d
+	}
+	return
+}
+
+// Whether @s is one or more decimal digits
+func upnpIsDigits(s string) bool {
+	for _, c := range s {
+		if '0' > c || '9' < c {
+			return false
+		}
+	}
+	return "" != s
+}
+
+//
+// Parses the .F+ (decimal) or .F0/F1 (ratio) part of a time value.
+// Decimal digits past the nanosecond are ignored.
+//
+func upnpParseFraction(frac string) (d time.Duration, err error) {
+	if !strings.HasPrefix(frac, ".") || 1 == len(frac) {
+		return 0, errors.New("Malformed fraction")
+	}
+	frac = frac[1:]
+	if i := strings.Index(frac, "/"); 0 <= i {
+		var num, den uint64
+		if num, err = strconv.ParseUint(frac[:i], 10, 32); nil != err {
+			return
+		} else if den, err = strconv.ParseUint(frac[i+1:], 10, 32); nil != err || num >= den {
+			return 0, errors.New("Malformed fraction")
+		}
+		return time.Duration(num) * time.Second / time.Duration(den), nil
+	}
+	if !upnpIsDigits(frac) {
+		return 0, errors.New("Malformed fraction")
+	}
+	frac = (frac + "000000000")[:9]
+	var ns uint64
+	if ns, err = strconv.ParseUint(frac, 10, 32); nil != err {
+		return
+	}
+	return time.Duration(ns), nil
+}
+
+//
+// Formats @d as HH:MM:SS, truncating any fraction of a second, as taken
+// by Seek(REL_TIME), ConfigureSleepTimer() and alarm start times and
+// durations.  Negative durations are formatted as zero.
+//
+func FormatTime(d time.Duration) string {
+	if 0 > d {
+		d = 0
+	}
+	seconds := int64(d / time.Second)
+	return fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+}
@@ -0,0 +1,111 @@
+//
+// go-sonos
+// ========
+//
+// Copyright (c) 2012, Ian T. Richards <ianr@panix.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//   * Redistributions of source code must retain the above copyright notice,
+//     this list of conditions and the following disclaimer.
+//   * Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+// TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package upnp
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestParseTime(t *testing.T) {
+	tests := []struct {
+		in string
+		d  time.Duration
+		ok bool
+	}{
+		{"0:00:00", 0, true},
+		{"0:03:25", 3*time.Minute + 25*time.Second, true},
+		{"00:03:25", 3*time.Minute + 25*time.Second, true},
+		{"0:3:5", 3*time.Minute + 5*time.Second, true},
+		{"10:00:00", 10 * time.Hour, true},
+		{"123:04:05", 123*time.Hour + 4*time.Minute + 5*time.Second, true},
+		{"0:00:01.5", 1500 * time.Millisecond, true},
+		{"0:00:01.000000001", time.Second + time.Nanosecond, true},
+		{"0:00:01.0000000019", time.Second + time.Nanosecond, true},
+		{"0:00:01.1/4", 1250 * time.Millisecond, true},
+		{"-0:00:10", -10 * time.Second, true},
+		{"+0:00:10", 10 * time.Second, true},
+		{" 0:00:10 ", 10 * time.Second, true},
+		// The longest time.Duration
+		{"2562047:00:00", 2562047 * time.Hour, true},
+		{"2562047:47:16.854775807", math.MaxInt64, true},
+		{"-2562047:47:16.854775807", -math.MaxInt64, true},
+		{"2562047:47:16.854775808", 0, false},
+		{"2562047:47:17", 0, false},
+		{"2562048:00:00", 0, false},
+		{"4294967295:00:00", 0, false},
+		{TimeNotImplemented, 0, false},
+		{"", 0, false},
+		{"0:00", 0, false},
+		{"0:60:00", 0, false},
+		{"0:00:60", 0, false},
+		{"--1:00:00", 0, false},
+		{"+-1:00:00", 0, false},
+		{"0:00:01.", 0, false},
+		{"0:00:01.5e3", 0, false},
+		{"0:00:01.-5", 0, false},
+		{"0:00:01.+5", 0, false},
+		{"0:00:01.4/4", 0, false},
+		{"0:00:01.1/0", 0, false},
+	}
+	for _, test := range tests {
+		d, err := ParseTime(test.in)
+		if test.ok != (nil == err) {
+			t.Errorf("ParseTime(%q): error %v", test.in, err)
+		} else if test.d != d {
+			t.Errorf("ParseTime(%q) = %v, expected %v", test.in, d, test.d)
+		}
+	}
+}
+
+func TestFormatTime(t *testing.T) {
+	tests := []struct {
+		d   time.Duration
+		out string
+	}{
+		{0, "00:00:00"},
+		{3*time.Minute + 25*time.Second, "00:03:25"},
+		{1500 * time.Millisecond, "00:00:01"},
+		{10 * time.Hour, "10:00:00"},
+		{123*time.Hour + 4*time.Minute + 5*time.Second, "123:04:05"},
+		{-time.Second, "00:00:00"},
+	}
+	for _, test := range tests {
+		if out := FormatTime(test.d); test.out != out {
+			t.Errorf("FormatTime(%v) = %q, expected %q", test.d, out, test.out)
+		}
+		if 0 <= test.d {
+			if d, err := ParseTime(FormatTime(test.d)); nil != err || test.d.Truncate(time.Second) != d {
+				t.Errorf("%v did not survive formatting: %v (%v)", test.d, d, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,352 @@
+//
+// go-sonos
+// ========
+//
+// Copyright (c) 2012, Ian T. Richards <ianr@panix.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//   * Redistributions of source code must retain the above copyright notice,
+//     this list of conditions and the following disclaimer.
+//   * Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+// TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+//
+// Parsing and construction of the URIs Sonos players use to name what
+// they play, such as x-rincon-queue:RINCON_000E58...01400#0 for a
+// player's queue or x-sonosapi-stream:s12345?sid=254&flags=8224&sn=0
+// for a radio station.
+//
+package uri
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// The kind of source a URI refers to
+type Kind int
+
+const (
+	Kind_Unknown Kind = iota
+	// A player's queue (x-rincon-queue:)
+	Kind_Queue
+	// Following the coordinator of a group (x-rincon:)
+	Kind_Group
+	// A player's analog line-in (x-rincon-stream:)
+	Kind_LineIn
+	// A home theater player's TV input (x-sonos-htastream:)
+	Kind_TV
+	// A radio station or other live stream
+	Kind_Radio
+	// A track or collection from a music service
+	Kind_MusicService
+	// A file on a music library share (x-file-cifs:)
+	Kind_File
+	// A saved queue or library container (x-rincon-playlist:, file:)
+	Kind_Playlist
+	// A plain http or https resource
+	Kind_HTTP
+)
+
+var kindNames = []string{
+	"Unknown", "Queue", "Group", "LineIn", "TV", "Radio", "MusicService", "File", "Playlist", "HTTP",
+}
+
+func (this Kind) String() string {
+	if 0 <= this && int(this) < len(kindNames) {
+		return kindNames[this]
+	}
+	return kindNames[Kind_Unknown]
+}
+
+// The kind of source each scheme refers to
+var schemeKinds = map[string]Kind{
+	"x-rincon-queue":        Kind_Queue,
+	"x-rincon":              Kind_Group,
+	"x-rincon-stream":       Kind_LineIn,
+	"x-sonos-htastream":     Kind_TV,
+	"x-sonosapi-stream":     Kind_Radio,
+	"x-sonosapi-radio":      Kind_Radio,
+	"x-sonosapi-hls":        Kind_Radio,
+	"x-rincon-mp3radio":     Kind_Radio,
+	"aac":                   Kind_Radio,
+	"hls-radio":             Kind_Radio,
+	"x-sonos-spotify":       Kind_MusicService,
+	"x-sonos-http":          Kind_MusicService,
+	"x-sonosapi-hls-static": Kind_MusicService,
+	"x-sonosprog-http":      Kind_MusicService,
+	"x-rincon-cpcontainer":  Kind_MusicService,
+	"x-sonosapi-rtrecent":   Kind_MusicService,
+	"x-file-cifs":           Kind_File,
+	"x-rincon-playlist":     Kind_Playlist,
+	"file":                  Kind_Playlist,
+	"http":                  Kind_HTTP,
+	"https":                 Kind_HTTP,
+}
+
+// Well-known music service ids, as given in the sid parameter
+const (
+	ServiceID_TuneIn  = 254
+	ServiceID_Spotify = 12
+)
+
+//
+// A query parameter, kept in the order it was given.  A parsed parameter
+// is written back by String() exactly as it was given, escaping and any
+// missing = included, for as long as its Key and Value are unchanged.
+//
+type Param struct {
+	Key   string
+	Value string
+	raw   string
+}
+
+// Parses one key=value pair of a query
+func parseParam(pair string) (param Param) {
+	kv := strings.SplitN(pair, "=", 2)
+	param = Param{Key: kv[0], raw: pair}
+	if 2 == len(kv) {
+		param.Value, _ = url.QueryUnescape(kv[1])
+	}
+	return
+}
+
+func (this Param) String() string {
+	if "" != this.raw {
+		if parsed := parseParam(this.raw); this.Key == parsed.Key && this.Value == parsed.Value {
+			return this.raw
+		}
+	}
+	return this.Key + "=" + url.QueryEscape(this.Value)
+}
+
+// A Sonos URI broken into its parts
+type URI struct {
+	Scheme string
+	Kind   Kind
+	// Everything between the scheme and any query or fragment
+	Opaque string
+	Query  []Param
+	// What follows #, e.g. the queue number of x-rincon-queue
+	Fragment string
+	// The player named by queue, group, line-in, TV and playlist URIs
+	UUID string
+	// The server of hierarchical URIs such as x-file-cifs://host/...
+	Host string
+	// The unescaped path of hierarchical URIs
+	Path string
+}
+
+//
+// Parses @in, which may be any URI.  Schemes not known to be used by
+// Sonos are accepted with Kind_Unknown.
+//
+func Parse(in string) (this *URI, err error) {
+	i := strings.Index(in, ":")
+	if 0 >= i {
+		return nil, errors.New(fmt.Sprintf("No scheme in URI %q", in))
+	}
+	this = &URI{Scheme: strings.ToLower(in[:i])}
+	this.Kind = schemeKinds[this.Scheme]
+	rest := in[i+1:]
+	if j := strings.Index(rest, "#"); 0 <= j {
+		rest, this.Fragment = rest[:j], rest[j+1:]
+	}
+	if j := strings.Index(rest, "?"); 0 <= j {
+		var query string
+		rest, query = rest[:j], rest[j+1:]
+		for _, pair := range strings.Split(query, "&") {
+			if "" == pair {
+				continue
+			}
+			this.Query = append(this.Query, parseParam(pair))
+		}
+	}
+	this.Opaque = rest
+	switch this.Kind {
+	case Kind_Queue, Kind_Group, Kind_LineIn, Kind_Playlist:
+		if strings.HasPrefix(rest, "RINCON_") {
+			this.UUID = rest
+		}
+	case Kind_TV:
+		this.UUID = strings.SplitN(rest, ":", 2)[0]
+	}
+	if strings.HasPrefix(rest, "//") {
+		hostPath := strings.SplitN(rest[2:], "/", 2)
+		this.Host = hostPath[0]
+		if 2 == len(hostPath) {
+			this.Path, _ = url.PathUnescape("/" + hostPath[1])
+		}
+	}
+	return
+}
+
+// Reassembles the URI
+func (this *URI) String() string {
+	s := this.Scheme + ":" + this.Opaque
+	if 0 < len(this.Query) {
+		pairs := make([]string, len(this.Query))
+		for i, param := range this.Query {
+			pairs[i] = param.String()
+		}
+		s += "?" + strings.Join(pairs, "&")
+	}
+	if "" != this.Fragment {
+		s += "#" + this.Fragment
+	}
+	return s
+}
+
+// Returns the value of the query parameter @key
+func (this *URI) Get(key string) (value string, has bool) {
+	for _, param := range this.Query {
+		if key == param.Key {
+			return param.Value, true
+		}
+	}
+	return
+}
+
+// Sets the query parameter @key, adding it after the others if not present
+func (this *URI) Set(key, value string) {
+	for i := range this.Query {
+		if key == this.Query[i].Key {
+			this.Query[i].Value = value
+			return
+		}
+	}
+	this.Query = append(this.Query, Param{Key: key, Value: value})
+}
+
+func (this *URI) getInt(key string) (n int, has bool) {
+	var value string
+	if value, has = this.Get(key); has {
+		var err error
+		if n, err = strconv.Atoi(value); nil != err {
+			has = false
+		}
+	}
+	return
+}
+
+// The music service id (sid), if given
+func (this *URI) ServiceID() (int, bool) {
+	return this.getInt("sid")
+}
+
+// The account serial number (sn) of the music service, if given
+func (this *URI) SN() (int, bool) {
+	return this.getInt("sn")
+}
+
+// The playback flags, if given
+func (this *URI) Flags() (int, bool) {
+	return this.getInt("flags")
+}
+
+//
+// The item a music service or radio URI refers to, unescaped, e.g.
+// s12345 or spotify:track:4uLU6hMCjMI75M1A2tKUQC.
+//
+func (this *URI) ItemID() string {
+	id, err := unescapeItem(this.Opaque)
+	if nil != err {
+		return this.Opaque
+	}
+	return id
+}
+
+//
+// Escape a music service item id as Sonos does: path escaping, with the
+// colons of ids such as spotify:track:... escaped as %3a as well.
+//
+func escapeItem(id string) string {
+	return strings.Replace(url.PathEscape(id), ":", "%3a", -1)
+}
+
+// Undo escapeItem()
+func unescapeItem(escaped string) (string, error) {
+	return url.PathUnescape(escaped)
+}
+
+// The URI of queue @n (normally 0) of the player @uuid
+func Queue(uuid string, n int) string {
+	return fmt.Sprintf("x-rincon-queue:%s#%d", uuid, n)
+}
+
+// The URI that makes a player join the group coordinated by @uuid
+func Group(uuid string) string {
+	return "x-rincon:" + uuid
+}
+
+// The URI of the line-in of the player @uuid
+func LineIn(uuid string) string {
+	return "x-rincon-stream:" + uuid
+}
+
+// The URI of the TV (S/PDIF) input of the home theater player @uuid
+func TV(uuid string) string {
+	return "x-sonos-htastream:" + uuid + ":spdif"
+}
+
+// The URI of @relpath on the SMB share @share of @host
+func File(host, share, relpath string) string {
+	u := url.URL{Scheme: "x-file-cifs", Host: host, Path: "/" + strings.TrimPrefix(share+"/"+relpath, "/")}
+	return u.String()
+}
+
+//
+// The URI of the item @id from the music service @sid.  @scheme is the
+// service's scheme, such as x-sonos-spotify or x-sonos-http.
+//
+func MusicService(scheme, id string, sid, flags, sn int) string {
+	this := &URI{Scheme: scheme, Opaque: escapeItem(id)}
+	this.Set("sid", strconv.Itoa(sid))
+	this.Set("flags", strconv.Itoa(flags))
+	this.Set("sn", strconv.Itoa(sn))
+	return this.String()
+}
+
+// The URI of the TuneIn station @station (e.g. s12345)
+func Radio(station string) string {
+	return MusicService("x-sonosapi-stream", station, ServiceID_TuneIn, 8224, 0)
+}
+
+//
+// The URI that has Sonos play the http MP3 stream at @httpURL as a radio
+// station, with its stream metadata.
+//
+func MP3Radio(httpURL string) string {
+	return "x-rincon-mp3radio:" + strings.TrimPrefix(httpURL, "http:")
+}
+
+// The URI of the saved queue (Sonos playlist) with object id SQ:@n
+func SavedQueue(n int) string {
+	return fmt.Sprintf("file:///jffs/settings/savedqueues.rsq#%d", n)
+}
+
+// The URI of the library container @objectID shared by the player @uuid
+func Playlist(uuid, objectID string) string {
+	return fmt.Sprintf("x-rincon-playlist:%s#%s", uuid, objectID)
+}
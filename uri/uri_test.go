@@ -0,0 +1,151 @@
+//
+// go-sonos
+// ========
+//
+// Copyright (c) 2012, Ian T. Richards <ianr@panix.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//   * Redistributions of source code must retain the above copyright notice,
+//     this list of conditions and the following disclaimer.
+//   * Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+// TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package uri
+
+import (
+	"testing"
+)
+
+func TestURIs(t *testing.T) {
+	tests := []struct {
+		uri    string
+		kind   Kind
+		uuid   string
+		item   string
+		sid    int
+		flags  int
+		sn     int
+		params bool
+	}{
+		{uri: Queue("RINCON_000E58741A8401400", 0), kind: Kind_Queue, uuid: "RINCON_000E58741A8401400"},
+		{uri: Group("RINCON_000E58741A8401400"), kind: Kind_Group, uuid: "RINCON_000E58741A8401400"},
+		{uri: LineIn("RINCON_000E58741A8401400"), kind: Kind_LineIn, uuid: "RINCON_000E58741A8401400"},
+		{uri: TV("RINCON_000E58741A8401400"), kind: Kind_TV, uuid: "RINCON_000E58741A8401400"},
+		{uri: Radio("s12345"), kind: Kind_Radio, item: "s12345",
+			sid: ServiceID_TuneIn, flags: 8224, sn: 0, params: true},
+		{uri: MusicService("x-sonos-spotify", "spotify:track:4uLU6hMCjMI75M1A2tKUQC", ServiceID_Spotify, 8224, 3),
+			kind: Kind_MusicService, item: "spotify:track:4uLU6hMCjMI75M1A2tKUQC",
+			sid: ServiceID_Spotify, flags: 8224, sn: 3, params: true},
+		{uri: MusicService("x-sonos-http", "track 1/a?b#c.mp3", 2, 0, 1),
+			kind: Kind_MusicService, item: "track 1/a?b#c.mp3", sid: 2, flags: 0, sn: 1, params: true},
+		{uri: MP3Radio("http://example.com:8000/stream.mp3"), kind: Kind_Radio, item: "//example.com:8000/stream.mp3"},
+		{uri: File("nas", "music", "a b/c.mp3"), kind: Kind_File},
+		{uri: SavedQueue(3), kind: Kind_Playlist},
+		{uri: Playlist("RINCON_000E58741A8401400", "A:ALBUM/x"), kind: Kind_Playlist, uuid: "RINCON_000E58741A8401400"},
+		{uri: "https://example.com/a.mp3", kind: Kind_HTTP},
+		{uri: "x-unheard-of:thing", kind: Kind_Unknown},
+	}
+	for _, test := range tests {
+		u, err := Parse(test.uri)
+		if nil != err {
+			t.Errorf("Parse(%q): %v", test.uri, err)
+			continue
+		}
+		if test.kind != u.Kind {
+			t.Errorf("%q: kind is %v, expected %v", test.uri, u.Kind, test.kind)
+		}
+		if test.uuid != u.UUID {
+			t.Errorf("%q: uuid is %q, expected %q", test.uri, u.UUID, test.uuid)
+		}
+		if "" != test.item && test.item != u.ItemID() {
+			t.Errorf("%q: item is %q, expected %q", test.uri, u.ItemID(), test.item)
+		}
+		if test.params {
+			sid, hasSid := u.ServiceID()
+			flags, hasFlags := u.Flags()
+			sn, hasSN := u.SN()
+			if !hasSid || !hasFlags || !hasSN || test.sid != sid || test.flags != flags || test.sn != sn {
+				t.Errorf("%q: sid %d, flags %d, sn %d", test.uri, sid, flags, sn)
+			}
+		}
+		if s := u.String(); test.uri != s {
+			t.Errorf("%q: reassembled as %q", test.uri, s)
+		}
+	}
+}
+
+func TestItemEscaping(t *testing.T) {
+	s := MusicService("x-sonos-spotify", "spotify:track:4uLU6hMCjMI75M1A2tKUQC", ServiceID_Spotify, 8224, 3)
+	if "x-sonos-spotify:spotify%3atrack%3a4uLU6hMCjMI75M1A2tKUQC?sid=12&flags=8224&sn=3" != s {
+		t.Errorf("Spotify track URI is %q", s)
+	}
+	if s = MusicService("x-sonos-http", "a b+c", 2, 0, 1); "x-sonos-http:a%20b+c?sid=2&flags=0&sn=1" != s {
+		t.Errorf("URI with a space is %q", s)
+	}
+}
+
+func TestFile(t *testing.T) {
+	u, err := Parse(File("nas", "music", "a b/c.mp3"))
+	if nil != err {
+		t.Fatal(err)
+	} else if "nas" != u.Host || "/music/a b/c.mp3" != u.Path {
+		t.Errorf("host %q, path %q", u.Host, u.Path)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, in := range []string{
+		"x-sonosapi-hls:catalog%3atrack%3a1?sid=284&flags&sn=4",
+		"x-sonos-http:librarytrack%3aa.1.mp4?sid=204&flags=8224&sn=1&x=a%2fb",
+		"x-sonosapi-stream:s12345?sid=254&flags=32&sn=0&q=a+b%2Bc",
+		"aac://http://example.com/stream?a=1&b",
+		"x-rincon-mp3radio://example.com/s?token=%3D%3D",
+		"x-rincon-queue:RINCON_000E58741A8401400#0",
+	} {
+		u, err := Parse(in)
+		if nil != err {
+			t.Errorf("Parse(%q): %v", in, err)
+		} else if out := u.String(); in != out {
+			t.Errorf("%q reassembled as %q", in, out)
+		}
+	}
+}
+
+func TestSetQuery(t *testing.T) {
+	u, err := Parse("x-sonosapi-hls:catalog%3atrack%3a1?sid=284&flags&x=a%2fb")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if value, has := u.Get("flags"); !has || "" != value {
+		t.Errorf("flags is %q (%v)", value, has)
+	}
+	if value, _ := u.Get("x"); "a/b" != value {
+		t.Errorf("x is %q", value)
+	}
+	u.Set("flags", "8224")
+	u.Set("sn", "3")
+	if s := u.String(); "x-sonosapi-hls:catalog%3atrack%3a1?sid=284&flags=8224&x=a%2fb&sn=3" != s {
+		t.Errorf("Reassembled as %q", s)
+	}
+	u.Query[2].Value = "c d"
+	if s := u.String(); "x-sonosapi-hls:catalog%3atrack%3a1?sid=284&flags=8224&x=c+d&sn=3" != s {
+		t.Errorf("Reassembled as %q", s)
+	}
+}
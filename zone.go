@@ -0,0 +1,269 @@
+//
+// go-sonos
+// ========
+//
+// Copyright (c) 2012, Ian T. Richards <ianr@panix.com>
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+//   * Redistributions of source code must retain the above copyright notice,
+//     this list of conditions and the following disclaimer.
+//   * Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer in the
+//     documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+// TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package sonos
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ianr0bkny/go-sonos/model"
+	"github.com/ianr0bkny/go-sonos/ssdp"
+	"github.com/ianr0bkny/go-sonos/upnp"
+)
+
+//
+// A room addressed as a unit.  Transport and queue commands are sent to
+// the coordinator of the group the room currently belongs to, as found
+// in the household topology; if a command fails and a refreshed topology
+// names a different coordinator, the command is retried once against it.
+// Commands that act on the room alone, such as volume, go to the room's
+// main player.
+//
+type Zone struct {
+	household *Household
+	// The room is tracked by its main player, which survives renaming
+	uuid ssdp.UUID
+}
+
+// Returns the zone for the room known by @ident; see Lookup()
+func (this *Household) Zone(ident string) (zone *Zone, err error) {
+	if room := this.Lookup(ident); nil == room {
+		err = errors.New(fmt.Sprintf("No room `%s' in the household", ident))
+	} else {
+		zone = &Zone{household: this, uuid: room.Main.UUID}
+	}
+	return
+}
+
+// Returns the zone of every room, sorted by name
+func (this *Household) Zones() (zones []*Zone) {
+	for _, room := range this.Rooms() {
+		zones = append(zones, &Zone{household: this, uuid: room.Main.UUID})
+	}
+	return
+}
+
+// Returns the room as currently described by the household topology
+func (this *Zone) Room() (room *Room, err error) {
+	if player := this.household.Player(this.uuid); nil == player {
+		err = errors.New(fmt.Sprintf("Player %s has left the household", this.uuid))
+	} else {
+		room = player.Room
+	}
+	return
+}
+
+// The name of the room
+func (this *Zone) Name() string {
+	if room, err := this.Room(); nil == err {
+		return room.Name
+	}
+	return string(this.uuid)
+}
+
+// True if the room coordinates its group
+func (this *Zone) IsCoordinator() bool {
+	room, err := this.Room()
+	return nil == err && room == room.Group.Coordinator
+}
+
+func (this *Zone) coordinatorPlayer() (player *Player, err error) {
+	var room *Room
+	if room, err = this.Room(); nil == err {
+		player = room.Group.Coordinator.Main
+	}
+	return
+}
+
+//
+// Run @op against the coordinator of the room's group, retrying once
+// against a new coordinator if the topology has changed.
+//
+func (this *Zone) withCoordinator(op func(*Sonos) error) (err error) {
+	var before, after *Player
+	if before, err = this.coordinatorPlayer(); nil != err {
+		return
+	}
+	if err = this.household.call(before, op); nil == err {
+		return
+	}
+	if rerr := this.household.Refresh(); nil != rerr {
+		return
+	}
+	var rerr error
+	if after, rerr = this.coordinatorPlayer(); nil != rerr || after.UUID == before.UUID {
+		return
+	}
+	return this.household.call(after, op)
+}
+
+// Run @op against the room's own main player
+func (this *Zone) withMain(op func(*Sonos) error) (err error) {
+	var room *Room
+	if room, err = this.Room(); nil == err {
+		err = this.household.call(room.Main, op)
+	}
+	return
+}
+
+// Returns a connection to the current coordinator of the room's group
+func (this *Zone) Coordinator() (sonos *Sonos, err error) {
+	var player *Player
+	if player, err = this.coordinatorPlayer(); nil == err {
+		sonos, err = this.household.connect(player)
+	}
+	return
+}
+
+// Returns a connection to the room's main player
+func (this *Zone) Main() (sonos *Sonos, err error) {
+	var room *Room
+	if room, err = this.Room(); nil == err {
+		sonos, err = this.household.connect(room.Main)
+	}
+	return
+}
+
+// Start or resume playback of the group at normal speed
+func (this *Zone) Play() error {
+	return this.withCoordinator(func(s *Sonos) error {
+		return s.AVTransport.Play(0, upnp.PlaySpeed_1)
+	})
+}
+
+func (this *Zone) Pause() error {
+	return this.withCoordinator(func(s *Sonos) error {
+		return s.AVTransport.Pause(0)
+	})
+}
+
+func (this *Zone) Stop() error {
+	return this.withCoordinator(func(s *Sonos) error {
+		return s.AVTransport.Stop(0)
+	})
+}
+
+func (this *Zone) Next() error {
+	return this.withCoordinator(func(s *Sonos) error {
+		return s.AVTransport.Next(0)
+	})
+}
+
+func (this *Zone) Previous() error {
+	return this.withCoordinator(func(s *Sonos) error {
+		return s.AVTransport.Previous(0)
+	})
+}
+
+// See AVTransport.Seek()
+func (this *Zone) Seek(unit, target string) error {
+	return this.withCoordinator(func(s *Sonos) error {
+		return s.AVTransport.Seek(0, unit, target)
+	})
+}
+
+// See AVTransport.SetPlayMode()
+func (this *Zone) SetPlayMode(mode string) error {
+	return this.withCoordinator(func(s *Sonos) error {
+		return s.AVTransport.SetPlayMode(0, mode)
+	})
+}
+
+// See AVTransport.SetAVTransportURI()
+func (this *Zone) SetAVTransportURI(uri, metadata string) error {
+	return this.withCoordinator(func(s *Sonos) error {
+		return s.AVTransport.SetAVTransportURI(0, uri, metadata)
+	})
+}
+
+// See AVTransport.AddURIToQueue()
+func (this *Zone) AddURIToQueue(req *upnp.AddURIToQueueIn) (out *upnp.AddURIToQueueOut, err error) {
+	err = this.withCoordinator(func(s *Sonos) (err error) {
+		out, err = s.AVTransport.AddURIToQueue(0, req)
+		return
+	})
+	return
+}
+
+// Empty the group's queue
+func (this *Zone) ClearQueue() error {
+	return this.withCoordinator(func(s *Sonos) error {
+		return s.AVTransport.RemoveAllTracksFromQueue(0)
+	})
+}
+
+// Returns the contents of the group's queue
+func (this *Zone) Queue() (objects []model.Object, err error) {
+	err = this.withCoordinator(func(s *Sonos) (err error) {
+		objects, err = s.GetQueueContents()
+		return
+	})
+	return
+}
+
+func (this *Zone) GetTransportInfo() (info *upnp.TransportInfo, err error) {
+	err = this.withCoordinator(func(s *Sonos) (err error) {
+		info, err = s.AVTransport.GetTransportInfo(0)
+		return
+	})
+	return
+}
+
+func (this *Zone) GetPositionInfo() (info *upnp.PositionInfo, err error) {
+	err = this.withCoordinator(func(s *Sonos) (err error) {
+		info, err = s.AVTransport.GetPositionInfo(0)
+		return
+	})
+	return
+}
+
+func (this *Zone) GetMediaInfo() (info *upnp.MediaInfo, err error) {
+	err = this.withCoordinator(func(s *Sonos) (err error) {
+		info, err = s.AVTransport.GetMediaInfo(0)
+		return
+	})
+	return
+}
+
+// Returns the volume of the room (not the group) on the master channel
+func (this *Zone) GetVolume() (volume uint16, err error) {
+	err = this.withMain(func(s *Sonos) (err error) {
+		volume, err = s.RenderingControl.GetVolume(0, upnp.Channel_Master)
+		return
+	})
+	return
+}
+
+// Sets the volume of the room (not the group) on the master channel
+func (this *Zone) SetVolume(volume uint16) error {
+	return this.withMain(func(s *Sonos) error {
+		return s.RenderingControl.SetVolume(0, upnp.Channel_Master, volume)
+	})
+}